@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 
 	tea "charm.land/bubbletea/v2"
@@ -29,9 +31,12 @@ import (
 	"github.com/g-brook/brook/common/cmd"
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/loadbalance"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/notify"
 	"github.com/g-brook/brook/common/pid"
+	"github.com/g-brook/brook/common/proxyproto"
+	"github.com/g-brook/brook/common/tlsx"
 	"github.com/g-brook/brook/common/version"
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
@@ -41,7 +46,10 @@ var (
 	config   *configs.ClientConfig
 	cmdValue = cmd.NewCliCmdValue()
 	service  *run.Service
+	admin    *run.Admin
 	name     = "Brook Tunnel Client(brook-cli)"
+
+	reloadLock sync.Mutex
 )
 
 func init() {
@@ -83,9 +91,22 @@ func rootRun(cmd *cobra.Command, args []string) {
 	run.LoadTunnel()
 	verilyBaseConfig(config)
 	startServer(config)
-	// wait for exit
-	<-sysCtx.Done()
-	shutdown()
+	watchConfig(sysCtx, cmdValue.ConfigPath, reload)
+	// Reload the tunnels on SIGHUP, the configs file is also watched for changes.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			if err := reload(); err != nil {
+				log.Error("reload error %v", err)
+			}
+		case <-sysCtx.Done():
+			shutdown()
+			return
+		}
+	}
 }
 
 func loggerInit() {
@@ -99,25 +120,48 @@ func loggerInit() {
 		}
 		log.AddWriter("cli", cli.NewCLIWriteSyncer(config.Logger.LoggLevel))
 	}
+	if config.ManagerPort > 0 {
+		//Keep the recent logs for the admin api.
+		if config.Logger == nil {
+			config.Logger = &configs.LoggerConfig{}
+		}
+		if config.Logger.Outs == "" {
+			config.Logger.Outs = "stdout,file"
+		}
+		config.Logger.Outs += ",admin"
+		log.AddWriter("admin", cli.NewRecentLogWriter())
+	}
 	log.NewLogger(config.Logger)
 }
 
 func verilyBaseConfig(c *configs.ClientConfig) {
-	if c.ServerHost == "" {
-		panic("ServerHost is null, system exit")
+	if slices.Contains(c.Servers, nil) {
+		panic("Servers has an empty entry, system exit")
 	}
-	if c.ServerPort <= 0 {
-		panic("ServerPort is 0, system exit")
+	for _, it := range c.ServerEndpoints() {
+		if it.Host == "" {
+			panic("ServerHost is null, system exit")
+		}
+		if it.Port <= 0 {
+			panic("ServerPort is 0, system exit")
+		}
 	}
-	if c.Token == "" {
+	if c.ServerStrategy != "" && c.ServerStrategy != "priority" && c.ServerStrategy != string(loadbalance.StrategyRoundRobin) {
+		panic("ServerStrategy（priority、roundRobin） is unknown, system exit")
+	}
+	if c.Token == "" && !tlsx.HasCertificate(c.Tls) {
 		panic("Token is nil, system exit")
 	}
 	if c.PingTime <= lang.DefaultPingTime {
 		c.PingTime = lang.DefaultPingTime
 	}
-	i := len(c.Tunnels)
-	if i <= 0 {
-		panic("Tunnels is null, system exit")
+	if len(c.Tunnels) == 0 && len(c.Visitors) == 0 {
+		log.Info("Tunnels is empty, the tunnels of the server will be served")
+	}
+	for _, it := range c.Visitors {
+		if it.ProxyId == "" || it.Secret == "" || it.Bind == "" {
+			panic("Visitors ProxyId, Secret or Bind is null, system exit")
+		}
 	}
 	for _, it := range c.Tunnels {
 		if it.ProxyId == "" {
@@ -126,7 +170,50 @@ func verilyBaseConfig(c *configs.ClientConfig) {
 		if it.TunnelType == "" {
 			panic("Tunnels TunnelType（tcp、udp、http(s)） is null, system exit")
 		}
+		if err := checkTunnel(it); err != nil {
+			panic(err.Error() + ", system exit")
+		}
+	}
+}
+
+// checkTunnel validates the options of a tunnel that a typo would silently ignore.
+func checkTunnel(it *configs.ClientTunnelConfig) error {
+	if it.ProxyProtocol == "" {
+		return nil
+	}
+	if !proxyproto.IsValid(it.ProxyProtocol) {
+		return fmt.Errorf("tunnel %s proxyProtocol %s is not v1 or v2", it.ProxyId, it.ProxyProtocol)
+	}
+	switch it.TunnelType {
+	case lang.Tcp, lang.Quic:
+	case lang.Udp:
+		if it.ProxyProtocol == proxyproto.V1 {
+			return fmt.Errorf("tunnel %s: udp only has proxyProtocol v2", it.ProxyId)
+		}
+	default:
+		return fmt.Errorf("tunnel %s: proxyProtocol is for tcp, quic and udp tunnels", it.ProxyId)
 	}
+	return nil
+}
+
+// reload reads the configs file again and applies its tunnels.
+func reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	newConfig := &configs.ClientConfig{}
+	if err := configs.WriterConfig(cmdValue.ConfigPath, newConfig); err != nil {
+		return err
+	}
+	for _, it := range newConfig.Tunnels {
+		if it.ProxyId == "" || it.TunnelType == "" {
+			return fmt.Errorf("tunnel ProxyId or TunnelType is null")
+		}
+		if err := checkTunnel(it); err != nil {
+			return err
+		}
+	}
+	log.Info("brook reloading configs...")
+	return service.ReloadTunnels(newConfig.Tunnels)
 }
 
 func Start() {
@@ -150,14 +237,30 @@ func startServer(config *configs.ClientConfig) {
 	go OpenCli()
 	service = run.NewService()
 	service.Run(config)
+	run.ReloadFun = reload
+	run.GiveUpFun = giveUp
+	admin = run.StartAdmin(config.ManagerPort, config.Token, service)
 	pid.CreatePidFile()
 	defer func() {
 		_ = pid.DeletePidFile()
 	}()
 }
 
+// giveUp exits with an error once the client gave up reconnecting, so a supervisor can
+// restart it.
+func giveUp(err error) {
+	log.Error("brook exiting: %v", err)
+	admin.Close()
+	_ = notify.NotifyStopping()
+	os.Exit(1)
+}
+
 func shutdown() {
 	log.Info("brook exiting; bye bye!! 👋")
+	admin.Close()
+	if service != nil {
+		service.Shutdown()
+	}
 	_ = notify.NotifyStopping()
 	os.Exit(0)
 }
@@ -166,7 +269,7 @@ func OpenCli() {
 	if !isatty.IsTerminal(os.Stdin.Fd()) {
 		return
 	}
-	model := cli.NewTUIModel(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort))
+	model := cli.NewTUIModel(config.ServerEndpoints()[0].String())
 	program := tea.NewProgram(model, tea.WithInput(os.Stdin), tea.WithoutSignals(),
 		tea.WithOutput(os.Stdout))
 	cli.SetGlobalProgram(program)
@@ -0,0 +1,61 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package run
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+)
+
+// watchInterval the interval of checking the configs file for changes.
+var watchInterval = 2 * time.Second
+
+// watchConfig reloads the configs when the configs file is modified, until the context is done.
+func watchConfig(ctx context.Context, path string, reload func() error) {
+	modTime := configModTime(path)
+	threading.GoSafe(func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			t := configModTime(path)
+			if t.IsZero() || t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+			log.Info("Configs file %s is modified", path)
+			if err := reload(); err != nil {
+				log.Error("reload error %v", err)
+			}
+		}
+	})
+}
+
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/log"
+)
+
+func TestWatchConfig(t *testing.T) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	old := watchInterval
+	watchInterval = 20 * time.Millisecond
+	t.Cleanup(func() { watchInterval = old })
+	path := filepath.Join(t.TempDir(), "client.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var reloads atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchConfig(ctx, path, func() error {
+		reloads.Add(1)
+		return nil
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	if n := reloads.Load(); n != 0 {
+		t.Fatalf("reloaded %d times without a change", n)
+	}
+	// Move the modification time on, the file system may keep it in seconds.
+	modified := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	waitReloads(t, &reloads, 1)
+	time.Sleep(100 * time.Millisecond)
+	if n := reloads.Load(); n != 1 {
+		t.Fatalf("reloaded %d times for one change", n)
+	}
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	modified = modified.Add(time.Minute)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := reloads.Load(); n != 1 {
+		t.Fatalf("reloaded after the watch stopped, %d times", n)
+	}
+}
+
+func waitReloads(t *testing.T, reloads *atomic.Int32, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for reloads.Load() < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := reloads.Load(); n != want {
+		t.Fatalf("reloaded %d times, want %d", n, want)
+	}
+}
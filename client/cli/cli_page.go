@@ -222,6 +222,9 @@ type (
 	LatencyUpdateMsg struct {
 		Latency int64
 	}
+	NextRetryUpdateMsg struct {
+		Next time.Time
+	}
 	FocusChangeMsg struct {
 		View string
 	}
@@ -613,6 +616,7 @@ type TUIModel struct {
 	RemoteAddress string
 	Status        string
 	Latency       int64
+	NextRetry     time.Time
 
 	// Spinner
 	spinnerIdx int
@@ -740,6 +744,8 @@ func (m *TUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.RemoteAddress = msg.Address
 	case LatencyUpdateMsg:
 		m.Latency = msg.Latency
+	case NextRetryUpdateMsg:
+		m.NextRetry = msg.Next
 
 	case SetTotalHeightMsg:
 		m.SetTotalHeight(msg.Height)
@@ -888,6 +894,10 @@ func (m *TUIModel) renderStatus(sb *strings.Builder) {
 	default:
 		statusRendered = statusValueStyle.Render(strings.ToUpper(m.Status))
 	}
+	if !m.NextRetry.IsZero() {
+		wait := max(time.Until(m.NextRetry), 0).Round(time.Second)
+		statusRendered += lipgloss.NewStyle().Foreground(colorDim).Render(fmt.Sprintf("  retry in %v", wait))
+	}
 	// Latency with color grading
 	var latencyRendered string
 	switch {
@@ -968,11 +978,13 @@ func getGlobalProgram() *tea.Program {
 }
 
 func UpdateStatus(status string) {
+	updateState(func(s *State) { s.Status = status })
 	if prog := getGlobalProgram(); prog != nil {
 		prog.Send(StatusUpdateMsg{Status: status})
 	}
 }
 func UpdateRemoteAddress(addr string) {
+	updateState(func(s *State) { s.RemoteAddress = addr })
 	if prog := getGlobalProgram(); prog != nil {
 		prog.Send(AddressUpdateMsg{Address: addr})
 	}
@@ -996,7 +1008,16 @@ func UpdateConnState(isClose bool) {
 	}
 }
 
+// UpdateNextRetry shows the time of the next reconnection, zero when not reconnecting.
+func UpdateNextRetry(next time.Time) {
+	updateState(func(s *State) { s.NextRetry = next })
+	if prog := getGlobalProgram(); prog != nil {
+		prog.Send(NextRetryUpdateMsg{Next: next})
+	}
+}
+
 func UpdateLatency(ms int64) {
+	updateState(func(s *State) { s.Latency = ms })
 	if prog := getGlobalProgram(); prog != nil {
 		prog.Send(LatencyUpdateMsg{Latency: ms})
 	}
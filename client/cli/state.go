@@ -0,0 +1,93 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============ Headless State ============
+
+// State is what the TUI shows, kept so that it can be read when there is no TUI.
+type State struct {
+	Status        string    `json:"status"`
+	RemoteAddress string    `json:"remoteAddress"`
+	Latency       int64     `json:"latencyMs"`
+	NextRetry     time.Time `json:"nextRetry,omitzero"`
+}
+
+var (
+	state   State
+	stateMu sync.RWMutex
+
+	recentLogs   = make([]string, 0, MaxLogLines)
+	recentLogsMu sync.Mutex
+
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// GetState returns the current state.
+func GetState() State {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return state
+}
+
+func updateState(f func(s *State)) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	f(&state)
+}
+
+// RecentLogs returns the last n log lines, all of them when n <= 0.
+func RecentLogs(n int) []string {
+	recentLogsMu.Lock()
+	defer recentLogsMu.Unlock()
+	if n <= 0 || n > len(recentLogs) {
+		n = len(recentLogs)
+	}
+	logs := make([]string, n)
+	copy(logs, recentLogs[len(recentLogs)-n:])
+	return logs
+}
+
+// RecentLogWriter keeps the last MaxLogLines log lines for RecentLogs.
+type RecentLogWriter struct {
+}
+
+func NewRecentLogWriter() *RecentLogWriter {
+	return &RecentLogWriter{}
+}
+
+func (w *RecentLogWriter) Write(p []byte) (n int, err error) {
+	msg := strings.TrimSpace(ansiEscape.ReplaceAllString(string(p), ""))
+	if msg == "" {
+		return len(p), nil
+	}
+	recentLogsMu.Lock()
+	defer recentLogsMu.Unlock()
+	if len(recentLogs) >= MaxLogLines {
+		recentLogs = append(recentLogs[:0], recentLogs[1:]...)
+	}
+	recentLogs = append(recentLogs, msg)
+	return len(p), nil
+}
+
+func (w *RecentLogWriter) Sync() error { return nil }
@@ -18,6 +18,7 @@ package clis
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -27,9 +28,12 @@ import (
 
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/hash"
 	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/quic-go/quic-go"
 	"github.com/xtaci/smux"
 )
 
@@ -145,9 +149,10 @@ type Client struct {
 
 	network string
 
-	session *smux.Session
+	session Session
 
-	tunnelClient TunnelClient
+	// tunnelClients the opened tunnel clients of each proxy id.
+	tunnelClients *hash.SyncMap[string, TunnelClient]
 }
 
 // NewClient creates a new Client instance with the provided host and port.
@@ -173,7 +178,8 @@ func NewClient(host string, port int) *Client {
 			revRead: make(chan struct{}),
 			write:   make(chan []byte, 1024),
 		},
-		handlers: make([]ClientHandler, 0),
+		handlers:      make([]ClientHandler, 0),
+		tunnelClients: hash.NewSyncMap[string, TunnelClient](),
 	}
 }
 
@@ -223,13 +229,27 @@ func (c *Client) pre(network string, option []ClientOption) {
 	c.cct.cli = c
 }
 
+// dial connects to the server, over TLS if it's configured.
+func (c *Client) dial(ctx context.Context, dialer *net.Dialer) (net.Conn, error) {
+	address := c.host + ":" + fmt.Sprintf("%d", c.port)
+	if c.opts.Tls != nil {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    c.opts.Tls,
+		}
+		return tlsDialer.DialContext(ctx, c.network, address)
+	}
+	return dialer.DialContext(ctx, c.network, address)
+}
+
 // doConnection establishes a connection to the server and initializes the client session
 // It handles both regular connections and smux multiplexed connections
 func (c *Client) doConnection() error {
 	// Clean up existing connection and session if they exist
-	if c.conn != nil {
-		c.conn = nil
-		c.session = nil
+	c.conn = nil
+	c.session = nil
+	if c.isQuic() {
+		return c.doQuicConnection()
 	}
 
 	// Create a dialer with configured keep-alive and timeout settings
@@ -243,7 +263,7 @@ func (c *Client) doConnection() error {
 	defer cancelFunc()
 
 	// Attempt to establish connection to the server
-	if dial, err := dialer.DialContext(timeout, c.network, c.host+":"+fmt.Sprintf("%d", c.port)); err != nil {
+	if dial, err := c.dial(timeout, dialer); err != nil {
 		// Return error if connection fails
 		return c.error(
 			fmt.Sprintf("Connection to %s:%d,error", c.host, c.port),
@@ -289,7 +309,37 @@ func (c *Client) doConnection() error {
 		return err
 	}
 	// Store the smux session
-	c.session = session
+	c.session = &smuxSession{Session: session}
+	c.cct.state <- OpenSession
+	threading.GoSafe(func() {
+		c.sessionLoop()
+	})
+	return nil
+}
+
+// doQuicConnection opens the tunnel session over QUIC instead of tcp and smux.
+func (c *Client) doQuicConnection() error {
+	var tlsConfig *tls.Config
+	if c.opts.Tls != nil {
+		tlsConfig = c.opts.Tls.Clone()
+	} else {
+		// Without a tls config the server uses a self-signed certificate: the
+		// session is encrypted but, as over plain tcp, the server isn't verified.
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConfig.NextProtos = []string{transport.QuicAlpn}
+	timeout, cancelFunc := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelFunc()
+	conn, err := quic.DialAddr(timeout, c.getAddress(), tlsConfig, transport.NewQuicConfig())
+	if err != nil {
+		return c.error(
+			fmt.Sprintf("Connection to %s:%d,error", c.host, c.port),
+			err,
+		)
+	}
+	log.Info("👍---->Open session[quic] %s success OK.✅", c.getAddress())
+	c.session = newQuicSession(conn)
+	c.cct.state <- Active
 	c.cct.state <- OpenSession
 	threading.GoSafe(func() {
 		c.sessionLoop()
@@ -304,6 +354,17 @@ func (c *Client) setTimeout(dial net.Conn) {
 }
 
 func (c *Client) OpenTunnel(config *configs.ClientTunnelConfig) error {
+	err := c.openTunnel(config)
+	if err != nil {
+		log.Error("Open tunnel error, close client:%v", config.TunnelType)
+		c.cct.Close()
+	}
+	return err
+}
+
+// openTunnel opens the tunnel on the session, the tunnel opened before with the same proxy
+// id is closed first. A failure leaves the other tunnels of the session alone.
+func (c *Client) openTunnel(config *configs.ClientTunnelConfig) error {
 	if !c.isSmux() {
 		return nil
 	}
@@ -313,13 +374,16 @@ func (c *Client) OpenTunnel(config *configs.ClientTunnelConfig) error {
 		log.Error("Not found [%s] tunnel client, Pleas check.", config.TunnelType)
 		return errors.New("not found tunnel client")
 	}
-	err := client.Open(c.session)
-	if err != nil {
-		log.Error("Open tunnel error, close client:%v", config.TunnelType)
-		c.cct.Close()
+	c.CloseTunnel(config.ProxyId)
+	c.tunnelClients.Store(config.ProxyId, client)
+	return client.Open(c.session)
+}
+
+// CloseTunnel closes the tunnel of the proxy id, the session stays open for the others.
+func (c *Client) CloseTunnel(proxyId string) {
+	if client, ok := c.tunnelClients.LoadAndDelete(proxyId); ok {
+		client.Close()
 	}
-	c.tunnelClient = client
-	return err
 }
 
 func (c *Client) error(str string, err error) error {
@@ -373,6 +437,10 @@ func (c *Client) isSmux() bool {
 	return c.opts.Smux != nil
 }
 
+func (c *Client) isQuic() bool {
+	return c.opts.Quic && c.isSmux()
+}
+
 // IsConnection checks if the client connection is active and in the correct state
 // This method is used to verify whether the client has an active connection
 //
@@ -383,7 +451,7 @@ func (c *Client) isSmux() bool {
 //   - bool: Returns true if connection exists and is in Active state, false otherwise
 func (c *Client) IsConnection() bool {
 	// Check if connection object is not nil and state is Active
-	return c.conn != nil && (c.state == Active || c.state == OpenSession)
+	return (c.conn != nil || c.session != nil) && (c.state == Active || c.state == OpenSession)
 }
 
 // handleLoop manages the client's connection lifecycle and event handling
@@ -398,9 +466,11 @@ func (c *Client) handleLoop() {
 		if c.session != nil {
 			_ = c.session.Close()
 		}
-		if c.tunnelClient != nil {
-			c.tunnelClient.Close()
-		}
+		c.tunnelClients.Range(func(proxyId string, client TunnelClient) bool {
+			client.Close()
+			return true
+		})
+		c.tunnelClients.Clear()
 		return nil
 	}
 	for {
@@ -17,6 +17,7 @@
 package clis
 
 import (
+	"crypto/tls"
 	"time"
 )
 
@@ -42,6 +43,12 @@ type cOptions struct {
 
 	Smux *SmuxClientOption
 
+	// Tls dial the server over TLS when it's not nil.
+	Tls *tls.Config
+
+	// Quic carries the smux streams on QUIC instead of tcp.
+	Quic bool
+
 	handlers []ClientHandler
 }
 
@@ -85,6 +92,18 @@ func WithKeepAlive(t time.Duration) ClientOption {
 	}
 }
 
+func WithTls(cfg *tls.Config) ClientOption {
+	return func(c *cOptions) {
+		c.Tls = cfg
+	}
+}
+
+func WithQuic(enable bool) ClientOption {
+	return func(c *cOptions) {
+		c.Quic = enable
+	}
+}
+
 func WithClientHandler(handler ...ClientHandler) ClientOption {
 	return func(c *cOptions) {
 		c.handlers = append(c.handlers, handler...)
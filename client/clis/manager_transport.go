@@ -17,11 +17,14 @@
 package clis
 
 import (
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/g-brook/brook/client/cli"
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/hash"
 )
 
 var ManagerTransport *managerTransport
@@ -32,6 +35,7 @@ type CmdNotify func(*exchange.Protocol) error
 func InitManagerTransport(transport *Transport) {
 	// Create a new ManagerTransport with the given transport
 	ManagerTransport = NewManagerTransport(transport)
+	transport.reconnect.OnNextRetry(cli.UpdateNextRetry)
 }
 
 type managerTransport struct {
@@ -40,7 +44,11 @@ type managerTransport struct {
 	tunnelTransport *Transport
 	commands        map[exchange.Cmd]CmdNotify
 	UnId            string
-	configs         map[string]*configs.ClientTunnelConfig
+	// SessionKey proves the requests of the tunnel connections are this client's.
+	SessionKey string
+	// P2pServer the udp address telling the public address, empty without p2p.
+	P2pServer string
+	configs   *hash.SyncMap[string, *configs.ClientTunnelConfig]
 }
 
 func (b *managerTransport) WithTunnelTransport(t *Transport) {
@@ -77,7 +85,7 @@ func NewManagerTransport(tr *Transport) *managerTransport {
 		// Set the transport field of the managerTransport object to the given Transport object
 		transport: tr,
 		commands:  make(map[exchange.Cmd]CmdNotify),
-		configs:   make(map[string]*configs.ClientTunnelConfig),
+		configs:   hash.NewSyncMap[string, *configs.ClientTunnelConfig](),
 	}
 	// Return the new managerTransport object
 	return transport
@@ -100,15 +108,31 @@ func (b *managerTransport) SyncWrite(message exchange.InBound, timeout time.Dura
 }
 
 func (b *managerTransport) GetConfig(proxyId string) *configs.ClientTunnelConfig {
-	return b.configs[proxyId]
+	config, _ := b.configs.Load(proxyId)
+	return config
 }
 
 func (b *managerTransport) PutConfig(config *configs.ClientTunnelConfig) {
-	b.configs[config.ProxyId] = config
+	b.configs.Store(config.ProxyId, config)
 }
 
-func (b *managerTransport) BindUnId(unId string) {
+// RemoveConfig stops serving the work connections of the proxy id.
+func (b *managerTransport) RemoveConfig(proxyId string) {
+	b.configs.Delete(proxyId)
+}
+
+func (b *managerTransport) BindUnId(unId string, sessionKey string) {
 	b.UnId = unId
+	b.SessionKey = sessionKey
+}
+
+// BindP2pServer binds the p2p port of the server logged in, 0 disables p2p.
+func (b *managerTransport) BindP2pServer(host string, port int) {
+	if port == 0 {
+		b.P2pServer = ""
+		return
+	}
+	b.P2pServer = net.JoinHostPort(host, strconv.Itoa(port))
 }
 
 func (b *managerTransport) AddMessageNotify(cmd exchange.Cmd, notify CmdNotify) {
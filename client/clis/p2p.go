@@ -0,0 +1,444 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package clis
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/iox"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/proxyproto"
+	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/tlsx"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// p2pAlpn the protocol of the QUIC connections between the peers.
+	p2pAlpn = "brook-p2p"
+
+	// p2pTimeout bounds the punching and the handshake with the peer.
+	p2pTimeout = 10 * time.Second
+
+	// p2pRelayTime how long a visitor uses the relay after p2p failed.
+	p2pRelayTime = time.Minute
+)
+
+// errP2pRelay p2p failed a moment ago, the relay is used without trying again.
+var errP2pRelay = errors.New("p2p failed recently")
+
+// p2pCertificate the certificate of the QUIC listener of the serving client, the visitor
+// pins it by the hash the server relayed, and is authenticated by the session id.
+var p2pCertificate = sync.OnceValues(tlsx.NewSelfSignedCertificate)
+
+// p2pCertHash returns the SHA-256 of the certificate in hex.
+func p2pCertHash(cert []byte) string {
+	sum := sha256.Sum256(cert)
+	return hex.EncodeToString(sum[:])
+}
+
+// p2pClientTls returns the tls config of the visitor, it only accepts the certificate of
+// the hash the serving client sent through the server.
+func p2pClientTls(certHash string) *tls.Config {
+	return &tls.Config{
+		//The certificate is self-signed, it is pinned instead of verified.
+		InsecureSkipVerify: true,
+		NextProtos:         []string{p2pAlpn},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("the p2p peer has no certificate")
+			}
+			if subtle.ConstantTimeCompare([]byte(p2pCertHash(rawCerts[0])), []byte(certHash)) != 1 {
+				return errors.New("the certificate of the p2p peer is not the one of the serving client")
+			}
+			return nil
+		},
+	}
+}
+
+// p2pServerTls returns the tls config of the QUIC listener of the serving client.
+func p2pServerTls(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{p2pAlpn},
+	}
+}
+
+// p2pSocket is the udp socket a peer punches through, QUIC runs on it afterwards.
+type p2pSocket struct {
+	conn *net.UDPConn
+	tr   *quic.Transport
+	// addr the public address of the socket seen by the server.
+	addr string
+}
+
+// newP2pSocket opens a udp socket and learns its public address from the server.
+func newP2pSocket() (*p2pSocket, error) {
+	server := ManagerTransport.P2pServer
+	if server == "" {
+		return nil, errors.New("p2p is disabled on the server")
+	}
+	serverAddr, err := net.ResolveUDPAddr(string(lang.NetworkUdp), server)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(string(lang.NetworkUdp), nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &p2pSocket{conn: conn, tr: &quic.Transport{Conn: conn}}
+	if s.addr, err = s.probe(serverAddr); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// probe asks the server for the public address, a lost datagram is sent again.
+func (s *p2pSocket) probe(server net.Addr) (string, error) {
+	buf := make([]byte, 128)
+	for i := 0; i < 3; i++ {
+		if _, err := s.tr.WriteTo([]byte(exchange.P2pProbe), server); err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		addr, err := s.readProbe(ctx, buf)
+		cancel()
+		if err == nil {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("probe p2p server %v timeout", server)
+}
+
+func (s *p2pSocket) readProbe(ctx context.Context, buf []byte) (string, error) {
+	for {
+		n, _, err := s.tr.ReadNonQUICPacket(ctx, buf)
+		if err != nil {
+			return "", err
+		}
+		if addr, ok := strings.CutPrefix(string(buf[:n]), exchange.P2pProbe); ok {
+			return addr, nil
+		}
+	}
+}
+
+// punch sends datagrams to the peer until ctx is done, they open the NAT mapping toward
+// it so the datagrams of the peer get in.
+func (s *p2pSocket) punch(ctx context.Context, peer net.Addr) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		_, _ = s.tr.WriteTo([]byte(exchange.P2pPunch), peer)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *p2pSocket) Close() error {
+	_ = s.tr.Close()
+	return s.conn.Close()
+}
+
+func newP2pQuicConfig() *quic.Config {
+	conf := transport.NewQuicConfig()
+	conf.HandshakeIdleTimeout = p2pTimeout
+	return conf
+}
+
+// OnP2pOffer answers the offer of a visitor with the public address, then waits for the
+// visitor to connect and serves its streams.
+func OnP2pOffer(r *exchange.Protocol) error {
+	offer, err := exchange.Parse[exchange.P2pOfferReq](r.Data)
+	if err != nil {
+		log.Error("Parse P2pOfferReq error: %v", err)
+		return err
+	}
+	threading.GoSafe(func() {
+		serveP2pOffer(offer)
+	})
+	return nil
+}
+
+func serveP2pOffer(offer *exchange.P2pOfferReq) {
+	sock, ln, err := listenP2p(offer.ProxyId)
+	answer := &exchange.P2pAnswerReq{Sid: offer.Sid}
+	if err != nil {
+		answer.Error = err.Error()
+	} else {
+		cert, _ := p2pCertificate()
+		answer.Addr = sock.addr
+		answer.CertHash = p2pCertHash(cert.Certificate[0])
+	}
+	if _, werr := ManagerTransport.SyncWrite(answer, 5*time.Second); err == nil {
+		err = werr
+	}
+	if err != nil {
+		log.Warn("P2p offer of tunnel %s error: %v", offer.ProxyId, err)
+		if sock != nil {
+			_ = sock.Close()
+		}
+		return
+	}
+	defer sock.Close()
+	conn, err := sock.accept(ln, offer)
+	if err != nil {
+		log.Warn("P2p visitor %s of tunnel %s error: %v", offer.PeerAddr, offer.ProxyId, err)
+		return
+	}
+	log.Info("P2p visitor %v connected to tunnel %s", conn.RemoteAddr(), offer.ProxyId)
+	serveP2pConn(conn, offer.ProxyId)
+}
+
+// listenP2p opens the socket the visitor connects to.
+func listenP2p(proxyId string) (*p2pSocket, *quic.Listener, error) {
+	if ManagerTransport.GetConfig(proxyId) == nil {
+		return nil, nil, fmt.Errorf("tunnel %s is not served", proxyId)
+	}
+	cert, err := p2pCertificate()
+	if err != nil {
+		return nil, nil, err
+	}
+	sock, err := newP2pSocket()
+	if err != nil {
+		return nil, nil, err
+	}
+	ln, err := sock.tr.Listen(p2pServerTls(cert), newP2pQuicConfig())
+	if err != nil {
+		_ = sock.Close()
+		return nil, nil, err
+	}
+	return sock, ln, nil
+}
+
+// accept punches toward the visitor until it connects and proves the session id on its
+// first stream. Only that connection is accepted.
+func (s *p2pSocket) accept(ln *quic.Listener, offer *exchange.P2pOfferReq) (*quic.Conn, error) {
+	defer ln.Close()
+	peer, err := net.ResolveUDPAddr(string(lang.NetworkUdp), offer.PeerAddr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p2pTimeout)
+	defer cancel()
+	threading.GoSafe(func() {
+		s.punch(ctx, peer)
+	})
+	conn, err := ln.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = readSid(ctx, conn, offer.Sid); err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+	return conn, nil
+}
+
+func readSid(ctx context.Context, conn *quic.Conn, sid string) error {
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer transport.NewQuicStream(stream, conn).Close()
+	_ = stream.SetReadDeadline(time.Now().Add(p2pTimeout))
+	buf := make([]byte, len(sid))
+	if _, err = io.ReadFull(stream, buf); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(buf, []byte(sid)) != 1 {
+		return errors.New("the session id is wrong")
+	}
+	return nil
+}
+
+// serveP2pConn connects each stream of the visitor to the destination of the tunnel.
+func serveP2pConn(conn *quic.Conn, proxyId string) {
+	defer conn.CloseWithError(0, "")
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			log.Debug("P2p visitor %v of tunnel %s closed: %v", conn.RemoteAddr(), proxyId, err)
+			return
+		}
+		threading.GoSafe(func() {
+			serveP2pStream(transport.NewQuicStream(stream, conn), proxyId)
+		})
+	}
+}
+
+func serveP2pStream(stream net.Conn, proxyId string) {
+	cfg := ManagerTransport.GetConfig(proxyId)
+	if cfg == nil {
+		log.Warn("P2p tunnel %s is not served any more", proxyId)
+		_ = stream.Close()
+		return
+	}
+	dest, err := net.DialTimeout(string(lang.NetworkTcp), cfg.Destination, 5*time.Second)
+	if err != nil {
+		log.Warn("P2p tunnel %s dial %s error: %v", proxyId, cfg.Destination, err)
+		_ = stream.Close()
+		return
+	}
+	if cfg.ProxyProtocol != "" {
+		if err = writeP2pProxyHeader(dest, cfg.ProxyProtocol, stream); err != nil {
+			log.Warn("P2p tunnel %s PROXY protocol header error: %v", proxyId, err)
+			_ = dest.Close()
+			_ = stream.Close()
+			return
+		}
+	}
+	errs := iox.Pipe(stream, CountConn(dest, proxyId))
+	log.Debug("P2p stream of tunnel %s closed %v", proxyId, errs)
+}
+
+// writeP2pProxyHeader tells the destination the address of the visitor client, the
+// stream carries a tcp connection though it comes over udp.
+func writeP2pProxyHeader(dest net.Conn, version string, stream net.Conn) error {
+	header, err := proxyproto.Append(nil, version, streamAddr(stream.RemoteAddr()), streamAddr(stream.LocalAddr()))
+	if err != nil {
+		return err
+	}
+	_, err = dest.Write(header)
+	return err
+}
+
+func streamAddr(addr net.Addr) net.Addr {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: u.IP, Port: u.Port, Zone: u.Zone}
+	}
+	return addr
+}
+
+// openP2pStream opens a stream on the p2p connection to the serving client, connecting
+// first when there is none. After a failed connect the relay is used for a while.
+func (v *Visitor) openP2pStream() (transport.Stream, error) {
+	v.p2pLock.Lock()
+	defer v.p2pLock.Unlock()
+	if v.p2p == nil || v.p2p.IsClosed() {
+		if time.Now().Before(v.relayUntil) {
+			return nil, errP2pRelay
+		}
+		session, err := v.connectP2p()
+		if err != nil {
+			v.relayUntil = time.Now().Add(p2pRelayTime)
+			return nil, err
+		}
+		v.p2p = session
+	}
+	return v.p2p.OpenStream()
+}
+
+func (v *Visitor) connectP2p() (*quicSession, error) {
+	sock, err := newP2pSocket()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := v.dialP2p(sock)
+	if err != nil {
+		_ = sock.Close()
+		return nil, err
+	}
+	threading.GoSafe(func() {
+		<-conn.Context().Done()
+		_ = sock.Close()
+	})
+	log.Info("Visitor of tunnel %s connected p2p to %v", v.cfg.ProxyId, conn.RemoteAddr())
+	return newQuicSession(conn), nil
+}
+
+// dialP2p asks the server for the address of the serving client, then punches toward it
+// and connects.
+func (v *Visitor) dialP2p(sock *p2pSocket) (*quic.Conn, error) {
+	rsp, err := v.p2pVisit(sock.addr)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.CertHash == "" {
+		return nil, errors.New("the serving client sent no certificate hash, it needs to be upgraded for p2p")
+	}
+	peer, err := net.ResolveUDPAddr(string(lang.NetworkUdp), rsp.PeerAddr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p2pTimeout)
+	defer cancel()
+	threading.GoSafe(func() {
+		sock.punch(ctx, peer)
+	})
+	conn, err := sock.tr.Dial(ctx, peer, p2pClientTls(rsp.CertHash), newP2pQuicConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err = writeSid(ctx, conn, rsp.Sid); err != nil {
+		_ = conn.CloseWithError(0, "")
+		return nil, err
+	}
+	return conn, nil
+}
+
+func writeSid(ctx context.Context, conn *quic.Conn, sid string) error {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err = stream.Write([]byte(sid)); err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
+// p2pVisit tells the server the public address of the visitor and gets the one of the
+// serving client.
+func (v *Visitor) p2pVisit(addr string) (*exchange.P2pVisitResp, error) {
+	if !v.transport.isConnected() {
+		return nil, errors.New("tunnel transport is not connected")
+	}
+	stream, err := v.transport.client.session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	rsp, err := request(stream, &exchange.P2pVisitReq{
+		ProxyId:    v.cfg.ProxyId,
+		Secret:     v.cfg.Secret,
+		UnId:       ManagerTransport.UnId,
+		Addr:       addr,
+		SessionKey: ManagerTransport.SessionKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exchange.Parse[exchange.P2pVisitResp](rsp.Data)
+}
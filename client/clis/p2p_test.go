@@ -0,0 +1,172 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/proxyproto"
+	"github.com/g-brook/brook/common/tlsx"
+	"github.com/quic-go/quic-go"
+)
+
+func listenTestP2p(t *testing.T) (*quic.Listener, string) {
+	cert, err := p2pCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &quic.Transport{Conn: conn}
+	t.Cleanup(func() {
+		_ = tr.Close()
+		_ = conn.Close()
+	})
+	ln, err := tr.Listen(p2pServerTls(cert), newP2pQuicConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln, p2pCertHash(cert.Certificate[0])
+}
+
+func dialTestP2p(t *testing.T, ln *quic.Listener, certHash string) (*quic.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return quic.DialAddr(ctx, ln.Addr().String(), p2pClientTls(certHash), newP2pQuicConfig())
+}
+
+func TestP2pPinnedCertificate(t *testing.T) {
+	ln, certHash := listenTestP2p(t)
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = readSid(context.Background(), conn, "sid1")
+			}()
+		}
+	}()
+	conn, err := dialTestP2p(t, ln, certHash)
+	if err != nil {
+		t.Fatalf("dial the pinned peer: %v", err)
+	}
+	_ = conn.CloseWithError(0, "")
+	other, err := tlsx.NewSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err = dialTestP2p(t, ln, p2pCertHash(other.Certificate[0])); err == nil {
+		_ = conn.CloseWithError(0, "")
+		t.Fatal("dialed a peer with another certificate")
+	}
+	if conn, err = dialTestP2p(t, ln, ""); err == nil {
+		_ = conn.CloseWithError(0, "")
+		t.Fatal("dialed a peer without a pinned certificate")
+	}
+}
+
+func TestP2pSessionId(t *testing.T) {
+	ln, certHash := listenTestP2p(t)
+	for _, tt := range []struct {
+		sid  string
+		want bool
+	}{{"sid1", true}, {"sid2", false}} {
+		accepted := make(chan error, 1)
+		go func() {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				accepted <- err
+				return
+			}
+			accepted <- readSid(context.Background(), conn, "sid1")
+		}()
+		conn, err := dialTestP2p(t, ln, certHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writeSid(context.Background(), conn, tt.sid); err != nil {
+			t.Fatal(err)
+		}
+		if err = <-accepted; (err == nil) != tt.want {
+			t.Fatalf("session id %s accepted: %v", tt.sid, err)
+		}
+		_ = conn.CloseWithError(0, "")
+	}
+}
+
+// addrConn is a conn with the addresses of a p2p stream.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func TestServeP2pStreamProxyProtocol(t *testing.T) {
+	dest, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dest.Close()
+	old := ManagerTransport
+	ManagerTransport = NewManagerTransport(NewTransport(&configs.ClientConfig{ServerHost: "127.0.0.1", ServerPort: 1}))
+	defer func() {
+		ManagerTransport = old
+	}()
+	ManagerTransport.PutConfig(&configs.ClientTunnelConfig{ProxyId: "p1", Destination: dest.Addr().String(), ProxyProtocol: proxyproto.V1})
+	visitor, stream := net.Pipe()
+	defer visitor.Close()
+	go serveP2pStream(&addrConn{
+		Conn:   stream,
+		local:  &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4000},
+		remote: &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 5000},
+	}, "p1")
+	conn, err := dest.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	h, err := proxyproto.Read(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Src.String() != "203.0.113.7:5000" || h.Dst.String() != "10.0.0.2:4000" {
+		t.Fatalf("PROXY header %v -> %v", h.Src, h.Dst)
+	}
+	go func() {
+		_, _ = visitor.Write([]byte("ping"))
+	}()
+	buf := make([]byte, 4)
+	if _, err = conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q: %v", buf, err)
+	}
+}
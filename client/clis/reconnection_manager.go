@@ -17,52 +17,112 @@
 package clis
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/g-brook/brook/common/backoff"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
 )
 
+// reconnectPolicy the policy of the reconnections and the tunnel stream retries.
+var reconnectPolicy = backoff.DefaultPolicy()
+
+// SetReconnectPolicy sets the policy of the reconnections and the tunnel stream retries.
+func SetReconnectPolicy(p backoff.Policy) {
+	reconnectPolicy = p
+}
+
 type ReconnectFunction func() bool
+
+// NextRetryFunction is notified of the time of the next attempt, zero when the reconnection
+// stops.
+type NextRetryFunction func(next time.Time)
+
 type ReconnectManager struct {
-	timer             *time.Timer
-	reconnectInterval time.Duration
-	retries           int
-	isStart           bool
-	lock              sync.Mutex
+	timer     *time.Timer
+	backoff   *backoff.Backoff
+	isStart   bool
+	lock      sync.Mutex
+	nextRetry NextRetryFunction
+	giveUp    func(err error)
 }
 
-func NewReconnectionManager(t time.Duration) *ReconnectManager {
+func NewReconnectionManager(p backoff.Policy) *ReconnectManager {
 	return &ReconnectManager{
-		timer:             time.NewTimer(t),
-		reconnectInterval: t,
+		timer:   time.NewTimer(p.InitialDelay),
+		backoff: p.NewBackoff(),
 	}
 }
 
+// OnNextRetry sets the function notified of the time of the next attempt.
+func (r *ReconnectManager) OnNextRetry(f NextRetryFunction) {
+	r.nextRetry = f
+}
+
+// OnGiveUp sets the function called when the attempts are exhausted, the reconnection
+// doesn't start again by itself.
+func (r *ReconnectManager) OnGiveUp(f func(err error)) {
+	r.giveUp = f
+}
+
 func (r *ReconnectManager) TryReconnect(rf ReconnectFunction) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	if r.isStart {
 		return
 	}
+	if !r.schedule() {
+		return
+	}
 	r.isStart = true
-	r.timer.Reset(r.reconnectInterval)
 	threading.GoSafe(func() {
 		for {
-			select {
-			case <-r.timer.C:
-				r.retries++
-				log.Info("Try reconnect %v count, now.", r.retries)
-				b := rf()
-				if b {
-					r.isStart = false
-					r.retries = 0
-					return
-				}
-				r.timer.Reset(r.reconnectInterval)
+			<-r.timer.C
+			log.Info("Try reconnect %v count, now.", r.backoff.Attempts())
+			b := rf()
+			r.lock.Lock()
+			if b {
+				r.isStart = false
+				r.backoff.Reset()
+				r.notify(time.Time{})
+				r.lock.Unlock()
+				return
 			}
-
+			if !r.schedule() {
+				r.isStart = false
+				r.lock.Unlock()
+				return
+			}
+			r.lock.Unlock()
 		}
 	})
 }
+
+// schedule sets the timer to the next attempt, false when the attempts are exhausted.
+func (r *ReconnectManager) schedule() bool {
+	delay, ok := r.backoff.Next()
+	if !ok {
+		err := fmt.Errorf("reconnect failed %v times, give up", r.backoff.Attempts())
+		log.Error("%v.", err)
+		r.backoff.Reset()
+		r.notify(time.Time{})
+		if r.giveUp != nil {
+			threading.GoSafe(func() {
+				r.giveUp(err)
+			})
+		}
+		return false
+	}
+	log.Info("Reconnect in %v.", delay.Round(time.Millisecond))
+	r.timer.Reset(delay)
+	r.notify(time.Now().Add(delay))
+	return true
+}
+
+func (r *ReconnectManager) notify(next time.Time) {
+	if r.nextRetry != nil {
+		r.nextRetry(next)
+	}
+}
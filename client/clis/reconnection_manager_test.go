@@ -0,0 +1,51 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/backoff"
+)
+
+func TestReconnectManagerGivesUp(t *testing.T) {
+	r := NewReconnectionManager(backoff.Policy{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		Multiplier:   1,
+		MaxAttempts:  3,
+	})
+	gaveUp := make(chan error, 1)
+	r.OnGiveUp(func(err error) {
+		gaveUp <- err
+	})
+	var attempts atomic.Int32
+	r.TryReconnect(func() bool {
+		attempts.Add(1)
+		return false
+	})
+	select {
+	case err := <-gaveUp:
+		if err == nil || attempts.Load() != 3 {
+			t.Fatalf("gave up after %d attempts: %v", attempts.Load(), err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnect didn't give up")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package clis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/loadbalance"
+)
+
+// rejectCooldown keeps a server that rejected the login out of the fail-back for a while.
+const rejectCooldown = 5 * time.Minute
+
+// ServerEndpoints selects the server of the client among the configured servers.
+//
+// With the priority strategy the client connects to the preferred server that is reachable,
+// starts from the top again after losing the connection and fails back once a preferred
+// server returns. With the roundRobin strategy it moves on to the next server after each
+// failure and stays where it is.
+type ServerEndpoints struct {
+	lock       sync.Mutex
+	endpoints  []configs.ServerEndpoint
+	roundRobin bool
+	current    int
+	// failedOver is set when the current server was left on purpose, so losing the
+	// connection doesn't go back to the top.
+	failedOver bool
+	downUntil  []time.Time
+}
+
+func NewServerEndpoints(cfg *configs.ClientConfig) *ServerEndpoints {
+	endpoints := cfg.ServerEndpoints()
+	return &ServerEndpoints{
+		endpoints:  endpoints,
+		roundRobin: cfg.ServerStrategy == string(loadbalance.StrategyRoundRobin),
+		downUntil:  make([]time.Time, len(endpoints)),
+	}
+}
+
+// Current returns the server to connect to.
+func (s *ServerEndpoints) Current() configs.ServerEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.endpoints[s.current]
+}
+
+// Len returns the count of the servers.
+func (s *ServerEndpoints) Len() int {
+	return len(s.endpoints)
+}
+
+// IsPreferred reports whether the current server is the first of the list.
+func (s *ServerEndpoints) IsPreferred() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current == 0
+}
+
+// Next moves on to the next server after failing to connect to the current one.
+func (s *ServerEndpoints) Next() configs.ServerEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = (s.current + 1) % len(s.endpoints)
+	return s.endpoints[s.current]
+}
+
+// Reject moves on to the next server, the current one rejected the login.
+func (s *ServerEndpoints) Reject() configs.ServerEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.downUntil[s.current] = time.Now().Add(rejectCooldown)
+	s.current = (s.current + 1) % len(s.endpoints)
+	s.failedOver = true
+	return s.endpoints[s.current]
+}
+
+// FailBack moves back to the preferred server at the index, it's reachable again.
+func (s *ServerEndpoints) FailBack(index int) configs.ServerEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = index
+	s.failedOver = true
+	return s.endpoints[s.current]
+}
+
+// Lost is called when the connection to the current server is lost, with the priority
+// strategy the next connection starts from the preferred server.
+func (s *ServerEndpoints) Lost() configs.ServerEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.failedOver && !s.roundRobin {
+		s.current = 0
+	}
+	s.failedOver = false
+	return s.endpoints[s.current]
+}
+
+// Preferred returns the indexes of the servers preferred to the current one that may be
+// failed back to, best first, only with the priority strategy.
+func (s *ServerEndpoints) Preferred() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.roundRobin {
+		return nil
+	}
+	var preferred []int
+	now := time.Now()
+	for i := 0; i < s.current; i++ {
+		if now.After(s.downUntil[i]) {
+			preferred = append(preferred, i)
+		}
+	}
+	return preferred
+}
+
+// Endpoint returns the server at the index.
+func (s *ServerEndpoints) Endpoint(index int) configs.ServerEndpoint {
+	return s.endpoints[index]
+}
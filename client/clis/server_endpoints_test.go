@@ -0,0 +1,145 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+func testEndpoints(strategy string) *ServerEndpoints {
+	return NewServerEndpoints(&configs.ClientConfig{
+		ServerStrategy: strategy,
+		Servers: []*configs.ServerEndpoint{
+			{Host: "c", Port: 3, Priority: 3},
+			nil,
+			{Host: "a", Port: 1, Priority: 1},
+			{Host: "b", Port: 2, Priority: 2},
+		},
+	})
+}
+
+func TestServerEndpointsOrder(t *testing.T) {
+	s := testEndpoints("")
+	if s.Len() != 3 {
+		t.Fatalf("the empty entry is not skipped: %d servers", s.Len())
+	}
+	for i, host := range []string{"a", "b", "c"} {
+		if got := s.Endpoint(i).Host; got != host {
+			t.Fatalf("server %d is %s, want %s", i, got, host)
+		}
+	}
+	if got := s.Current().Host; got != "a" || !s.IsPreferred() {
+		t.Fatalf("current server is %s, want the preferred a", got)
+	}
+	single := NewServerEndpoints(&configs.ClientConfig{ServerHost: "h", ServerPort: 9, Servers: []*configs.ServerEndpoint{nil}})
+	if single.Len() != 1 || single.Current().String() != "h:9" {
+		t.Fatalf("servers of empty entries: %v", single.endpoints)
+	}
+}
+
+func TestServerEndpointsPriority(t *testing.T) {
+	s := testEndpoints("priority")
+	if got := s.Next().Host; got != "b" {
+		t.Fatalf("next server is %s, want b", got)
+	}
+	if got := s.Preferred(); !slices.Equal(got, []int{0}) {
+		t.Fatalf("preferred servers are %v, want [0]", got)
+	}
+	// Losing the connection starts from the preferred server again.
+	if got := s.Lost().Host; got != "a" {
+		t.Fatalf("server after lost is %s, want a", got)
+	}
+	if got := s.Preferred(); len(got) != 0 {
+		t.Fatalf("preferred servers of the preferred one are %v", got)
+	}
+}
+
+func TestServerEndpointsReject(t *testing.T) {
+	s := testEndpoints("priority")
+	if got := s.Reject().Host; got != "b" {
+		t.Fatalf("server after reject is %s, want b", got)
+	}
+	// The rejected server is not failed back to while it cools down.
+	if got := s.Preferred(); len(got) != 0 {
+		t.Fatalf("preferred servers are %v, the rejected one cools down", got)
+	}
+	// Losing the connection after leaving on purpose stays on the new server once.
+	if got := s.Lost().Host; got != "b" {
+		t.Fatalf("server after the failover lost is %s, want b", got)
+	}
+	if got := s.Lost().Host; got != "a" {
+		t.Fatalf("server after lost is %s, want a", got)
+	}
+	s.downUntil[0] = time.Now().Add(-time.Second)
+	s.Next()
+	s.Next()
+	if got := s.Preferred(); !slices.Equal(got, []int{0, 1}) {
+		t.Fatalf("preferred servers are %v, want [0 1]", got)
+	}
+}
+
+func TestServerEndpointsFailBack(t *testing.T) {
+	s := testEndpoints("priority")
+	s.Next()
+	s.Next()
+	if got := s.FailBack(1).Host; got != "b" {
+		t.Fatalf("server after fail back is %s, want b", got)
+	}
+	if got := s.Lost().Host; got != "b" {
+		t.Fatalf("server after the fail back lost is %s, want b", got)
+	}
+	if got := s.Preferred(); !slices.Equal(got, []int{0}) {
+		t.Fatalf("preferred servers are %v, want [0]", got)
+	}
+}
+
+func TestServerEndpointsRoundRobin(t *testing.T) {
+	s := testEndpoints("roundRobin")
+	for _, host := range []string{"b", "c", "a"} {
+		if got := s.Next().Host; got != host {
+			t.Fatalf("next server is %s, want %s", got, host)
+		}
+	}
+	s.Next()
+	if got := s.Lost().Host; got != "b" {
+		t.Fatalf("server after lost is %s, round robin stays on b", got)
+	}
+	if got := s.Preferred(); got != nil {
+		t.Fatalf("round robin fails back to %v", got)
+	}
+}
+
+func TestTransportShutdownStopsFailBack(t *testing.T) {
+	tp := NewTransport(&configs.ClientConfig{Servers: []*configs.ServerEndpoint{
+		{Host: "127.0.0.1", Port: 1}, {Host: "127.0.0.1", Port: 2, Priority: 1},
+	}})
+	done := make(chan struct{})
+	go func() {
+		tp.failBack()
+		close(done)
+	}()
+	tp.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fail back is still running after shutdown")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/g-brook/brook/common/transport"
+	"github.com/quic-go/quic-go"
+	"github.com/xtaci/smux"
+)
+
+// Session is the multiplexed carrier of the tunnel streams, smux over tcp or QUIC.
+type Session interface {
+	OpenStream() (transport.Stream, error)
+
+	IsClosed() bool
+
+	Close() error
+
+	CloseChan() <-chan struct{}
+
+	LocalAddr() net.Addr
+
+	RemoteAddr() net.Addr
+}
+
+type smuxSession struct {
+	*smux.Session
+}
+
+func (s *smuxSession) OpenStream() (transport.Stream, error) {
+	stream, err := s.Session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// quicSession opens every stream on one QUIC connection, so a lost packet
+// only stalls its own stream.
+type quicSession struct {
+	conn *quic.Conn
+}
+
+func newQuicSession(conn *quic.Conn) *quicSession {
+	return &quicSession{conn: conn}
+}
+
+func (q *quicSession) OpenStream() (transport.Stream, error) {
+	ctx, cancelFunc := context.WithTimeout(q.conn.Context(), 5*time.Second)
+	defer cancelFunc()
+	stream, err := q.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return transport.NewQuicStream(stream, q.conn), nil
+}
+
+func (q *quicSession) IsClosed() bool {
+	return q.conn.Context().Err() != nil
+}
+
+func (q *quicSession) Close() error {
+	return q.conn.CloseWithError(0, "")
+}
+
+func (q *quicSession) CloseChan() <-chan struct{} {
+	return q.conn.Context().Done()
+}
+
+func (q *quicSession) LocalAddr() net.Addr {
+	return q.conn.LocalAddr()
+}
+
+func (q *quicSession) RemoteAddr() net.Addr {
+	return q.conn.RemoteAddr()
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/g-brook/brook/common/hash"
+)
+
+// Traffic counts the bytes a tunnel moved to and from its destination.
+type Traffic struct {
+	// In is written to the destination, Out is read from it.
+	In          atomic.Int64
+	Out         atomic.Int64
+	Connections atomic.Int64
+}
+
+var traffics = hash.NewSyncMap[string, *Traffic]()
+
+// GetTraffic returns the traffic of the proxy id.
+func GetTraffic(proxyId string) *Traffic {
+	t, _ := traffics.LoadOrStore(proxyId, &Traffic{})
+	return t
+}
+
+// trafficConn counts the bytes of a connection to the destination.
+type trafficConn struct {
+	net.Conn
+	traffic *Traffic
+	closed  atomic.Bool
+}
+
+// CountConn counts the traffic of the destination connection to the proxy id.
+func CountConn(conn net.Conn, proxyId string) net.Conn {
+	t := GetTraffic(proxyId)
+	t.Connections.Add(1)
+	return &trafficConn{Conn: conn, traffic: t}
+}
+
+func (c *trafficConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.traffic.Out.Add(int64(n))
+	return n, err
+}
+
+func (c *trafficConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.traffic.In.Add(int64(n))
+	return n, err
+}
+
+func (c *trafficConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.traffic.Connections.Add(-1)
+	}
+	return c.Conn.Close()
+}
@@ -17,14 +17,24 @@
 package clis
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/g-brook/brook/client/cli"
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
 )
 
+// failBackInterval the interval of checking whether a preferred server is back.
+const failBackInterval = 30 * time.Second
+
 // Transport
 // @Description:Transport manages client and request tracking.
 type Transport struct {
@@ -39,6 +49,15 @@ type Transport struct {
 	config *configs.ClientConfig
 
 	reconnect *ReconnectManager
+
+	// endpoints the servers the transport fails over between.
+	endpoints *ServerEndpoints
+
+	// ctx is done once the transport is shut down.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	tunnelsLock sync.Mutex
 }
 
 // NewTransport
@@ -48,11 +67,17 @@ type Transport struct {
 //	@return Transport
 func NewTransport(config *configs.ClientConfig) *Transport {
 	//start reconnection.
+	endpoints := NewServerEndpoints(config)
+	current := endpoints.Current()
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Transport{
-		host:      config.ServerHost,
-		port:      config.ServerPort,
+		host:      current.Host,
+		port:      current.Port,
 		config:    config,
-		reconnect: NewReconnectionManager(time.Second * 5),
+		reconnect: NewReconnectionManager(reconnectPolicy),
+		endpoints: endpoints,
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 }
 
@@ -72,11 +97,113 @@ func (t *Transport) Connection(opts ...ClientOption) {
 	if err != nil {
 		// If connection fails, log a warning and add this transport to a checking list for reconnection
 		log.Warn("Connection to server error:%s", err)
+		t.nextEndpoint()
 		addChecking(t)
 	} else {
 		// If connection is successful, open a tunnel for data transmission
 		t.openTunnel()
 	}
+	if t.CanFailover() {
+		threading.GoSafe(t.failBack)
+	}
+}
+
+// Address returns the server address of the transport.
+func (t *Transport) Address() (string, int) {
+	return t.host, t.port
+}
+
+// MoveTo connects the transport to another address, the connection is closed and
+// reconnected when the address changed.
+func (t *Transport) MoveTo(host string, port int) {
+	if t.host == host && t.port == port {
+		return
+	}
+	log.Info("Move the connection from %s:%d to %s:%d", t.host, t.port, host, port)
+	t.setAddress(host, port)
+	if t.client.IsConnection() {
+		t.Close()
+	}
+}
+
+// CanFailover reports whether there are other servers to fail over to.
+func (t *Transport) CanFailover() bool {
+	return t.endpoints.Len() > 1
+}
+
+// Failover leaves the current server, it rejected the login.
+func (t *Transport) Failover() {
+	if !t.CanFailover() {
+		return
+	}
+	ep := t.endpoints.Reject()
+	log.Warn("Server %s:%d rejected the client, fail over to %s", t.host, t.port, ep)
+	t.switchTo(ep)
+	t.client.cct.Close()
+}
+
+// nextEndpoint moves on to the next server after failing to connect.
+func (t *Transport) nextEndpoint() {
+	if !t.CanFailover() {
+		return
+	}
+	ep := t.endpoints.Next()
+	log.Warn("Server %s:%d is unreachable, fail over to %s", t.host, t.port, ep)
+	t.switchTo(ep)
+}
+
+// lost picks the server to reconnect to after losing the connection.
+func (t *Transport) lost() {
+	if !t.CanFailover() {
+		return
+	}
+	t.switchTo(t.endpoints.Lost())
+}
+
+// failBack moves back to a preferred server once it's reachable again, until the
+// transport is shut down.
+func (t *Transport) failBack() {
+	ticker := time.NewTicker(failBackInterval)
+	defer ticker.Stop()
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !t.client.IsConnection() {
+			continue
+		}
+		for _, index := range t.endpoints.Preferred() {
+			ep := t.endpoints.Endpoint(index)
+			conn, err := dialer.DialContext(t.ctx, "tcp", ep.String())
+			if err != nil {
+				continue
+			}
+			_ = conn.Close()
+			log.Info("Server %s is reachable again, fail back from %s:%d", ep, t.host, t.port)
+			t.switchTo(t.endpoints.FailBack(index))
+			t.client.cct.Close()
+			break
+		}
+	}
+}
+
+func (t *Transport) switchTo(ep configs.ServerEndpoint) {
+	t.setAddress(ep.Host, ep.Port)
+	address := ep.String()
+	if !t.endpoints.IsPreferred() {
+		address += " (backup)"
+	}
+	cli.UpdateRemoteAddress(address)
+}
+
+func (t *Transport) setAddress(host string, port int) {
+	t.host, t.port = host, port
+	if t.client != nil {
+		t.client.host, t.client.port = host, port
+	}
 }
 
 // Close closes the transport by closing the underlying client connection.
@@ -89,7 +216,22 @@ func (t *Transport) Close() {
 	}
 }
 
+// OnGiveUp sets the function called when the reconnection gave up.
+func (t *Transport) OnGiveUp(f func(err error)) {
+	t.reconnect.OnGiveUp(f)
+}
+
+// Shutdown closes the transport for good: it isn't reconnected and stops failing back.
+func (t *Transport) Shutdown() {
+	t.cancel()
+	if t.client != nil {
+		t.Close()
+	}
+}
+
 func (t *Transport) openTunnel() {
+	t.tunnelsLock.Lock()
+	defer t.tunnelsLock.Unlock()
 	if t.client.isSmux() && t.config.Tunnels != nil {
 		for _, cfg := range t.config.Tunnels {
 			if err := t.client.OpenTunnel(cfg); err != nil {
@@ -99,6 +241,116 @@ func (t *Transport) openTunnel() {
 	}
 }
 
+// UpdateTunnels replaces the tunnels of the transport. The added and changed tunnels are
+// opened at once when connected, otherwise on the next connection, and the removed ones
+// stop serving. The unchanged tunnels and their connections are left alone.
+func (t *Transport) UpdateTunnels(tunnels []*configs.ClientTunnelConfig) {
+	t.tunnelsLock.Lock()
+	defer t.tunnelsLock.Unlock()
+	opens, removed := diffTunnels(t.config.Tunnels, tunnels)
+	t.config.Tunnels = tunnels
+	for _, cfg := range opens {
+		log.Info("Tunnel %s:%s is updated", cfg.TunnelType, cfg.ProxyId)
+		if t.isConnected() {
+			if err := t.client.openTunnel(cfg); err != nil {
+				log.Warn("Open tunnel %s error: %v", cfg.ProxyId, err)
+			}
+		}
+	}
+	for _, proxyId := range removed {
+		log.Info("Tunnel %s is removed", proxyId)
+		t.closeTunnel(proxyId)
+	}
+}
+
+// diffTunnels returns the added and changed tunnels, which are opened, and the proxy ids of
+// the removed ones. An unchanged tunnel keeps the remote port and the network it was opened
+// with.
+func diffTunnels(olds, tunnels []*configs.ClientTunnelConfig) (opens []*configs.ClientTunnelConfig, removed []string) {
+	byId := make(map[string]*configs.ClientTunnelConfig, len(olds))
+	for _, cfg := range olds {
+		byId[cfg.ProxyId] = cfg
+	}
+	for _, cfg := range tunnels {
+		old, ok := byId[cfg.ProxyId]
+		delete(byId, cfg.ProxyId)
+		if ok && sameTunnel(old, cfg) {
+			cfg.RemotePort = old.RemotePort
+			cfg.Network = old.Network
+			continue
+		}
+		opens = append(opens, cfg)
+	}
+	for _, cfg := range olds {
+		if _, ok := byId[cfg.ProxyId]; ok {
+			removed = append(removed, cfg.ProxyId)
+		}
+	}
+	return opens, removed
+}
+
+// closeTunnel stops serving the tunnel of the proxy id, the server stops sending its user
+// connections to this client.
+func (t *Transport) closeTunnel(proxyId string) {
+	if t.client != nil {
+		t.client.CloseTunnel(proxyId)
+	}
+	if t.isConnected() {
+		req := &exchange.CloseTunnelReq{
+			ProxyId: proxyId,
+			UnId:    ManagerTransport.UnId,
+		}
+		if _, err := ManagerTransport.SyncWrite(req, 5*time.Second); err != nil {
+			log.Warn("Close tunnel %s error: %v", proxyId, err)
+		}
+	}
+	ManagerTransport.RemoveConfig(proxyId)
+}
+
+func (t *Transport) isConnected() bool {
+	return t.client != nil && t.client.IsConnection() && t.client.session != nil
+}
+
+// Tunnels returns the tunnels of the transport.
+func (t *Transport) Tunnels() []*configs.ClientTunnelConfig {
+	t.tunnelsLock.Lock()
+	defer t.tunnelsLock.Unlock()
+	return append([]*configs.ClientTunnelConfig(nil), t.config.Tunnels...)
+}
+
+// RestartTunnel closes the tunnel client of the proxy id and opens it again, the other
+// tunnels are left alone even when it fails.
+func (t *Transport) RestartTunnel(proxyId string) error {
+	t.tunnelsLock.Lock()
+	defer t.tunnelsLock.Unlock()
+	var cfg *configs.ClientTunnelConfig
+	for _, c := range t.config.Tunnels {
+		if c.ProxyId == proxyId {
+			cfg = c
+			break
+		}
+	}
+	if cfg == nil {
+		return fmt.Errorf("tunnel %s not found", proxyId)
+	}
+	if !t.isConnected() {
+		return errors.New("tunnel transport is not connected")
+	}
+	t.client.CloseTunnel(proxyId)
+	ManagerTransport.RemoveConfig(proxyId)
+	log.Info("Restart tunnel %s:%s", cfg.TunnelType, proxyId)
+	return t.client.openTunnel(cfg)
+}
+
+// sameTunnel compares two tunnel configs regardless of the remote port and the network the
+// server assigned.
+func sameTunnel(a, b *configs.ClientTunnelConfig) bool {
+	x, y := *a, *b
+	x.RemotePort, y.RemotePort = 0, 0
+	x.Network, y.Network = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
 func (t *Transport) SyncWrite(message exchange.InBound, timeout time.Duration) (*exchange.Protocol, error) {
 	return exchange.SyncWriteInBound(message, timeout, func(protocol *exchange.Protocol) error {
 		return t.client.cct.Write(protocol.Bytes())
@@ -118,6 +370,7 @@ type CheckHandler struct {
 }
 
 func (b *CheckHandler) Close(*ClientControl) {
+	b.transport.lost()
 	addChecking(b.transport)
 }
 
@@ -141,13 +394,20 @@ func (b *CheckHandler) Timeout(cct *ClientControl) {
 }
 
 func addChecking(tp *Transport) {
+	if tp.ctx.Err() != nil {
+		return
+	}
 	reconnect := func() bool {
+		if tp.ctx.Err() != nil {
+			return true
+		}
 		client := tp.client
 		if !client.IsConnection() {
 			log.Warn("Connection %s Not Active, start reconnection.", client.getAddress())
 			err := client.doConnection()
 			if err != nil {
 				log.Warn("Reconnection %s Fail, next time still running.", client.getAddress())
+				tp.nextEndpoint()
 			} else {
 				log.Info("👍<--Reconnection %s success OK.✅-->", client.getAddress())
 				tp.openTunnel()
@@ -0,0 +1,180 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clis
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/lang"
+)
+
+// testTunnelClient is an opened tunnel client that records its open and close.
+type testTunnelClient struct {
+	opened bool
+	closed bool
+}
+
+func (c *testTunnelClient) GetName() string       { return "test" }
+func (c *testTunnelClient) Done() <-chan struct{} { return nil }
+func (c *testTunnelClient) Close()                { c.closed = true }
+
+func (c *testTunnelClient) Open(Session) error {
+	c.opened = true
+	return nil
+}
+
+func tcpTunnel(proxyId, destination string) *configs.ClientTunnelConfig {
+	return &configs.ClientTunnelConfig{TunnelType: lang.Tcp, ProxyId: proxyId, Destination: destination}
+}
+
+func TestDiffTunnels(t *testing.T) {
+	kept := tcpTunnel("kept", "127.0.0.1:80")
+	kept.RemotePort = 9001
+	quic := &configs.ClientTunnelConfig{TunnelType: lang.Quic, ProxyId: "quic", Destination: "127.0.0.1:443",
+		RemotePort: 9002, Network: lang.NetworkUdp}
+	olds := []*configs.ClientTunnelConfig{kept, quic, tcpTunnel("changed", "127.0.0.1:80"), tcpTunnel("removed", "127.0.0.1:80")}
+
+	// The server pushes the tunnels without the remote port and network it assigned.
+	keptPush := tcpTunnel("kept", "127.0.0.1:80")
+	quicPush := &configs.ClientTunnelConfig{TunnelType: lang.Quic, ProxyId: "quic", Destination: "127.0.0.1:443"}
+	changed := tcpTunnel("changed", "127.0.0.1:81")
+	added := tcpTunnel("added", "127.0.0.1:80")
+	opens, removed := diffTunnels(olds, []*configs.ClientTunnelConfig{keptPush, quicPush, changed, added})
+
+	if len(opens) != 2 || opens[0] != changed || opens[1] != added {
+		t.Fatalf("opens %v, want the changed and the added tunnel", opens)
+	}
+	if !slices.Equal(removed, []string{"removed"}) {
+		t.Fatalf("removed %v, want [removed]", removed)
+	}
+	if keptPush.RemotePort != 9001 {
+		t.Fatalf("unchanged tunnel RemotePort = %d, want 9001", keptPush.RemotePort)
+	}
+	if quicPush.RemotePort != 9002 || quicPush.Network != lang.NetworkUdp {
+		t.Fatalf("unchanged quic tunnel = %d %s, want 9002 udp", quicPush.RemotePort, quicPush.Network)
+	}
+}
+
+func TestSameTunnel(t *testing.T) {
+	base := tcpTunnel("a", "127.0.0.1:80")
+	tests := []struct {
+		name   string
+		change func(cfg *configs.ClientTunnelConfig)
+		same   bool
+	}{
+		{"remote port", func(cfg *configs.ClientTunnelConfig) { cfg.RemotePort = 9000 }, true},
+		{"network", func(cfg *configs.ClientTunnelConfig) { cfg.Network = lang.NetworkUdp }, true},
+		{"destination", func(cfg *configs.ClientTunnelConfig) { cfg.Destination = "127.0.0.1:81" }, false},
+		{"type", func(cfg *configs.ClientTunnelConfig) { cfg.TunnelType = lang.Udp }, false},
+		{"weight", func(cfg *configs.ClientTunnelConfig) { cfg.Weight = 2 }, false},
+		{"http routes", func(cfg *configs.ClientTunnelConfig) { cfg.HttpIds = []string{"r"} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *base
+			tt.change(&cfg)
+			if got := sameTunnel(base, &cfg); got != tt.same {
+				t.Fatalf("sameTunnel = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+func TestUpdateTunnels(t *testing.T) {
+	kept := tcpTunnel("kept", "127.0.0.1:80")
+	kept.RemotePort = 9001
+	clients := map[string]*testTunnelClient{"kept": {}, "changed": {}, "removed": {}}
+	tr := &Transport{
+		config: &configs.ClientConfig{Tunnels: []*configs.ClientTunnelConfig{
+			kept, tcpTunnel("changed", "127.0.0.1:80"), tcpTunnel("removed", "127.0.0.1:80"),
+		}},
+		client: &Client{tunnelClients: hash.NewSyncMap[string, TunnelClient]()},
+	}
+	old := ManagerTransport
+	ManagerTransport = NewManagerTransport(tr)
+	t.Cleanup(func() { ManagerTransport = old })
+	for id, c := range clients {
+		tr.client.tunnelClients.Store(id, c)
+		ManagerTransport.PutConfig(tcpTunnel(id, "127.0.0.1:80"))
+	}
+	keptPush := tcpTunnel("kept", "127.0.0.1:80")
+	tr.UpdateTunnels([]*configs.ClientTunnelConfig{keptPush, tcpTunnel("changed", "127.0.0.1:81")})
+
+	if !clients["removed"].closed || ManagerTransport.GetConfig("removed") != nil {
+		t.Fatal("removed tunnel not closed")
+	}
+	if clients["kept"].closed {
+		t.Fatal("unchanged tunnel closed")
+	}
+	if _, ok := tr.client.tunnelClients.Load("kept"); !ok {
+		t.Fatal("unchanged tunnel client dropped")
+	}
+	if got := tr.Tunnels(); len(got) != 2 || got[0] != keptPush || got[0].RemotePort != 9001 {
+		t.Fatalf("tunnels %v, want the pushed ones with the kept remote port", got)
+	}
+}
+
+// testSession is the session of a connected client.
+type testSession struct {
+	Session
+}
+
+func TestUpdateTunnelsReopensChanged(t *testing.T) {
+	const testType = lang.TunnelType("test")
+	opened := map[string]*testTunnelClient{}
+	RegisterTunnelClient(testType, func(config *configs.ClientTunnelConfig) TunnelClient {
+		c := &testTunnelClient{}
+		opened[config.ProxyId] = c
+		return c
+	})
+	t.Cleanup(func() { delete(TunnelsClient, testType) })
+	tunnel := func(proxyId, destination string) *configs.ClientTunnelConfig {
+		return &configs.ClientTunnelConfig{TunnelType: testType, ProxyId: proxyId, Destination: destination}
+	}
+	kept, changed := &testTunnelClient{}, &testTunnelClient{}
+	keptCfg := tunnel("kept", "127.0.0.1:80")
+	keptCfg.RemotePort = 9001
+	tr := &Transport{
+		config: &configs.ClientConfig{Tunnels: []*configs.ClientTunnelConfig{keptCfg, tunnel("changed", "127.0.0.1:80")}},
+		client: &Client{
+			state:         Active,
+			session:       testSession{},
+			opts:          &cOptions{Smux: &SmuxClientOption{}},
+			tunnelClients: hash.NewSyncMap[string, TunnelClient](),
+		},
+	}
+	tr.client.tunnelClients.Store("kept", kept)
+	tr.client.tunnelClients.Store("changed", changed)
+	keptPush := tunnel("kept", "127.0.0.1:80")
+	tr.UpdateTunnels([]*configs.ClientTunnelConfig{keptPush, tunnel("changed", "127.0.0.1:81"), tunnel("added", "127.0.0.1:80")})
+
+	if kept.closed || opened["kept"] != nil {
+		t.Fatal("unchanged tunnel reopened")
+	}
+	if keptPush.RemotePort != 9001 {
+		t.Fatalf("unchanged tunnel RemotePort = %d, want 9001", keptPush.RemotePort)
+	}
+	if !changed.closed || opened["changed"] == nil || !opened["changed"].opened {
+		t.Fatal("changed tunnel not reopened")
+	}
+	if opened["added"] == nil || !opened["added"].opened {
+		t.Fatal("added tunnel not opened")
+	}
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
-	"github.com/xtaci/smux"
 )
 
 type TunnelClientControl struct {
@@ -64,12 +63,13 @@ func (receiver *TunnelClientControl) Cancel() {
 }
 
 // retry is a method that takes a function f of type func() error as a parameter
-// It is designed to repeatedly execute the function f with a fixed interval
-// until the context associated with the TunnelClientControl is cancelled
+// It is designed to repeatedly execute the function f with the backoff of the reconnect
+// policy until the context associated with the TunnelClientControl is cancelled
 func (receiver *TunnelClientControl) retry(f func() error) {
 	threading.GoSafe(func() {
-		ticker := time.NewTicker(time.Second * 5)
-		defer ticker.Stop()
+		b := reconnectPolicy.NewBackoff()
+		timer := time.NewTimer(0)
+		defer timer.Stop()
 		for {
 			select {
 			case <-receiver.Context().Done():
@@ -80,16 +80,26 @@ func (receiver *TunnelClientControl) retry(f func() error) {
 				log.Warn("Active tunnel error %v", err)
 				if errors.Is(err, sessionError) {
 					log.Warn("Active tunnel error, exit,%v", err)
+					receiver.Cancel()
 					return
 				} else {
 					log.Warn("Active tunnel error, continue,%v", err)
 				}
+			} else {
+				b.Reset()
 			}
-			ticker.Reset(time.Second * 5)
+			delay, ok := b.Next()
+			if !ok {
+				log.Error("Active tunnel failed %v times, give up", b.Attempts())
+				receiver.Cancel()
+				return
+			}
+			log.Debug("Active tunnel again in %v", delay.Round(time.Millisecond))
+			timer.Reset(delay)
 			select {
 			case <-receiver.Context().Done():
 				return
-			case <-ticker.C:
+			case <-timer.C:
 			}
 		}
 	})
@@ -104,10 +114,10 @@ type TunnelClient interface {
 
 	// Open Active opens a tunnel using the provided session.
 	// Parameters:
-	//   - session: The smux session to use.
+	//   - session: The smux or QUIC session to use.
 	// Returns:
 	//   - error: An error if the tunnel could not be opened.
-	Open(session *smux.Session) error
+	Open(session Session) error
 
 	Done() <-chan struct{}
 
@@ -125,7 +135,7 @@ type BaseTunnelClient struct {
 
 	DoRelease func(stream *transport.SChannel) error
 
-	session *smux.Session
+	session Session
 
 	isRetryOpen bool
 
@@ -167,7 +177,7 @@ func (b *BaseTunnelClient) GetName() string {
 	return "BaseTunnelClient" // Return the string "BaseTunnelClient" as the client name
 }
 
-func (b *BaseTunnelClient) Open(session *smux.Session) error {
+func (b *BaseTunnelClient) Open(session Session) error {
 	b.session = session
 	return b.OpenStream()
 }
@@ -202,9 +212,9 @@ func (b *BaseTunnelClient) OpenStream() error {
 			return err
 		}
 		b.isOpen = true
-		log.Info("Open stream success %v:%v", stream.RemoteAddr(), stream.ID())
+		log.Info("Open stream success %v:%v", stream.RemoteAddr(), channel.GetId())
 		<-channel.Done()
-		log.Info("Tunnel stream close exit:%v:%v", stream.RemoteAddr(), stream.ID())
+		log.Info("Tunnel stream close exit:%v:%v", stream.RemoteAddr(), channel.GetId())
 		streamCancel()
 		if !b.isRetryOpen {
 			b.release(channel)
@@ -245,18 +255,27 @@ func (b *BaseTunnelClient) Done() <-chan struct{} {
 }
 
 func (b *BaseTunnelClient) Close() {
-	b.TcControl.cancel()
+	if tc := b.TcControl; tc != nil {
+		tc.cancel()
+	}
 }
 
 // GetRegisterReq returns a RegisterReqAndRsp struct with configuration data from the BaseTunnelClient
 // This method is used to prepare registration request parameters for the tunnel connection
 func (b *BaseTunnelClient) GetRegisterReq() *exchange.RegisterReqAndRsp {
 	return &exchange.RegisterReqAndRsp{
-		TunnelPort: b.GetCfg().RemotePort, // Set the tunnel port from configuration
-		ProxyId:    b.GetCfg().ProxyId,    // Set the proxy identifier from configuration
-		TunnelType: b.GetCfg().TunnelType, // Set the tunnel type from configuration
-		HttpId:     b.GetCfg().HttpId,
-		Open:       true,
+		TunnelPort:    b.GetCfg().RemotePort, // Set the tunnel port from configuration
+		ProxyId:       b.GetCfg().ProxyId,    // Set the proxy identifier from configuration
+		TunnelType:    b.GetCfg().TunnelType, // Set the tunnel type from configuration
+		HttpId:        b.GetCfg().HttpId,
+		Open:          true,
+		UnId:          ManagerTransport.UnId,
+		SessionKey:    ManagerTransport.SessionKey,
+		Weight:        b.GetCfg().Weight,
+		Standby:       b.GetCfg().Standby,
+		ProxyProtocol: b.GetCfg().ProxyProtocol != "",
+		// WebSocket upgrades are streamed as they are.
+		WebsocketStream: true,
 	}
 }
 
@@ -298,6 +317,8 @@ func (b *BaseTunnelClient) OpenWorker(rsp *exchange.RegisterReqAndRsp, isToManag
 		HttpId:     rsp.HttpId,
 		TunnelPort: rsp.TunnelPort,
 		ServerId:   rsp.ServerId,
+		UnId:       ManagerTransport.UnId,
+		SessionKey: ManagerTransport.SessionKey,
 	}
 	if isToManager {
 		rs, err2 := ManagerTransport.SyncWrite(wreq, 5*time.Second)
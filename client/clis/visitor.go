@@ -0,0 +1,161 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package clis
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/iox"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+)
+
+// visitTimeout the time to wait for the server to pair a visitor connection.
+const visitTimeout = 15 * time.Second
+
+// Visitor listens on a local address and connects its connections to a secret tunnel
+// through the tunnel transport, or peer to peer when p2p is set.
+type Visitor struct {
+	cfg       *configs.VisitorConfig
+	transport *Transport
+	listener  net.Listener
+	p2pLock   sync.Mutex
+	// p2p the connection to the serving client, its streams carry the connections.
+	p2p *quicSession
+	// relayUntil p2p is not tried again before.
+	relayUntil time.Time
+}
+
+func NewVisitor(cfg *configs.VisitorConfig, transport *Transport) *Visitor {
+	return &Visitor{
+		cfg:       cfg,
+		transport: transport,
+	}
+}
+
+// Start listens on the bind address of the visitor.
+func (v *Visitor) Start() error {
+	listener, err := net.Listen(string(lang.NetworkTcp), v.cfg.Bind)
+	if err != nil {
+		return fmt.Errorf("visitor %s listen %s error: %w", v.cfg.ProxyId, v.cfg.Bind, err)
+	}
+	v.listener = listener
+	log.Info("Visitor of tunnel %s listen on %s", v.cfg.ProxyId, v.cfg.Bind)
+	threading.GoSafe(v.accept)
+	return nil
+}
+
+func (v *Visitor) accept() {
+	for {
+		conn, err := v.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error("Visitor %s accept error: %v", v.cfg.ProxyId, err)
+			}
+			return
+		}
+		threading.GoSafe(func() {
+			v.serve(conn)
+		})
+	}
+}
+
+// serve asks the server for the secret tunnel on a new stream, then pipes the connection.
+// A p2p visitor opens a stream to the serving client instead, the server relays only when
+// that fails.
+func (v *Visitor) serve(conn net.Conn) {
+	if v.cfg.P2p {
+		stream, err := v.openP2pStream()
+		if err == nil {
+			log.Debug("Visitor %v connected p2p to tunnel %s", conn.RemoteAddr(), v.cfg.ProxyId)
+			errs := iox.Pipe(stream, CountConn(conn, v.cfg.ProxyId))
+			log.Debug("Visitor %v of tunnel %s closed %v", conn.RemoteAddr(), v.cfg.ProxyId, errs)
+			return
+		}
+		if !errors.Is(err, errP2pRelay) {
+			log.Warn("P2p of tunnel %s error, the server relays: %v", v.cfg.ProxyId, err)
+		}
+	}
+	if !v.transport.isConnected() {
+		log.Warn("Visitor %s: tunnel transport is not connected", v.cfg.ProxyId)
+		_ = conn.Close()
+		return
+	}
+	stream, err := v.transport.client.session.OpenStream()
+	if err != nil {
+		log.Error("Visitor %s open stream error: %v", v.cfg.ProxyId, err)
+		_ = conn.Close()
+		return
+	}
+	if err = v.visit(stream); err != nil {
+		log.Warn("Visit tunnel %s error: %v", v.cfg.ProxyId, err)
+		_ = stream.Close()
+		_ = conn.Close()
+		return
+	}
+	log.Debug("Visitor %v connected to tunnel %s", conn.RemoteAddr(), v.cfg.ProxyId)
+	errs := iox.Pipe(stream, CountConn(conn, v.cfg.ProxyId))
+	log.Debug("Visitor %v of tunnel %s closed %v", conn.RemoteAddr(), v.cfg.ProxyId, errs)
+}
+
+func (v *Visitor) visit(stream net.Conn) error {
+	_, err := request(stream, &exchange.VisitReq{
+		ProxyId:    v.cfg.ProxyId,
+		Secret:     v.cfg.Secret,
+		UnId:       ManagerTransport.UnId,
+		SessionKey: ManagerTransport.SessionKey,
+	})
+	return err
+}
+
+// request writes the request on the stream and reads the response of the server.
+func request(stream net.Conn, req exchange.InBound) (*exchange.Protocol, error) {
+	r, err := exchange.NewRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = stream.SetDeadline(time.Now().Add(visitTimeout))
+	if _, err = stream.Write(r.Bytes()); err != nil {
+		return nil, err
+	}
+	rsp, err := exchange.Decoder(stream)
+	if err != nil {
+		return nil, err
+	}
+	if !rsp.IsSuccess() {
+		return nil, errors.New(rsp.RspMsg)
+	}
+	return rsp, stream.SetDeadline(time.Time{})
+}
+
+// Close stops listening, the connections in progress are left alone.
+func (v *Visitor) Close() {
+	if v.listener != nil {
+		_ = v.listener.Close()
+	}
+	v.p2pLock.Lock()
+	defer v.p2pLock.Unlock()
+	if v.p2p != nil {
+		_ = v.p2p.Close()
+	}
+}
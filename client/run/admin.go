@@ -0,0 +1,255 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package run
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/g-brook/brook/client/cli"
+	"github.com/g-brook/brook/client/clis"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+)
+
+// ReloadFun reloads the configs file of the client, it is set by the command.
+var ReloadFun func() error
+
+// GiveUpFun ends the client once it gave up reconnecting to the server, it is set by the
+// command.
+var GiveUpFun func(err error)
+
+// AdminTokenHeader carries the token of the client configs on the admin requests that
+// change the client, a web page can't send it without the user's consent.
+const AdminTokenHeader = "X-Brook-Token"
+
+// ClientStatus is the state of the client and of its tunnels.
+type ClientStatus struct {
+	cli.State
+	UnId    string         `json:"unId"`
+	Managed bool           `json:"managed"`
+	Tunnels []TunnelStatus `json:"tunnels"`
+}
+
+// TunnelStatus is the state and the traffic of a tunnel.
+type TunnelStatus struct {
+	ProxyId     string   `json:"proxyId"`
+	Type        string   `json:"type"`
+	Destination string   `json:"destination"`
+	HttpId      string   `json:"httpId,omitempty"`
+	HttpIds     []string `json:"httpIds,omitempty"`
+	RemotePort  int      `json:"remotePort"`
+	Open        bool     `json:"open"`
+	Connections int64    `json:"connections"`
+	InBytes     int64    `json:"inBytes"`
+	OutBytes    int64    `json:"outBytes"`
+}
+
+// Admin is the local http api to watch and control a client without the TUI.
+type Admin struct {
+	service *Service
+	server  *http.Server
+	token   string
+}
+
+// StartAdmin serves the admin api of the service on the manager port of the loopback address,
+// the requests changing the client need the token of the configs.
+func StartAdmin(port int, token string, service *Service) *Admin {
+	if port <= 0 {
+		return nil
+	}
+	a := &Admin{service: service, token: token}
+	a.server = &http.Server{
+		Addr:              net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		Handler:           a.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	threading.GoSafe(func() {
+		log.Info("Start admin api on %s", a.server.Addr)
+		if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Start admin api error: %v", err)
+		}
+	})
+	return a
+}
+
+func (a *Admin) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", a.status)
+	mux.HandleFunc("GET /api/tunnels", a.tunnels)
+	mux.HandleFunc("GET /api/logs", a.logs)
+	mux.HandleFunc("POST /api/reload", a.reload)
+	mux.HandleFunc("POST /api/tunnels/{proxyId}/restart", a.restart)
+	mux.HandleFunc("POST /api/disconnect", a.disconnect)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.authorize(r); err != nil {
+			log.Warn("Admin api %s %s refused: %v", r.Method, r.URL.Path, err)
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorize refuses the requests for another host than the loopback address, a page of a
+// rebound domain sends its own, and of the web pages of other origins. The requests changing
+// the client need the token, none are taken when the configs have no token.
+func (a *Admin) authorize(r *http.Request) error {
+	if !isLoopbackHost(r.Host) {
+		return fmt.Errorf("host %s is not allowed", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("origin %s is not allowed", origin)
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return nil
+	}
+	if a.token == "" {
+		return errors.New("the configs have no token, the admin api is read only")
+	}
+	tokens := r.Header.Values(AdminTokenHeader)
+	if len(tokens) != 1 || subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(a.token)) != 1 {
+		return fmt.Errorf("missing or wrong %s header", AdminTokenHeader)
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether the Host header names the loopback address.
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// Close stops the admin api.
+func (a *Admin) Close() {
+	if a != nil && a.server != nil {
+		_ = a.server.Close()
+	}
+}
+
+func (a *Admin) status(w http.ResponseWriter, _ *http.Request) {
+	status := ClientStatus{
+		State:   cli.GetState(),
+		Managed: a.service.managed,
+		Tunnels: a.service.tunnelStatus(),
+	}
+	if clis.ManagerTransport != nil {
+		status.UnId = clis.ManagerTransport.UnId
+	}
+	writeJson(w, http.StatusOK, status)
+}
+
+func (a *Admin) tunnels(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, http.StatusOK, a.service.tunnelStatus())
+}
+
+func (a *Admin) logs(w http.ResponseWriter, r *http.Request) {
+	lines, _ := strconv.Atoi(r.URL.Query().Get("lines"))
+	writeJson(w, http.StatusOK, cli.RecentLogs(lines))
+}
+
+func (a *Admin) reload(w http.ResponseWriter, _ *http.Request) {
+	if ReloadFun == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("reload is not supported"))
+		return
+	}
+	if err := ReloadFun(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, "ok")
+}
+
+func (a *Admin) restart(w http.ResponseWriter, r *http.Request) {
+	proxyId := r.PathValue("proxyId")
+	if a.service.tunnelTransport == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("tunnels are not opened yet"))
+		return
+	}
+	if err := a.service.tunnelTransport.RestartTunnel(proxyId); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, "ok")
+}
+
+// disconnect drops the connections to the server, they are reconnected like after a
+// network failure.
+func (a *Admin) disconnect(w http.ResponseWriter, _ *http.Request) {
+	if clis.ManagerTransport == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("client is not started"))
+		return
+	}
+	log.Info("Disconnect from the server by the admin api")
+	clis.ManagerTransport.GetTransport().Close()
+	writeJson(w, http.StatusOK, "ok")
+}
+
+// tunnelStatus returns the state and the traffic of every tunnel.
+func (receiver *Service) tunnelStatus() []TunnelStatus {
+	if receiver.tunnelTransport == nil {
+		return []TunnelStatus{}
+	}
+	tunnels := receiver.tunnelTransport.Tunnels()
+	status := make([]TunnelStatus, 0, len(tunnels))
+	for _, t := range tunnels {
+		traffic := clis.GetTraffic(t.ProxyId)
+		status = append(status, TunnelStatus{
+			ProxyId:     t.ProxyId,
+			Type:        string(t.TunnelType),
+			Destination: t.Destination,
+			HttpId:      t.HttpId,
+			HttpIds:     t.HttpIds,
+			RemotePort:  t.RemotePort,
+			Open:        clis.ManagerTransport.GetConfig(t.ProxyId) != nil,
+			Connections: traffic.Connections.Load(),
+			InBytes:     traffic.In.Load(),
+			OutBytes:    traffic.Out.Load(),
+		})
+	}
+	return status
+}
+
+func writeJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug("Write admin response error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJson(w, code, map[string]string{"error": fmt.Sprint(err)})
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package run
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthorize(t *testing.T) {
+	reloads := 0
+	ReloadFun = func() error {
+		reloads++
+		return nil
+	}
+	defer func() {
+		ReloadFun = nil
+	}()
+	handler := (&Admin{service: &Service{}, token: "tok"}).handler()
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		code    int
+	}{
+		{"status", http.MethodGet, "/api/status", nil, http.StatusOK},
+		{"status of the same origin", http.MethodGet, "/api/tunnels", map[string]string{"Origin": "http://127.0.0.1:9000"}, http.StatusOK},
+		{"status of a foreign origin", http.MethodGet, "/api/status", map[string]string{"Origin": "http://evil.test"}, http.StatusForbidden},
+		{"status of a rebound host", http.MethodGet, "/api/status", map[string]string{"Host": "evil.test:9000"}, http.StatusForbidden},
+		{"logs of a rebound host", http.MethodGet, "/api/logs", map[string]string{"Host": "evil.test:9000", "Origin": "http://evil.test:9000"}, http.StatusForbidden},
+		{"tunnels of localhost", http.MethodGet, "/api/tunnels", map[string]string{"Host": "localhost:9000"}, http.StatusOK},
+		{"tunnels of ipv6 loopback", http.MethodGet, "/api/tunnels", map[string]string{"Host": "[::1]:9000"}, http.StatusOK},
+		{"reload without token", http.MethodPost, "/api/reload", nil, http.StatusForbidden},
+		{"reload with a wrong token", http.MethodPost, "/api/reload", map[string]string{AdminTokenHeader: "bad"}, http.StatusForbidden},
+		{"reload of a foreign origin", http.MethodPost, "/api/reload", map[string]string{AdminTokenHeader: "tok", "Origin": "http://evil.test"}, http.StatusForbidden},
+		{"disconnect without token", http.MethodPost, "/api/disconnect", map[string]string{"Content-Type": "text/plain"}, http.StatusForbidden},
+		{"restart without token", http.MethodPost, "/api/tunnels/t1/restart", nil, http.StatusForbidden},
+		{"restart with token", http.MethodPost, "/api/tunnels/t1/restart", map[string]string{AdminTokenHeader: "tok"}, http.StatusServiceUnavailable},
+		{"reload with token", http.MethodPost, "/api/reload", map[string]string{AdminTokenHeader: "tok"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://127.0.0.1:9000"+tt.path, nil)
+			for k, v := range tt.headers {
+				if k == "Host" {
+					req.Host = v
+					continue
+				}
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("%s %s: %d, want %d: %s", tt.method, tt.path, w.Code, tt.code, w.Body)
+			}
+		})
+	}
+	if reloads != 1 {
+		t.Fatalf("reloaded %d times, want 1", reloads)
+	}
+}
+
+func TestAdminWithoutToken(t *testing.T) {
+	ReloadFun = func() error {
+		t.Fatal("reloaded without a token in the configs")
+		return nil
+	}
+	defer func() {
+		ReloadFun = nil
+	}()
+	handler := (&Admin{service: &Service{}}).handler()
+	for _, token := range []string{"", "x"} {
+		req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:9000/api/reload", nil)
+		req.Header.Set(AdminTokenHeader, token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("reload with token %q: %d, want %d", token, w.Code, http.StatusForbidden)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1:9000/api/tunnels", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("tunnels without token: %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAdminReloadError(t *testing.T) {
+	ReloadFun = func() error {
+		return errors.New("bad configs")
+	}
+	defer func() {
+		ReloadFun = nil
+	}()
+	handler := (&Admin{service: &Service{}, token: "tok"}).handler()
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:9000/api/reload", nil)
+	req.Header.Set(AdminTokenHeader, "tok")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("reload error: %d", w.Code)
+	}
+}
@@ -18,14 +18,20 @@ package run
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/g-brook/brook/client/cli"
 	"github.com/g-brook/brook/client/clis"
+	"github.com/g-brook/brook/common/backoff"
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/tlsx"
 )
 
 type Service struct {
@@ -33,12 +39,41 @@ type Service struct {
 	ctx       context.Context
 	connState chan struct{}
 	connOnce  sync.Once
+	cfg       *configs.ClientConfig
+	// managed is true when the client has no tunnels or visitors of its own and serves the tunnels of the server.
+	managed         bool
+	tunnelTransport *clis.Transport
+	tlsConfig       *tls.Config
+	visitors        []*clis.Visitor
 }
 
 func (receiver *Service) Connection(_ *clis.ClientControl) {
+	first := false
 	receiver.connOnce.Do(func() {
+		first = true
 		close(receiver.connState)
 	})
+	if !first && receiver.cfg != nil {
+		//The manager channel is new after reconnecting, login again to restore the session.
+		threading.GoSafe(receiver.relogin)
+	}
+}
+
+// relogin logs in again after reconnecting, maybe to another server after a failover, so
+// the tunnel connection follows the server.
+func (receiver *Service) relogin() {
+	rsp, err := receiver.login(receiver.cfg)
+	if err != nil {
+		log.Error("Login again error: %v", err)
+		clis.ManagerTransport.GetTransport().Failover()
+		return
+	}
+	if receiver.tunnelTransport == nil {
+		receiver.openTunnels(receiver.cfg, rsp)
+		return
+	}
+	receiver.tunnelTransport.MoveTo(receiver.tunnelAddress(rsp))
+	receiver.updateTunnels(rsp.Tunnels)
 }
 
 func NewService() *Service {
@@ -49,70 +84,179 @@ func NewService() *Service {
 }
 
 func (receiver *Service) Run(cfg *configs.ClientConfig) {
+	receiver.cfg = cfg
+	cli.UpdateRemoteAddress(cfg.ServerEndpoints()[0].String())
+	receiver.managed = len(cfg.Tunnels) == 0 && len(cfg.Visitors) == 0
+	clis.SetReconnectPolicy(backoff.FromConfig(cfg.Reconnect))
 	threading.GoSafe(func() {
+		tlsConfig, err := tlsx.NewClientConfig(cfg.Tls)
+		if err != nil {
+			panic("Brook exit:" + err.Error())
+		}
+		receiver.tlsConfig = tlsConfig
 		//Connection to server.
 		manager := clis.NewTransport(cfg)
+		manager.OnGiveUp(receiver.giveUp)
 		//init manager transport.
 		clis.InitManagerTransport(manager)
+		clis.ManagerTransport.AddMessageNotify(exchange.PushTunnels, receiver.onPushTunnels)
+		clis.ManagerTransport.AddMessageNotify(exchange.P2pOffer, clis.OnP2pOffer)
 		manager.Connection(
 			clis.WithTimeout(3*time.Second),
 			clis.WithKeepAlive(10*time.Second),
 			clis.WithClientHandler(receiver),
 			clis.WithPingTime(cfg.PingTime*time.Millisecond),
 			clis.WithClientHandler(clis.ManagerTransport),
+			clis.WithTls(tlsConfig),
 		)
 		<-receiver.connState
 		//Update cli status.
-		err := receiver.connectionTunnel(cfg)
+		err = receiver.connectionTunnel(cfg)
 		if err != nil {
-			panic("Brook exit:%v" + err.Error())
+			if !manager.CanFailover() {
+				panic("Brook exit:%v" + err.Error())
+			}
+			//Try the other servers, the tunnels are opened after logging in to one of them.
+			log.Error("Login error: %v", err)
+			manager.Failover()
 		}
 	})
 }
 
 func (receiver *Service) connectionTunnel(cfg *configs.ClientConfig) error {
-	if cfg.Tunnels == nil {
-		log.Warn("Tunnels is empty, no tunnels will be opened")
-		return nil
-	}
-	req := &exchange.LoginReq{
-		Token: cfg.Token,
-	}
-	p, err := clis.ManagerTransport.SyncWrite(req, 5*time.Second)
-	if err != nil {
-		return err
-	}
-	rsp, err := exchange.Parse[exchange.LoginResp](p.Data)
+	rsp, err := receiver.login(cfg)
 	if err != nil {
-		log.Error(err.Error())
 		return err
 	}
-	tunnelServer := cfg.ServerHost
+	receiver.openTunnels(cfg, rsp)
+	return nil
+}
+
+// tunnelAddress returns the address of the tunnel connection of the server logged in.
+func (receiver *Service) tunnelAddress(rsp *exchange.LoginResp) (string, int) {
+	host, _ := clis.ManagerTransport.GetTransport().Address()
 	if rsp.TunnelHost != "" {
-		tunnelServer = rsp.TunnelHost
+		host = rsp.TunnelHost
 	}
-	//tunnels := cfg.Tunnels
-	//if rp. {
-	//
-	//}
-	//Bind unId.
-	clis.ManagerTransport.BindUnId(rsp.UnId)
+	return host, rsp.TunnelPort
+}
+
+// openTunnels starts the tunnel connection and opens the tunnels.
+func (receiver *Service) openTunnels(cfg *configs.ClientConfig, rsp *exchange.LoginResp) {
+	tunnels := cfg.Tunnels
+	if receiver.managed {
+		tunnels = rsp.Tunnels
+		log.Info("Serving %d tunnels of the server", len(tunnels))
+	}
+	tunnelServer, tunnelPort := receiver.tunnelAddress(rsp)
 	//Update configs.
 	newCfg := configs.ClientConfig{
-		ServerPort: rsp.TunnelPort,
+		ServerPort: tunnelPort,
 		ServerHost: tunnelServer,
 		PingTime:   cfg.PingTime,
-		Tunnels:    cfg.Tunnels,
+		Tunnels:    tunnels,
+		Tls:        cfg.Tls,
 	}
 	//Start tunnel connection.
 	tunnelTransport := clis.NewTransport(&newCfg)
+	tunnelTransport.OnGiveUp(receiver.giveUp)
 	tunnelTransport.Connection(
 		clis.WithPingTime(newCfg.PingTime*time.Millisecond),
-		clis.WithClientSmux(clis.NewSmuxClientOption()))
+		clis.WithClientSmux(clis.NewSmuxClientOption()),
+		clis.WithTls(receiver.tlsConfig),
+		clis.WithQuic(cfg.Transport == lang.NetworkQuic))
 	clis.ManagerTransport.WithTunnelTransport(tunnelTransport)
+	receiver.tunnelTransport = tunnelTransport
+	for _, it := range cfg.Visitors {
+		visitor := clis.NewVisitor(it, tunnelTransport)
+		if err := visitor.Start(); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		receiver.visitors = append(receiver.visitors, visitor)
+	}
+}
+
+// onPushTunnels applies the tunnels pushed by the server.
+func (receiver *Service) onPushTunnels(r *exchange.Protocol) error {
+	push, err := exchange.Parse[exchange.TunnelsPush](r.Data)
+	if err != nil {
+		log.Error("Parse TunnelsPush error: %v", err)
+		return err
+	}
+	threading.GoSafe(func() {
+		receiver.updateTunnels(push.Tunnels)
+	})
+	return nil
+}
+
+// giveUp stops the client once a transport gave up reconnecting, it's left to the command
+// to exit.
+func (receiver *Service) giveUp(err error) {
+	cli.UpdateStatus("failed")
+	receiver.Shutdown()
+	if GiveUpFun != nil {
+		GiveUpFun(err)
+	}
+}
+
+// Shutdown closes the connections to the server, they aren't reconnected.
+func (receiver *Service) Shutdown() {
+	if receiver.tunnelTransport != nil {
+		receiver.tunnelTransport.Shutdown()
+	}
+	if clis.ManagerTransport != nil {
+		clis.ManagerTransport.GetTransport().Shutdown()
+	}
+}
+
+// ReloadTunnels applies the tunnels of the reloaded configs file, the tunnels of a managed
+// client come from the server and are left alone.
+func (receiver *Service) ReloadTunnels(tunnels []*configs.ClientTunnelConfig) error {
+	if receiver.managed {
+		log.Info("The tunnels are managed by the server, reload is skipped")
+		return nil
+	}
+	if receiver.tunnelTransport == nil {
+		return fmt.Errorf("tunnels are not opened yet")
+	}
+	receiver.tunnelTransport.UpdateTunnels(tunnels)
 	return nil
 }
 
+// updateTunnels serves the tunnels of the server, only when the client is managed.
+func (receiver *Service) updateTunnels(tunnels []*configs.ClientTunnelConfig) {
+	if !receiver.managed || receiver.tunnelTransport == nil {
+		return
+	}
+	receiver.tunnelTransport.UpdateTunnels(tunnels)
+}
+
+// login sends the token to the server and binds the returned unId.
+func (receiver *Service) login(cfg *configs.ClientConfig) (*exchange.LoginResp, error) {
+	req := &exchange.LoginReq{
+		Token:   cfg.Token,
+		Managed: receiver.managed,
+	}
+	p, err := clis.ManagerTransport.SyncWrite(req, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsSuccess() {
+		return nil, fmt.Errorf("login fail: %s", p.RspMsg)
+	}
+	rsp, err := exchange.Parse[exchange.LoginResp](p.Data)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+	//Bind unId.
+	clis.ManagerTransport.BindUnId(rsp.UnId, rsp.SessionKey)
+	host, _ := clis.ManagerTransport.GetTransport().Address()
+	clis.ManagerTransport.BindP2pServer(host, rsp.P2pPort)
+	return rsp, nil
+}
+
 func (receiver *Service) background() context.Context {
 	return receiver.ctx
 }
@@ -30,30 +30,35 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/g-brook/brook/client/clis"
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/hash"
 	"github.com/g-brook/brook/common/httpx"
-	"github.com/g-brook/brook/common/ringbuffer"
+	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/threading"
 )
 
 var httpError = errors.New("error: Agent connect to server failed")
 
+var errWebsocketServer = errors.New("error: the server is too old for the WebSocket of this client, upgrade it")
+
 type HttpClientManager struct {
 	clients *hash.SyncMap[int64, *HttpBridge]
 	lock    sync.Mutex
+	proxyId string
 }
 
-func NewHttpClientManager() *HttpClientManager {
+func NewHttpClientManager(proxyId string) *HttpClientManager {
 	return &HttpClientManager{
 		clients: hash.NewSyncMap[int64, *HttpBridge](),
+		proxyId: proxyId,
 	}
 }
 
 func (r *HttpClientManager) GetHttpBridge(ctx context.Context,
 	left io.ReadWriteCloser,
 	rightAddress string,
-	reqId int64, isWs bool) (*HttpBridge, error) {
+	reqId int64, stream bool) (*HttpBridge, error) {
 	load, b := r.clients.Load(reqId)
 	if b {
 		return load, nil
@@ -68,19 +73,26 @@ func (r *HttpClientManager) GetHttpBridge(ctx context.Context,
 	if err != nil {
 		return nil, err
 	}
-	bridge := r.newHttpBridge(ctx, left, dial, reqId, r)
-	bridge.isWs = isWs
+	bridge := r.newHttpBridge(ctx, left, clis.CountConn(dial, r.proxyId), reqId, r)
+	bridge.stream = stream
 	bridge.toRunning()
 	r.clients.Store(reqId, bridge)
 	return bridge, nil
 }
 
+// closeHttpBridge closes the bridge of the request the server is done with.
+func (r *HttpClientManager) closeHttpBridge(reqId int64) {
+	if bridge, ok := r.clients.Load(reqId); ok {
+		bridge.Close()
+	}
+}
+
 func (r *HttpClientManager) newHttpBridge(ctx context.Context, left io.ReadWriteCloser, right net.Conn, reqId int64, manager *HttpClientManager) *HttpBridge {
 	newCtx, cancel := context.WithCancel(ctx)
 	return &HttpBridge{
 		left:    left,
 		right:   right,
-		buffer:  ringbuffer.Get(),
+		buffer:  iox.NewStreamBuffer(),
 		context: newCtx,
 		cancel:  cancel,
 		reqId:   reqId,
@@ -88,12 +100,10 @@ func (r *HttpClientManager) newHttpBridge(ctx context.Context, left io.ReadWrite
 	}
 }
 
-type upgraderDo func()
-
 type HttpBridge struct {
 	left          io.ReadWriteCloser
 	right         net.Conn
-	buffer        *ringbuffer.RingBuffer
+	buffer        *iox.StreamBuffer
 	context       context.Context
 	cancel        context.CancelFunc
 	reqId         int64
@@ -101,8 +111,8 @@ type HttpBridge struct {
 	isRunning     atomic.Bool
 	cancelOnce    sync.Once
 	lastWriteTime time.Time
-	isWs          bool
-	hp            upgraderDo
+	// stream the server takes the response as it comes, see streamToLeft.
+	stream bool
 }
 
 func (b *HttpBridge) Read(p []byte) (n int, err error) {
@@ -141,6 +151,10 @@ func (b *HttpBridge) toRunning() {
 			return
 		default:
 			defer b.Close()
+			if b.stream {
+				b.streamToLeft()
+				return
+			}
 			reader := bufio.NewReader(b.right)
 			response, err := http.ReadResponse(reader, nil)
 			if err != nil {
@@ -149,12 +163,6 @@ func (b *HttpBridge) toRunning() {
 				return
 			}
 			defer response.Body.Close()
-			if b.isWs && b.hp != nil {
-				if response.StatusCode == http.StatusSwitchingProtocols {
-					b.hp()
-					return
-				}
-			}
 			bodyBytes, _ := io.ReadAll(response.Body)
 			headerBytes := BuildCustomHTTPHeader(response, len(bodyBytes))
 			merged := append(headerBytes, bodyBytes...)
@@ -165,36 +173,43 @@ func (b *HttpBridge) toRunning() {
 
 func (b *HttpBridge) Close() {
 	b.cancelOnce.Do(func() {
-		if b.buffer != nil {
-			b.buffer.Reset()
-			ringbuffer.Put(b.buffer)
-		}
+		_ = b.buffer.Close()
 		b.cancel()
-		if !b.isWs {
-			_ = b.right.Close()
-		}
+		_ = b.right.Close()
 		b.manager.clients.Delete(b.reqId)
 		b.manager = nil
-		b.buffer = nil
 		b.left = nil
 		b.context = nil
 		b.right = nil
 	})
 }
 
-func (b *HttpBridge) WriterToRight(p []byte) (int, error) {
-	return b.buffer.Write(p)
-}
-
-func (b *HttpBridge) websocket(ctx context.Context, path string, websocket *WebsocketClientManager) (*WebsocketBridge, error) {
-	if !b.isWs {
-		return nil, fmt.Errorf("not websocket protocol")
+// streamToLeft sends the response of the local server to the server as it comes, the
+// server parses it: a Server-Sent Events or chunked response streams, and a kept-alive
+// connection serves the next request of the server. The V1 frame ends it when the local
+// server closes the connection.
+func (b *HttpBridge) streamToLeft() {
+	left, right, reqId := b.left, b.right, b.reqId
+	if left == nil || right == nil {
+		return
 	}
-	return websocket.newWebsocketBridge(ctx, path, b.left, b.right, b.reqId), nil
+	_ = iox.WithBuffer(func(buf []byte) error {
+		for {
+			n, err := right.Read(buf)
+			if n > 0 {
+				if werr := exchange.NewTunnelVerWriter(exchange.HttpStream, buf[:n], reqId).Writer(left); werr != nil {
+					return werr
+				}
+			}
+			if err != nil {
+				return exchange.NewTunnelWriter(nil, reqId).Writer(left)
+			}
+		}
+	}, iox.GetBytePool32k())
 }
 
-func (b *HttpBridge) upgrader(upd upgraderDo) {
-	b.hp = upd
+func (b *HttpBridge) WriterToRight(p []byte) (int, error) {
+	return b.buffer.Write(p)
 }
 
 func getErrorResponse(err error) []byte {
@@ -27,7 +27,6 @@ import (
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
-	"github.com/gobwas/ws"
 )
 
 func NewHttpTunnelClient(config *configs.ClientTunnelConfig) (*HttpTunnelClient, error) {
@@ -38,8 +37,7 @@ func NewHttpTunnelClient(config *configs.ClientTunnelConfig) (*HttpTunnelClient,
 	tunnelClient := clis.NewBaseTunnelClient(config, true)
 	client := HttpTunnelClient{
 		BaseTunnelClient: tunnelClient,
-		websocket:        newWebsocketClientManager(),
-		http:             NewHttpClientManager(),
+		http:             NewHttpClientManager(config.ProxyId),
 	}
 	tunnelClient.DoOpen = client.initOpen
 	return &client, nil
@@ -48,8 +46,7 @@ func NewHttpTunnelClient(config *configs.ClientTunnelConfig) (*HttpTunnelClient,
 // HttpTunnelClient is a tunnel client that handles HTTP connections.
 type HttpTunnelClient struct {
 	*clis.BaseTunnelClient
-	websocket *WebsocketClientManager
-	http      *HttpClientManager
+	http *HttpClientManager
 }
 
 // GetName returns the name of the tunnel client.
@@ -102,31 +99,22 @@ func (h *HttpTunnelClient) bindHandler(p *exchange.Protocol, rw io.ReadWriteClos
 			return err
 		}
 		// If the pt.Ver is v1, that it is a http request
-		if pt.Ver == exchange.V1 || pt.Ver == exchange.WebsocketV1 {
-			isWs := pt.Ver == exchange.WebsocketV1
-			httpBridge, err := h.http.GetHttpBridge(ctx, rw, h.GetCfg().Destination, pt.ReqId, isWs)
+		if pt.Ver == exchange.V1 {
+			stream := pt.AttrLen > 0 && pt.Attr[0]&exchange.HttpStreamFlag != 0
+			httpBridge, err := h.http.GetHttpBridge(ctx, rw, h.GetCfg().Destination, pt.ReqId, stream)
 			if err != nil {
 				log.Warn("GetHttpBridge fail %v", err)
 				response := getErrorResponse(httpError)
 				return exchange.NewTunnelWriter(response, pt.ReqId).Writer(rw)
 			}
-			//to websocket ss.
-			if isWs {
-				path := string(pt.Attr)
-				httpBridge.upgrader(func() {
-					wsBridge, err := httpBridge.websocket(ctx, path, h.websocket)
-					if err != nil {
-						h.websocket.closeWebsocketLeft(rw, pt.ReqId)
-						return
-					}
-					wsBridge.toRunning()
-					log.Debug("Connect to websocket success.")
-					return
-				})
-			}
 			_, _ = httpBridge.WriterToRight(pt.Data)
-		} else if pt.Ver == exchange.WebsocketV2 {
-			websocketCall(pt, rw, h.websocket)
+		} else if pt.Ver == exchange.HttpClose {
+			h.http.closeHttpBridge(pt.ReqId)
+		} else if pt.Ver == exchange.WebsocketV1 {
+			// An older server re-frames the WebSocket messages, refuse the upgrade.
+			log.Warn("The server re-frames the WebSocket %s, upgrade it to proxy WebSocket", string(pt.Attr))
+			response := getErrorResponse(errWebsocketServer)
+			return exchange.NewTunnelWriter(response, pt.ReqId).Writer(rw)
 		}
 		return nil
 
@@ -149,17 +137,3 @@ func (h *HttpTunnelClient) bindHandler(p *exchange.Protocol, rw io.ReadWriteClos
 	}
 
 }
-
-func websocketCall(protocol *exchange.TunnelProtocol, left io.ReadWriteCloser, manager *WebsocketClientManager) {
-	if len(protocol.Attr) <= 1 {
-		return
-	}
-	opCode := ws.OpCode(protocol.Attr[0])
-	path := string(protocol.Attr[1:])
-	conn, b := manager.getWebsocketBridge(path)
-	if !b {
-		manager.closeWebsocketLeft(left, protocol.ReqId)
-		return
-	}
-	conn.WriteToRight(opCode, protocol.Data)
-}
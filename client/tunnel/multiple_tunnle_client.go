@@ -30,7 +30,6 @@ import (
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
-	"github.com/xtaci/smux"
 )
 
 var (
@@ -48,7 +47,8 @@ func init() {
 	ft := func(config *configs.ClientTunnelConfig) clis.TunnelClient {
 		initOnce.Do(func() {
 			globalMultipleClient = &MultipleTunnelClient{
-				sessions: hash.NewSyncMap[string, *smux.Session](),
+				sessions: hash.NewSyncMap[string, clis.Session](),
+				clients:  hash.NewSyncMap[string, *hash.SyncSet[clis.TunnelClient]](),
 			}
 			globalMultipleClient.messageListener()
 		})
@@ -61,10 +61,14 @@ func init() {
 	clis.RegisterTunnelClient(lang.Udp, ft)
 	clis.RegisterTunnelClient(lang.Http, ft)
 	clis.RegisterTunnelClient(lang.Https, ft)
+	clis.RegisterTunnelClient(lang.Quic, ft)
+	clis.RegisterTunnelClient(lang.Socks5, ft)
 }
 
 type MultipleTunnelClient struct {
-	sessions  *hash.SyncMap[string, *smux.Session]
+	sessions *hash.SyncMap[string, clis.Session]
+	// clients the tunnel clients serving the work connections of each proxy id.
+	clients   *hash.SyncMap[string, *hash.SyncSet[clis.TunnelClient]]
 	closeOnce sync.Once
 }
 
@@ -100,31 +104,82 @@ func (m *MultipleTunnelClient) messageListener() {
 				log.Warn("not found session %v", reqWorker.ProxyId)
 				return
 			}
-			client, err := newTunnelClient(config, m)
-			if err != nil {
-				log.Error("newTunnelClient error: %v", err)
-				return
+			for _, cfg := range routeConfigs(config) {
+				threading.GoSafe(func() {
+					client, err := newTunnelClient(cfg, m)
+					if err != nil {
+						log.Error("newTunnelClient error: %v", err)
+						return
+					}
+					m.track(id, client, session)
+				})
 			}
-			_ = client.Open(session)
 		})
 		return nil
 	})
 }
 
+// routeConfigs returns a config for every route an http tunnel serves, the other tunnels
+// have only their own.
+func routeConfigs(config *configs.ClientTunnelConfig) []*configs.ClientTunnelConfig {
+	if len(config.HttpIds) == 0 {
+		return []*configs.ClientTunnelConfig{config}
+	}
+	cfgs := make([]*configs.ClientTunnelConfig, 0, len(config.HttpIds))
+	for _, httpId := range config.HttpIds {
+		cfg := *config
+		cfg.HttpId = httpId
+		cfgs = append(cfgs, &cfg)
+	}
+	return cfgs
+}
+
+// track opens the tunnel client and keeps it until it is done, so the tunnel of the proxy
+// id can be closed alone.
+func (m *MultipleTunnelClient) track(proxyId string, client clis.TunnelClient, session clis.Session) {
+	clients, _ := m.clients.LoadOrStore(proxyId, hash.NewSyncSet[clis.TunnelClient]())
+	done := client.Done()
+	clients.Add(client)
+	defer clients.Remove(client)
+	if err := client.Open(session); err != nil {
+		return
+	}
+	<-done
+}
+
+// closeTunnel closes the tunnel clients of the proxy id, the other tunnels of the session
+// keep serving.
+func (m *MultipleTunnelClient) closeTunnel(proxyId string) {
+	m.sessions.Delete(proxyId)
+	if clients, ok := m.clients.LoadAndDelete(proxyId); ok {
+		clients.ForEach(func(client clis.TunnelClient) bool {
+			client.Close()
+			return true
+		})
+	}
+}
+
 func newTunnelClient(config *configs.ClientTunnelConfig, m *MultipleTunnelClient) (clis.TunnelClient, error) {
 	switch config.TunnelType {
 	case lang.Tcp:
 		return NewTcpTunnelClient(config, m)
+	case lang.Quic:
+		if config.Network == lang.NetworkUdp {
+			return NewUdpTunnelClient(config, m)
+		}
+		return NewTcpTunnelClient(config, m)
 	case lang.Udp:
 		return NewUdpTunnelClient(config, m)
 	case lang.Http, lang.Https:
 		return NewHttpTunnelClient(config)
+	case lang.Socks5:
+		return NewSocks5TunnelClient(config, m)
 	}
 	return nil, errors.New("unknown tunnel type")
 }
 
 // Open This function opens a TCP tunnel server for a given session.
-func (w *tunnelClientWrapper) Open(session *smux.Session) error {
+func (w *tunnelClientWrapper) Open(session clis.Session) error {
 	// Create a new OpenTunnelReq struct with the proxy ID, tunnel type, and tunnel port.
 	req := &exchange.OpenTunnelReq{
 		ProxyId: w.config.ProxyId,
@@ -149,6 +204,7 @@ func (w *tunnelClientWrapper) Open(session *smux.Session) error {
 		w.config.Destination = rspObj.Destination
 	}
 	w.config.RemotePort = rspObj.RemotePort
+	w.config.Network = lang.Network(rspObj.Network)
 
 	cli.UpdateConnections(session.RemoteAddr().String(), rspObj.RemotePort, w.config.Destination, string(w.config.TunnelType), session.IsClosed())
 
@@ -163,7 +219,7 @@ func (w *tunnelClientWrapper) Open(session *smux.Session) error {
 func (m *MultipleTunnelClient) Close() {
 	m.closeOnce.Do(func() {
 		// Close all sessions
-		m.sessions.Range(func(key string, session *smux.Session) bool {
+		m.sessions.Range(func(key string, session clis.Session) bool {
 			if session != nil && !session.IsClosed() {
 				_ = session.Close()
 			}
@@ -173,16 +229,11 @@ func (m *MultipleTunnelClient) Close() {
 	})
 }
 
+// Close stops serving the tunnel of the wrapper, the session is shared with the other
+// tunnels and is left open.
 func (w *tunnelClientWrapper) Close() {
-	// Wrapper doesn't close the global client
-	// Only remove this session if needed
 	if w.config != nil {
-		if session, ok := w.multiClient.sessions.Load(w.config.ProxyId); ok {
-			if session != nil && !session.IsClosed() {
-				_ = session.Close()
-			}
-			w.multiClient.sessions.Delete(w.config.ProxyId)
-		}
+		w.multiClient.closeTunnel(w.config.ProxyId)
 	}
 }
 
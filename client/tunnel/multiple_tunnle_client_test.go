@@ -0,0 +1,48 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+)
+
+func TestNewTunnelClientQuic(t *testing.T) {
+	relay, err := newTunnelClient(&configs.ClientTunnelConfig{
+		TunnelType:  lang.Quic,
+		Destination: "127.0.0.1:4433",
+		Network:     lang.NetworkUdp,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := relay.(*UdpTunnelClient); !ok {
+		t.Fatalf("quic relaying the packets got %T, want *UdpTunnelClient", relay)
+	}
+	terminate, err := newTunnelClient(&configs.ClientTunnelConfig{
+		TunnelType:  lang.Quic,
+		Destination: "127.0.0.1:8080",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := terminate.(*TcpTunnelClient); !ok {
+		t.Fatalf("terminating quic got %T, want *TcpTunnelClient", terminate)
+	}
+}
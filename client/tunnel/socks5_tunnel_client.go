@@ -0,0 +1,178 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/client/clis"
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/iox"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/socks5"
+	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/transport"
+)
+
+// socks5DialTimeout the time to connect a destination of a socks5 request.
+const socks5DialTimeout = 10 * time.Second
+
+// Socks5TunnelClient serves the SOCKS5 requests of the server, each work connection
+// carries one request and the destination is dialed from the network of the client.
+type Socks5TunnelClient struct {
+	*clis.BaseTunnelClient
+}
+
+func NewSocks5TunnelClient(config *configs.ClientTunnelConfig, _ *MultipleTunnelClient) (*Socks5TunnelClient, error) {
+	tunnelClient := clis.NewBaseTunnelClient(config, false)
+	client := Socks5TunnelClient{
+		BaseTunnelClient: tunnelClient,
+	}
+	client.BaseTunnelClient.DoOpen = client.initOpen
+	return &client, nil
+}
+
+func (t *Socks5TunnelClient) GetName() string {
+	return "Socks5TunnelClient"
+}
+
+func (t *Socks5TunnelClient) initOpen(ch *transport.SChannel) error {
+	err := t.AsyncRegister(t.GetRegisterReq(), func(p *exchange.Protocol, rw io.ReadWriteCloser, _ context.Context) error {
+		if !p.IsSuccess() {
+			log.Error("Socks5 client to server register fail:%v", p.RspMsg)
+			return exchange.CloseError
+		}
+		addHealthyCheckStream(ch)
+		rsp, _ := exchange.Parse[exchange.RegisterReqAndRsp](p.Data)
+		if err := t.OpenWorkerToManager(rsp); err != nil {
+			log.Error("Open worker to manager error:%v", err)
+			return exchange.CloseError
+		}
+		t.serve(ch)
+		log.Debug("Exit handler......%s", rsp.ProxyId)
+		return nil
+	})
+	if err != nil {
+		_ = ch.Close()
+		log.Error("Connection fail %v", err)
+		return err
+	}
+	return nil
+}
+
+// serve waits for the request of the server and answers it with the reply code.
+func (t *Socks5TunnelClient) serve(ch *transport.SChannel) {
+	defer ch.Close()
+	req, err := socks5.ReadRequest(ch)
+	if err != nil {
+		log.Debug("Socks5 read request error: %v", err)
+		return
+	}
+	switch req.Cmd {
+	case socks5.CmdConnect:
+		t.connect(ch, req.Addr)
+	case socks5.CmdUdpAssociate:
+		t.associate(ch)
+	default:
+		_, _ = ch.Write([]byte{socks5.RepCmdNotSupported})
+	}
+}
+
+func (t *Socks5TunnelClient) connect(ch *transport.SChannel, addr string) {
+	dest, err := net.DialTimeout(string(lang.NetworkTcp), addr, socks5DialTimeout)
+	if err != nil {
+		log.Warn("Socks5 connect %s error: %v", addr, err)
+		_, _ = ch.Write([]byte{socks5.ReplyOf(err)})
+		return
+	}
+	if _, err = ch.Write([]byte{socks5.RepSuccess}); err != nil {
+		_ = dest.Close()
+		return
+	}
+	log.Debug("Socks5 connect %s success", addr)
+	errs := iox.Pipe(ch, clis.CountConn(dest, t.GetCfg().ProxyId))
+	log.Debug("Socks5 connect %s closed %v", addr, errs)
+}
+
+// associate sends the datagrams of the work connection to their destinations, and the
+// datagrams coming back prefixed with their source.
+func (t *Socks5TunnelClient) associate(ch *transport.SChannel) {
+	udpConn, err := net.ListenUDP(string(lang.NetworkUdp), nil)
+	if err != nil {
+		log.Warn("Socks5 udp associate error: %v", err)
+		_, _ = ch.Write([]byte{socks5.RepFailure})
+		return
+	}
+	if _, err = ch.Write([]byte{socks5.RepSuccess}); err != nil {
+		_ = udpConn.Close()
+		return
+	}
+	traffic := clis.GetTraffic(t.GetCfg().ProxyId)
+	var closeOnce sync.Once
+	closeAll := func() {
+		closeOnce.Do(func() {
+			_ = udpConn.Close()
+			_ = ch.Close()
+		})
+	}
+	defer closeAll()
+	threading.GoSafe(func() {
+		defer closeAll()
+		buf := make([]byte, 0xffff)
+		for {
+			n, from, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			traffic.Out.Add(int64(n))
+			frame, err := socks5.AppendAddr(make([]byte, 0, 19+n), from.String())
+			if err != nil {
+				continue
+			}
+			if err = socks5.WriteFrame(ch, append(frame, buf[:n]...)); err != nil {
+				return
+			}
+		}
+	})
+	buf := make([]byte, 0xffff)
+	for {
+		n, err := socks5.ReadFrame(ch, buf)
+		if err != nil {
+			return
+		}
+		addr, l, err := socks5.ParseAddr(buf[:n])
+		if err != nil {
+			continue
+		}
+		to, err := net.ResolveUDPAddr(string(lang.NetworkUdp), addr)
+		if err != nil {
+			log.Debug("Socks5 resolve %s error: %v", addr, err)
+			continue
+		}
+		w, err := udpConn.WriteToUDP(buf[l:n], to)
+		if err != nil {
+			log.Debug("Socks5 send to %s error: %v", addr, err)
+			continue
+		}
+		traffic.In.Add(int64(w))
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/proxyproto"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
 )
@@ -49,6 +50,9 @@ func (t *TcpTunnelClient) GetName() string {
 }
 
 func (t *TcpTunnelClient) initOpen(ch *transport.SChannel) error {
+	if t.GetCfg().ProxyProtocol != "" {
+		return t.initProxyOpen(ch)
+	}
 	localConnection, err := t.localConnection()
 	if err != nil {
 		if localConnection != nil {
@@ -92,6 +96,63 @@ func (t *TcpTunnelClient) initOpen(ch *transport.SChannel) error {
 	}
 	return nil
 }
+
+// initProxyOpen registers the work connection without connecting the destination, it is
+// connected once the server tells the address of the visitor, which the PROXY protocol
+// header written first carries to the destination.
+func (t *TcpTunnelClient) initProxyOpen(ch *transport.SChannel) error {
+	err := t.AsyncRegister(t.GetRegisterReq(), func(p *exchange.Protocol, rw io.ReadWriteCloser, _ context.Context) error {
+		if !p.IsSuccess() {
+			log.Error("Client to server register fail:%v", p.RspMsg)
+			return exchange.CloseError
+		}
+		addHealthyCheckStream(ch)
+		rsp, _ := exchange.Parse[exchange.RegisterReqAndRsp](p.Data)
+		if err := t.OpenWorkerToManager(rsp); err != nil {
+			log.Error("Open worker to manager error:%v", err)
+			return exchange.CloseError
+		}
+		t.serveProxy(ch)
+		log.Debug("Exit handler......%s", rsp.ProxyId)
+		return nil
+	})
+	if err != nil {
+		_ = ch.Close()
+		log.Error("Connection fail %v", err)
+		return err
+	}
+	return nil
+}
+
+func (t *TcpTunnelClient) serveProxy(ch *transport.SChannel) {
+	defer ch.Close()
+	h, err := proxyproto.Read(ch)
+	if err != nil {
+		log.Debug("Read visitor address error: %v", err)
+		return
+	}
+	if h.Src == nil {
+		log.Warn("The server didn't tell the visitor address of %s", t.GetCfg().ProxyId)
+		return
+	}
+	header, err := proxyproto.Append(nil, t.GetCfg().ProxyProtocol, h.Src, h.Dst)
+	if err != nil {
+		log.Error("Proxy protocol header of %s error: %v", t.GetCfg().ProxyId, err)
+		return
+	}
+	localConnection, err := t.localConnection()
+	if err != nil {
+		log.Error("Connection local address %v error: %v", t.GetCfg().Destination, err)
+		return
+	}
+	if _, err = localConnection.Write(header); err != nil {
+		_ = localConnection.Close()
+		return
+	}
+	errs := iox.Pipe(ch, localConnection)
+	log.Debug("Visitor %v of %s closed %v", h.Src, t.GetCfg().ProxyId, errs)
+}
+
 func (t *TcpTunnelClient) localConnection() (net.Conn, error) {
 	connFunction := func() (net.Conn, error) {
 		dial, err := net.Dial(string(lang.NetworkTcp), t.GetCfg().Destination)
@@ -99,7 +160,7 @@ func (t *TcpTunnelClient) localConnection() (net.Conn, error) {
 			return nil, err
 		}
 		log.Info("Connection localAddress, %v success", t.GetCfg().Destination)
-		return dial, err
+		return clis.CountConn(dial, t.GetCfg().ProxyId), err
 	}
 	return connFunction()
 }
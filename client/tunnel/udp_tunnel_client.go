@@ -18,7 +18,6 @@ package tunnel
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 	"net"
 	"sync"
@@ -31,6 +30,7 @@ import (
 	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/proxyproto"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
 )
@@ -68,6 +68,8 @@ func (t *UdpTunnelClient) GetName() string {
 
 func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 	stop := make(chan int)
+	ver := exchange.V1
+	traffic := clis.GetTraffic(t.GetCfg().ProxyId)
 	var stopOnce sync.Once
 	safeClose := func() {
 		stopOnce.Do(func() {
@@ -82,10 +84,13 @@ func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 				if err != nil {
 					return err
 				}
+				traffic.Out.Add(int64(n))
 				pk := exchange.NewUdpPackage(buf[:n], nil, remoteAddress)
-				data, err := json.Marshal(pk)
-				_ = bucket.Push(data, nil)
-				return err
+				data, err := exchange.EncodeUdpPackage(pk, ver)
+				if err != nil {
+					return err
+				}
+				return bucket.PushVer(ver, data)
 			}, pool)
 			if err == io.EOF {
 				safeClose()
@@ -102,9 +107,8 @@ func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 
 	revLoop := func(rw io.ReadWriteCloser, bucket *exchange.TunnelBucket) {
 		bucket.DefaultRead(func(p *exchange.TunnelProtocol) {
-			data := p.Data
-			var pk exchange.UdpPackage
-			if err := json.Unmarshal(data, &pk); err != nil {
+			pk, err := exchange.DecodeUdpPackage(p)
+			if err != nil {
 				safeClose()
 				return
 			}
@@ -118,7 +122,8 @@ func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 				safeClose()
 				return
 			}
-			_, err2 := udpConn.Write(p.Data)
+			n, err2 := udpConn.Write(t.datagram(pk))
+			traffic.In.Add(int64(n))
 			if err2 != nil {
 				log.Error("Write to local address error %v", err2)
 				safeClose()
@@ -134,11 +139,17 @@ func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 	err = t.AsyncRegister(t.getReq(), func(p *exchange.Protocol, rw io.ReadWriteCloser, _ context.Context) error {
 		if p.IsSuccess() {
 			log.Info("Connection local address success then Client to server register success:%v", t.GetCfg().Destination)
+			result, err := exchange.Parse[exchange.UdpRegisterReqAndRsp](p.Data)
+			if err != nil || result.RegisterReqAndRsp == nil {
+				log.Error("Parse udp register response error %v", err)
+				return exchange.CloseError
+			}
+			// An old server doesn't answer the version and keeps the json framing.
+			ver = exchange.NegotiateUdpVer(result.Ver)
 			bucket := exchange.NewTunnelBucket(rw, t.TcControl.Context())
 			revLoop(rw, bucket)
 			bucket.Run()
-			result, _ := exchange.Parse[exchange.RegisterReqAndRsp](p.Data)
-			err = t.OpenWorkerToManager(result)
+			err = t.OpenWorkerToManager(result.RegisterReqAndRsp)
 			if err != nil {
 				return exchange.CloseError
 			}
@@ -156,10 +167,30 @@ func (t *UdpTunnelClient) initOpen(*transport.SChannel) (err error) {
 	}
 	return nil
 }
+
+// datagram prefixes the data with the PROXY protocol v2 header of the visitor when the
+// tunnel has the proxy protocol, the tunnel port stands for the address it was sent to.
+func (t *UdpTunnelClient) datagram(pk *exchange.UdpPackage) []byte {
+	if t.GetCfg().ProxyProtocol == "" {
+		return pk.Data
+	}
+	dst := &net.UDPAddr{IP: net.IPv4zero, Port: t.GetCfg().RemotePort}
+	if pk.RemoteAddress.IP.To4() == nil {
+		dst.IP = net.IPv6zero
+	}
+	b, err := proxyproto.Append(make([]byte, 0, 52+len(pk.Data)), proxyproto.V2, pk.RemoteAddress, dst)
+	if err != nil {
+		log.Warn("Proxy protocol header of %s error: %v", t.GetCfg().ProxyId, err)
+		return pk.Data
+	}
+	return append(b, pk.Data...)
+}
+
 func (t *UdpTunnelClient) getReq() *exchange.UdpRegisterReqAndRsp {
 	return &exchange.UdpRegisterReqAndRsp{
 		RegisterReqAndRsp: t.GetRegisterReq(),
 		RemoteAddress:     t.localAddress.String(),
+		Ver:               exchange.UdpBinary,
 	}
 }
 func (t *UdpTunnelClient) localConn(connKey string) (*net.UDPConn, bool, error) {
@@ -0,0 +1,115 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package backoff
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+const (
+	DefaultInitialDelay = time.Second
+	DefaultMaxDelay     = time.Minute
+	DefaultMultiplier   = 2.0
+	DefaultJitter       = 0.2
+)
+
+// Policy is an exponential backoff with jitter, so that many clients losing the same
+// server don't reconnect at the same moment.
+type Policy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	// MaxAttempts gives up after that many failed attempts in a row, 0 never gives up.
+	MaxAttempts int
+}
+
+// DefaultPolicy returns the policy used when none is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialDelay: DefaultInitialDelay,
+		MaxDelay:     DefaultMaxDelay,
+		Multiplier:   DefaultMultiplier,
+		Jitter:       DefaultJitter,
+	}
+}
+
+// FromConfig returns the policy of the config, the missing values are the defaults.
+func FromConfig(cfg *configs.ReconnectConfig) Policy {
+	p := DefaultPolicy()
+	if cfg == nil {
+		return p
+	}
+	if cfg.InitialDelay > 0 {
+		p.InitialDelay = time.Duration(cfg.InitialDelay) * time.Millisecond
+	}
+	if cfg.MaxDelay > 0 {
+		p.MaxDelay = time.Duration(cfg.MaxDelay) * time.Millisecond
+	}
+	if cfg.Multiplier >= 1 {
+		p.Multiplier = cfg.Multiplier
+	}
+	if cfg.Jitter != nil && *cfg.Jitter >= 0 && *cfg.Jitter <= 1 {
+		p.Jitter = *cfg.Jitter
+	}
+	if cfg.MaxAttempts > 0 {
+		p.MaxAttempts = cfg.MaxAttempts
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	return p
+}
+
+// Backoff counts the failed attempts of a policy, it's not safe for concurrent use.
+type Backoff struct {
+	policy   Policy
+	attempts int
+}
+
+func (p Policy) NewBackoff() *Backoff {
+	return &Backoff{policy: p}
+}
+
+// Next returns the delay before the next attempt, false when the attempts are exhausted.
+// The jitter takes a random part of the capped delay off, so the clients waiting for the
+// max delay are still spread out.
+func (b *Backoff) Next() (time.Duration, bool) {
+	if b.policy.MaxAttempts > 0 && b.attempts >= b.policy.MaxAttempts {
+		return 0, false
+	}
+	delay := float64(b.policy.InitialDelay) * math.Pow(b.policy.Multiplier, float64(b.attempts))
+	delay = math.Min(delay, float64(b.policy.MaxDelay))
+	if b.policy.Jitter > 0 {
+		delay -= delay * b.policy.Jitter * rand.Float64()
+	}
+	b.attempts++
+	return time.Duration(delay), true
+}
+
+// Attempts returns the count of the failed attempts in a row.
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Reset starts over after a successful attempt.
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
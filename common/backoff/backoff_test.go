@@ -0,0 +1,120 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	b := Policy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+	}.NewBackoff()
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		d, ok := b.Next()
+		if !ok || d != w*time.Millisecond {
+			t.Fatalf("attempt %d: got %v %v, want %v", i, d, ok, w*time.Millisecond)
+		}
+	}
+	b.Reset()
+	if d, _ := b.Next(); d != 100*time.Millisecond {
+		t.Fatalf("after reset got %v", d)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	b := Policy{
+		InitialDelay: time.Second,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}.NewBackoff()
+	for i := 0; i < 100; i++ {
+		d, _ := b.Next()
+		if d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("delay %v out of range", d)
+		}
+	}
+}
+
+func TestBackoff_MaxAttempts(t *testing.T) {
+	b := Policy{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+		Multiplier:   1,
+		MaxAttempts:  2,
+	}.NewBackoff()
+	for i := 0; i < 2; i++ {
+		if _, ok := b.Next(); !ok {
+			t.Fatalf("attempt %d given up", i)
+		}
+	}
+	if _, ok := b.Next(); ok {
+		t.Fatal("attempts not exhausted")
+	}
+}
+
+func TestBackoff_JitterSpread(t *testing.T) {
+	b := Policy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+		Jitter:       DefaultJitter,
+	}.NewBackoff()
+	for i := 0; i < 4; i++ {
+		b.Next()
+	}
+	// At the max delay the delays stay spread instead of piling up on the cap.
+	atMax := 0
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 200; i++ {
+		d, _ := b.Next()
+		if d < 8*time.Second || d > 10*time.Second {
+			t.Fatalf("delay %v out of range", d)
+		}
+		if d == 10*time.Second {
+			atMax++
+		}
+		delays[d.Truncate(100*time.Millisecond)] = true
+	}
+	if atMax > 2 || len(delays) < 10 {
+		t.Fatalf("delays are not spread: %d at the max, %d buckets", atMax, len(delays))
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	jitter := 2.0
+	p := FromConfig(&configs.ReconnectConfig{InitialDelay: 500, MaxDelay: 100, Jitter: &jitter})
+	if p.InitialDelay != 500*time.Millisecond || p.MaxDelay != 500*time.Millisecond {
+		t.Fatalf("unexpected delays %v %v", p.InitialDelay, p.MaxDelay)
+	}
+	if p.Multiplier != DefaultMultiplier || p.Jitter != DefaultJitter {
+		t.Fatalf("unexpected defaults %v %v", p.Multiplier, p.Jitter)
+	}
+	if p = FromConfig(&configs.ReconnectConfig{MaxAttempts: 3}); p.Jitter != DefaultJitter {
+		t.Fatalf("jitter left out is %v, want the default", p.Jitter)
+	}
+	jitter = 0
+	if p = FromConfig(&configs.ReconnectConfig{Jitter: &jitter}); p.Jitter != 0 {
+		t.Fatalf("jitter turned off is %v", p.Jitter)
+	}
+}
@@ -19,6 +19,7 @@ package configs
 import (
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/g-brook/brook/common/jsonx"
@@ -38,6 +39,55 @@ type ServerConfig struct {
 	WebPort    int                   `json:"webPort"`
 	Tunnel     []*ServerTunnelConfig `json:"tunnel"`
 	Logger     LoggerConfig          `json:"logger"`
+	Tls        *TlsConfig            `json:"tls,omitempty"`
+	//EnableQuic also serves the tunnel port over QUIC (udp), with the tls certificate
+	//or a self-signed one.
+	EnableQuic bool `json:"enableQuic"`
+	//P2pPort is the udp port that tells the clients their public address, so the visitors
+	//of the secret tunnels can connect peer to peer. 0 disables p2p.
+	P2pPort int `json:"p2pPort"`
+	//Metrics exposes the prometheus metrics.
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+	//Acme issues the certificates of the https tunnels that have none.
+	Acme *AcmeConfig `json:"acme,omitempty"`
+}
+
+// AcmeConfig
+// @Description: ACME account used to issue and renew the certificates of the https tunnels
+// without a certificate. DirectoryUrl defaults to Let's Encrypt; point it and CaFile at a
+// local test server such as Pebble to try it out. CacheDir keeps the certificates when the
+// web is disabled, otherwise they are kept in the certificate table.
+type AcmeConfig struct {
+	Enable       bool   `json:"enable"`
+	Email        string `json:"email"`
+	DirectoryUrl string `json:"directoryUrl"`
+	CaFile       string `json:"caFile"`
+	CacheDir     string `json:"cacheDir"`
+	//RenewBefore is the number of days before expiry to renew, 30 by default.
+	RenewBefore int `json:"renewBefore"`
+}
+
+// MetricsConfig
+// @Description: Prometheus metrics endpoint, served on its own port or, when Port is 0,
+// on the web port.
+type MetricsConfig struct {
+	Enable bool   `json:"enable"`
+	Port   int    `json:"port"`
+	Path   string `json:"path"`
+}
+
+// TlsConfig
+// @Description: TLS settings of the server port and tunnel port.
+// On the server, a non-empty CaFile turns on mutual TLS: a client certificate
+// signed by that CA is accepted instead of the token.
+type TlsConfig struct {
+	Enable             bool   `json:"enable"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	CaFile             string `json:"caFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	RequireClientCert  bool   `json:"requireClientCert"`
 }
 
 // LoggerConfig
@@ -60,12 +110,111 @@ type ServerTunnelConfig struct {
 	CertContent string            `json:"-"`
 	IsFileCert  bool              `json:"-"`
 	IpStrategy  string            `json:"-"`
+	//LoadBalance selects among the clients of a tcp or udp tunnel, weighted round robin
+	//by default; clients registered as standby only get traffic when no primary is healthy.
+	LoadBalance *LoadBalanceConfig `json:"loadBalance,omitempty"`
+	//Secret makes a tcp tunnel secret: no public port is opened, only the visitor clients
+	//with the secret reach it.
+	Secret string `json:"secret,omitempty"`
+	//Username and Password authenticate the users of a socks5 tunnel.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	//Terminate makes a quic tunnel end QUIC at the server and forward every stream to a
+	//tcp service of the client; by default the QUIC packets are relayed as they are to the
+	//local QUIC service of the client.
+	Terminate bool `json:"terminate,omitempty"`
+	//Alpn the protocols a terminating quic tunnel negotiates with the visitors, such as h3;
+	//brook's own when empty.
+	Alpn []string `json:"alpn,omitempty"`
+	//ProxyProtocol reads the PROXY protocol v1 or v2 header a load balancer in front of
+	//a tcp, http, https or socks5 tunnel writes, its address of the visitor is used.
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+	//TrustedProxies are the ips or CIDRs of the proxies in front of a http or https tunnel,
+	//only their X-Forwarded-For and Forwarded headers tell the client.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	//Http2 serves a http or https tunnel on HTTP/2 too: h2 by ALPN, h2c; HTTP/1.1 only
+	//when not set.
+	Http2 bool `json:"http2,omitempty"`
 }
 
 type HttpRunnelProxy struct {
-	Id     string   `json:"id"`
-	Domain string   `json:"domain"`
-	Paths  []string `json:"paths"`
+	Id     string `json:"id"`
+	Domain string `json:"domain"`
+	//Paths the route matches, every path when empty; a path only matches itself, not
+	//the prefixes of it, "/api/*" matches "/api" and the paths below it.
+	Paths []string `json:"paths"`
+	//Priority orders the routes of a tunnel, higher first; among equal ones an exact
+	//domain goes before a wildcard one, then the longest path, then the one with rules.
+	Priority int `json:"priority,omitempty"`
+	//Methods, Headers and Query narrow the route down to the requests with one of the
+	//methods and all the headers and query parameters; an empty value only needs it present.
+	Methods []string          `json:"methods,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	//LoadBalance selects among the clients of the route, round robin by default.
+	LoadBalance *LoadBalanceConfig `json:"loadBalance,omitempty"`
+	//KeyFile and CertFile, or the certificate CertId of the web, are presented by an https
+	//tunnel when the SNI matches Domain; the certificate of the tunnel is the fallback.
+	KeyFile     string `json:"keyfile,omitempty"`
+	CertFile    string `json:"certFile,omitempty"`
+	CertId      int    `json:"certId,omitempty"`
+	KeyContent  string `json:"-"`
+	CertContent string `json:"-"`
+	//Rewrite changes the requests of the route to the client and the responses back.
+	Rewrite *HttpRewriteConfig `json:"rewrite,omitempty"`
+	//Timeout limits the requests of the route.
+	Timeout *HttpTimeoutConfig `json:"timeout,omitempty"`
+	//KeepAlive reuses the connections to the client and its local server across the
+	//requests of the route. A reused connection skips the load balance, so it is only kept
+	//with round robin: the weighted, leastConn and hash strategies select per request.
+	KeepAlive bool `json:"keepAlive,omitempty"`
+	//H2c the local server of the route speaks HTTP/2 without TLS, the gRPC requests go so
+	//to it anyway.
+	H2c bool `json:"h2c,omitempty"`
+}
+
+// HttpTimeoutConfig
+// @Description: The timeouts of a http route in seconds, 0 takes the default.
+// Header waits for the response header, 5 by default. Idle waits for the next data of
+// the response body, e.g. the events of a Server-Sent Events stream, and keeps an unused
+// keep-alive connection, 60 by default. Total limits the whole request, none by default.
+type HttpTimeoutConfig struct {
+	Header int `json:"header,omitempty"`
+	Idle   int `json:"idle,omitempty"`
+	Total  int `json:"total,omitempty"`
+}
+
+// HttpRewriteConfig
+// @Description: The path is rewritten in order: StripPrefix is removed, every match of
+// PathRegex is replaced by PathReplace ($1 for its groups), then AddPrefix is added.
+// Host overrides the Host header for a local server with virtual hosts.
+type HttpRewriteConfig struct {
+	StripPrefix     string       `json:"stripPrefix,omitempty"`
+	AddPrefix       string       `json:"addPrefix,omitempty"`
+	PathRegex       string       `json:"pathRegex,omitempty"`
+	PathReplace     string       `json:"pathReplace,omitempty"`
+	Host            string       `json:"host,omitempty"`
+	RequestHeaders  *HeaderRules `json:"requestHeaders,omitempty"`
+	ResponseHeaders *HeaderRules `json:"responseHeaders,omitempty"`
+}
+
+// HeaderRules
+// @Description: Remove deletes the headers, then Set replaces and Append adds a value,
+// e.g. Strict-Transport-Security in the Set of the response headers.
+type HeaderRules struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Append map[string]string `json:"append,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// LoadBalanceConfig
+// @Description: Strategy of a http route: roundRobin, weighted (by the weight of the
+// client tunnel), leastConn (least in-flight requests) or hash.
+// hash is sticky on HashOn: ip (default), cookie or header, named by HashKey.
+type LoadBalanceConfig struct {
+	Strategy string `json:"strategy"`
+	HashOn   string `json:"hashOn,omitempty"`
+	HashKey  string `json:"hashKey,omitempty"`
 }
 
 type ClientTunnelConfig struct {
@@ -73,10 +222,24 @@ type ClientTunnelConfig struct {
 	Destination string          `json:"destination"`
 	ProxyId     string          `json:"proxyId"`
 	HttpId      string          `json:"httpId,omitempty"`
+	//HttpIds are the routes of an http tunnel the client serves, the server delivers all
+	//of them to a managed client; HttpId is the first one for the older clients.
+	HttpIds []string `json:"httpIds,omitempty"`
 	//default 1500
 	UdpSize    int `json:"udpSize,omitempty"`
 	RemotePort int `json:"-"`
-	MaxConn    int `json:"maxConn,omitempty"`
+	//Network the destination takes, set by the server when the tunnel is opened: udp for a
+	//quic tunnel relaying the QUIC packets, the tunnel type tells it when empty.
+	Network lang.Network `json:"-"`
+	MaxConn int          `json:"maxConn,omitempty"`
+	//Weight of the client for the weighted load balancing, default 1.
+	Weight int `json:"weight,omitempty"`
+	//Standby client only gets traffic when no primary client of the tunnel is healthy.
+	Standby bool `json:"standby,omitempty"`
+	//ProxyProtocol v1 or v2 writes the PROXY protocol header with the address of the
+	//visitor to the destination of a tcp, quic or udp tunnel; udp and a quic tunnel relaying
+	//the QUIC packets only have v2.
+	ProxyProtocol string `json:"proxyProtocol,omitempty"`
 }
 
 // GetServerConfig
@@ -118,11 +281,79 @@ func IsExist(cfgPath string) bool {
 // ClientConfig
 // @Description: Description.
 type ClientConfig struct {
-	ServerPort  int                   `json:"serverPort"`
-	ServerHost  string                `json:"serverHost"`
-	ManagerPort int                   `json:"managerPort"`
-	Token       string                `json:"token"`
-	PingTime    time.Duration         `json:"pingTime"`
-	Tunnels     []*ClientTunnelConfig `json:"tunnels"`
-	Logger      *LoggerConfig         `json:"logger,omitempty"`
+	ServerPort  int           `json:"serverPort"`
+	ServerHost  string        `json:"serverHost"`
+	ManagerPort int           `json:"managerPort"`
+	Token       string        `json:"token"`
+	PingTime    time.Duration `json:"pingTime"`
+	//Tunnels the client serves. A client without tunnels and visitors is managed: it
+	//serves the tunnels the server assigns to its client credentials, the shared token
+	//is refused.
+	Tunnels []*ClientTunnelConfig `json:"tunnels"`
+	Logger  *LoggerConfig         `json:"logger,omitempty"`
+	Tls     *TlsConfig            `json:"tls,omitempty"`
+	//Transport of the tunnel connection, tcp (default, smux) or quic.
+	Transport lang.Network `json:"transport"`
+	//Servers the client fails over between, serverHost and serverPort are used when it's empty.
+	Servers []*ServerEndpoint `json:"servers,omitempty"`
+	//ServerStrategy picks the server to connect to, priority (default) or roundRobin.
+	ServerStrategy string `json:"serverStrategy,omitempty"`
+	//Reconnect the policy of reconnecting to the server and retrying the tunnel streams.
+	Reconnect *ReconnectConfig `json:"reconnect,omitempty"`
+	//Visitors connect local ports to the secret tunnels served by other clients.
+	Visitors []*VisitorConfig `json:"visitors,omitempty"`
+}
+
+// VisitorConfig
+// @Description: Bind is the local address, e.g. 127.0.0.1:3306, whose connections go to
+// the secret tunnel of ProxyId. P2p connects to the serving client directly through udp
+// hole punching, and falls back to the server relay when that fails.
+type VisitorConfig struct {
+	ProxyId string `json:"proxyId"`
+	Secret  string `json:"secret"`
+	Bind    string `json:"bind"`
+	P2p     bool   `json:"p2p,omitempty"`
+}
+
+// ReconnectConfig
+// @Description: Exponential backoff of the reconnections, the delays are in milliseconds.
+type ReconnectConfig struct {
+	InitialDelay int     `json:"initialDelay"`
+	MaxDelay     int     `json:"maxDelay"`
+	Multiplier   float64 `json:"multiplier"`
+	//Jitter shortens each delay randomly by up to this fraction of it, 0 to 1, 0.2 when
+	//it's left out and 0 turns it off.
+	Jitter *float64 `json:"jitter,omitempty"`
+	//MaxAttempts gives up after that many failed attempts in a row, 0 never gives up.
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// ServerEndpoint
+// @Description: A server of the client, the lower priority is preferred.
+type ServerEndpoint struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Priority int    `json:"priority"`
+}
+
+func (e ServerEndpoint) String() string {
+	return fmt.Sprintf("%s:%d", e.Host, e.Port)
+}
+
+// ServerEndpoints returns the servers of the client in the order of priority, or the
+// serverHost and serverPort when no servers are configured. Empty entries are skipped.
+func (c *ClientConfig) ServerEndpoints() []ServerEndpoint {
+	endpoints := make([]ServerEndpoint, 0, len(c.Servers))
+	for _, s := range c.Servers {
+		if s != nil {
+			endpoints = append(endpoints, *s)
+		}
+	}
+	if len(endpoints) == 0 {
+		return []ServerEndpoint{{Host: c.ServerHost, Port: c.ServerPort}}
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	return endpoints
 }
@@ -67,6 +67,24 @@ const (
 	UdpRegister Cmd = 7
 
 	ClientWorkerConnReq Cmd = 8
+
+	// PushTunnels the server pushes the tunnels of a client after they changed.
+	PushTunnels Cmd = 9
+
+	// CloseTunnel the client stops serving a tunnel.
+	CloseTunnel Cmd = 10
+
+	// Visit a visitor client connects to a secret tunnel.
+	Visit Cmd = 11
+
+	// P2pVisit a visitor client asks for the address of a client serving a secret tunnel.
+	P2pVisit Cmd = 12
+
+	// P2pOffer the server asks a client serving a secret tunnel to connect to a visitor.
+	P2pOffer Cmd = 13
+
+	// P2pAnswer the client serving the secret tunnel answers with its address.
+	P2pAnswer Cmd = 14
 )
 
 // RspSuccess RspCode.
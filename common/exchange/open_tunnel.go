@@ -29,8 +29,37 @@ type OpenTunnelResp struct {
 	RemotePort  int    `json:"remotePort"`
 	Destination string `json:"destination"`
 	UnId        string `json:"unId"`
+	// Network the destination takes, udp for a quic tunnel relaying the QUIC packets; the
+	// tunnel type tells it when empty.
+	Network string `json:"network,omitempty"`
 }
 
 func (o OpenTunnelResp) Cmd() Cmd {
 	return OpenTunnel
 }
+
+// CloseTunnelReq
+// @Description: The client of the manager channel stops serving the tunnel of the proxy id.
+type CloseTunnelReq struct {
+	ProxyId string `json:"proxy_id"`
+	UnId    string `json:"unId"`
+}
+
+func (o CloseTunnelReq) Cmd() Cmd {
+	return CloseTunnel
+}
+
+// VisitReq
+// @Description: A visitor client connects to the secret tunnel of the proxy id, the stream
+// carries the connection after the response.
+type VisitReq struct {
+	ProxyId string `json:"proxy_id"`
+	Secret  string `json:"secret"`
+	UnId    string `json:"unId"`
+	// SessionKey of the manager channel, see LoginResp.
+	SessionKey string `json:"sessionKey,omitempty"`
+}
+
+func (o VisitReq) Cmd() Cmd {
+	return Visit
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package exchange
+
+// P2pProbe is the datagram a client sends to the p2p port of the server, which answers
+// with P2pProbe followed by the public address it saw. The leading zero byte keeps the
+// datagrams apart from the QUIC packets sharing the udp socket.
+const P2pProbe = "\x00brook-p2p"
+
+// P2pPunch is the datagram the peers send each other to open their NAT mappings.
+const P2pPunch = "\x00brook-punch"
+
+// P2pVisitReq
+// @Description: A visitor client at the public udp address Addr asks to reach the secret
+// tunnel of the proxy id peer to peer.
+type P2pVisitReq struct {
+	ProxyId string `json:"proxy_id"`
+	Secret  string `json:"secret"`
+	UnId    string `json:"unId"`
+	Addr    string `json:"addr"`
+	// SessionKey of the manager channel, see LoginResp.
+	SessionKey string `json:"sessionKey,omitempty"`
+}
+
+func (o P2pVisitReq) Cmd() Cmd {
+	return P2pVisit
+}
+
+// P2pVisitResp
+// @Description: The public udp address of the client serving the tunnel, the visitor
+// proves itself to it with the session id and pins its certificate by CertHash.
+type P2pVisitResp struct {
+	Sid      string `json:"sid"`
+	PeerAddr string `json:"peer_addr"`
+	CertHash string `json:"cert_hash,omitempty"`
+}
+
+func (o P2pVisitResp) Cmd() Cmd {
+	return P2pVisit
+}
+
+// P2pOfferReq
+// @Description: The server asks the client serving the tunnel to connect to the visitor at
+// PeerAddr.
+type P2pOfferReq struct {
+	Sid      string `json:"sid"`
+	ProxyId  string `json:"proxy_id"`
+	PeerAddr string `json:"peer_addr"`
+}
+
+func (o P2pOfferReq) Cmd() Cmd {
+	return P2pOffer
+}
+
+// P2pAnswerReq
+// @Description: The client serving the tunnel answers the offer of the session id with its
+// public udp address and the SHA-256 of its certificate in hex, or the error.
+type P2pAnswerReq struct {
+	Sid      string `json:"sid"`
+	Addr     string `json:"addr"`
+	CertHash string `json:"cert_hash,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (o P2pAnswerReq) Cmd() Cmd {
+	return P2pAnswer
+}
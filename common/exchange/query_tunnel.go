@@ -22,6 +22,9 @@ import (
 
 type LoginReq struct {
 	Token string `json:"token"`
+
+	// Managed clients take their tunnels from the server and get them pushed on changes.
+	Managed bool `json:"managed,omitempty"`
 }
 
 // Cmd
@@ -42,9 +45,26 @@ type LoginResp struct {
 
 	UnId string `json:"un_id"`
 
+	// SessionKey proves the requests of the tunnel connections belong to this session,
+	// unlike UnId it's never shown to anyone else.
+	SessionKey string `json:"session_key,omitempty"`
+
 	Tunnels []*configs.ClientTunnelConfig `json:"tunnels"`
+
+	// P2pPort the udp port the clients learn their public address from, 0 without p2p.
+	P2pPort int `json:"p2p_port,omitempty"`
 }
 
 func (r *LoginReq) QueryTunnelResp() Cmd {
 	return LoginTunnel
 }
+
+// TunnelsPush
+// @Description: The tunnels of a managed client, pushed by the server when they changed.
+type TunnelsPush struct {
+	Tunnels []*configs.ClientTunnelConfig `json:"tunnels"`
+}
+
+func (r *TunnelsPush) Cmd() Cmd {
+	return PushTunnels
+}
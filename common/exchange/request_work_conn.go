@@ -29,6 +29,9 @@ type ClientWorkConnReq struct {
 	HttpId     string `json:"httpId"`
 	TunnelPort int    `json:"tunnelPort"`
 	ServerId   string `json:"serverId"`
+	// UnId and SessionKey of the manager channel, see LoginResp.
+	UnId       string `json:"unId,omitempty"`
+	SessionKey string `json:"sessionKey,omitempty"`
 }
 
 func (r ClientWorkConnReq) Cmd() Cmd {
@@ -58,6 +58,12 @@ func (t *TunnelBucket) Push(data []byte, read TunnelBucketRead) error {
 	return t.bytesBucket.Push(writer.Encode())
 }
 
+// PushVer pushes the data without waiting for a response, framed with the protocol version.
+func (t *TunnelBucket) PushVer(ver int8, data []byte) error {
+	writer := NewTunnelVerWriter(ver, data, t.reqIdIndex.Add(1))
+	return t.bytesBucket.Push(writer.Encode())
+}
+
 // Run is a method of TunnelBucket that starts the tunnel's operation
 func (t *TunnelBucket) Run() *TunnelBucket {
 	t.bytesBucket.AddHandler("Tunnel", t.read)
@@ -25,9 +25,23 @@ import (
 )
 
 var (
-	V1          int8 = 1
+	V1 int8 = 1
+	// WebsocketV1 and WebsocketV2 re-framed the WebSocket messages, they are no longer sent:
+	// an upgraded connection streams as it is. The numbers stay reserved, a client tells an
+	// older server by them, see RegisterReqAndRsp.WebsocketStream for an older client.
 	WebsocketV1 int8 = 2
 	WebsocketV2 int8 = 3
+	// UdpBinary is the binary framing of the udp packages, see UdpPackage.MarshalBinary.
+	UdpBinary int8 = 4
+	// HttpStream carries a part of the http response the client streams, the V1 frame ends it.
+	HttpStream int8 = 5
+	// HttpClose tells the client the server is done with the http request, the client closes
+	// its connection to the local server; old clients ignore it.
+	HttpClose int8 = 6
+
+	// HttpStreamFlag in the attr of the V1 request frames lets the client stream the response
+	// in HttpStream frames, old clients ignore it and answer in one V1 frame.
+	HttpStreamFlag byte = 1
 
 	//protocol defined.
 	lenSize    int32 = 4
@@ -59,25 +73,22 @@ func NewTunnelWriter(data []byte, reqId int64) *TunnelProtocol {
 	}
 }
 
-func NewTunnelWebsocketWriterV1(data []byte, attr []byte, reqId int64) *TunnelProtocol {
-	return &TunnelProtocol{
-		Len:     headerLen + int32(len(attr)) + int32(len(data)),
-		ReqId:   reqId,
-		Ver:     WebsocketV1,
-		Data:    data,
-		AttrLen: int32(len(attr)),
-		Attr:    attr,
-	}
+// NewTunnelVerWriter creates a new instance of TunnelProtocol with the provided version and data.
+func NewTunnelVerWriter(ver int8, data []byte, reqId int64) *TunnelProtocol {
+	writer := NewTunnelWriter(data, reqId)
+	writer.Ver = ver
+	return writer
 }
 
-func NewTunnelWebsocketWriterV2(data []byte, attr []byte, reqId int64) *TunnelProtocol {
+// NewTunnelAttrWriter creates a new instance of TunnelProtocol with the provided version, data and attr.
+func NewTunnelAttrWriter(ver int8, data []byte, attr []byte, reqId int64) *TunnelProtocol {
 	return &TunnelProtocol{
 		Len:     headerLen + int32(len(attr)) + int32(len(data)),
 		ReqId:   reqId,
-		Ver:     WebsocketV2,
+		Ver:     ver,
+		Data:    data,
 		AttrLen: int32(len(attr)),
 		Attr:    attr,
-		Data:    data,
 	}
 }
 
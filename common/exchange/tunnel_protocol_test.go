@@ -27,7 +27,7 @@ func TestNewTunnelRead(t *testing.T) {
 	log.NewLogger(nil)
 	bytes := []byte("test")
 	bytes2 := []byte("attr")
-	writer := NewTunnelWebsocketWriterV2(bytes, bytes2, 100000)
+	writer := NewTunnelAttrWriter(V1, bytes, bytes2, 100000)
 	encode := writer.Encode()
 	t.Log(encode)
 	t.Log("总长度:", len(encode))
@@ -33,6 +33,18 @@ type TRegister interface {
 
 	GetBindId() string
 
+	GetUnId() string
+
+	GetSessionKey() string
+
+	GetWeight() int
+
+	IsStandby() bool
+
+	IsProxyProtocol() bool
+
+	IsWebsocketStream() bool
+
 	IsOpen() bool
 
 	SetServerId(serverId string)
@@ -59,12 +71,55 @@ type RegisterReqAndRsp struct {
 	ServerId string `json:"serverId"`
 
 	Open bool `json:"open"`
+
+	//UnId is the id of the logged-in manager channel.
+	UnId string `json:"unId"`
+
+	//SessionKey of the manager channel, see LoginResp.
+	SessionKey string `json:"sessionKey,omitempty"`
+
+	//Weight of the client for the weighted load balancing.
+	Weight int `json:"weight,omitempty"`
+
+	//Standby client only gets traffic when no primary client is healthy.
+	Standby bool `json:"standby,omitempty"`
+
+	//ProxyProtocol the client reads the address of the visitor before its data.
+	ProxyProtocol bool `json:"proxy_protocol,omitempty"`
+
+	//WebsocketStream the client streams an upgraded WebSocket as it is, the older clients
+	//re-framed it with WebsocketV1 and WebsocketV2.
+	WebsocketStream bool `json:"websocket_stream,omitempty"`
 }
 
 func (r *RegisterReqAndRsp) GetTunnelPort() int {
 	return r.TunnelPort
 }
 
+func (r *RegisterReqAndRsp) GetUnId() string {
+	return r.UnId
+}
+
+func (r *RegisterReqAndRsp) GetSessionKey() string {
+	return r.SessionKey
+}
+
+func (r *RegisterReqAndRsp) GetWeight() int {
+	return r.Weight
+}
+
+func (r *RegisterReqAndRsp) IsStandby() bool {
+	return r.Standby
+}
+
+func (r *RegisterReqAndRsp) IsProxyProtocol() bool {
+	return r.ProxyProtocol
+}
+
+func (r *RegisterReqAndRsp) IsWebsocketStream() bool {
+	return r.WebsocketStream
+}
+
 func (r *RegisterReqAndRsp) GetBindId() string {
 	return r.BindId
 }
@@ -92,6 +147,8 @@ func (r *RegisterReqAndRsp) SetServerId(serverId string) {
 type UdpRegisterReqAndRsp struct {
 	*RegisterReqAndRsp
 	RemoteAddress string `json:"remote_address"`
+	// Ver is the udp framing the client supports, the response carries the negotiated one.
+	Ver int8 `json:"ver,omitempty"`
 }
 
 func (r *UdpRegisterReqAndRsp) Cmd() Cmd {
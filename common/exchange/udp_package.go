@@ -17,9 +17,17 @@
 package exchange
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"net"
 )
 
+// udpAddrSize is the size of the address header of the binary framing: ip length, ip and port.
+const udpAddrSize = 1 + net.IPv6len + 2
+
+var errUdpPackage = errors.New("invalid udp package")
+
 type UdpPackage struct {
 	Data []byte `json:"data"`
 
@@ -47,3 +55,78 @@ func (p *UdpPackage) GetLocalAddress() *net.UDPAddr {
 func (p *UdpPackage) GetData() []byte {
 	return p.Data
 }
+
+// MarshalBinary encodes the remote address and the data as
+// | ip len(1) | ip(4 or 16) | port(2) | data |.
+func (p *UdpPackage) MarshalBinary() ([]byte, error) {
+	var ip net.IP
+	var port int
+	if p.RemoteAddress != nil {
+		port = p.RemoteAddress.Port
+		if ip = p.RemoteAddress.IP.To4(); ip == nil {
+			ip = p.RemoteAddress.IP.To16()
+		}
+	}
+	buf := make([]byte, 1+len(ip)+2+len(p.Data))
+	buf[0] = byte(len(ip))
+	n := 1 + copy(buf[1:], ip)
+	binary.BigEndian.PutUint16(buf[n:], uint16(port))
+	copy(buf[n+2:], p.Data)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes the binary framing, Data shares the memory of data.
+func (p *UdpPackage) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return errUdpPackage
+	}
+	ipLen := int(data[0])
+	if (ipLen != 0 && ipLen != net.IPv4len && ipLen != net.IPv6len) || len(data) < 1+ipLen+2 {
+		return errUdpPackage
+	}
+	port := int(binary.BigEndian.Uint16(data[1+ipLen:]))
+	if ipLen > 0 {
+		p.RemoteAddress = &net.UDPAddr{
+			IP:   net.IP(data[1 : 1+ipLen]),
+			Port: port,
+		}
+	}
+	p.Data = data[1+ipLen+2:]
+	return nil
+}
+
+// EncodeUdpPackage encodes the package in the framing of the tunnel protocol version,
+// UdpBinary or the json of V1.
+func EncodeUdpPackage(p *UdpPackage, ver int8) ([]byte, error) {
+	if ver == UdpBinary {
+		return p.MarshalBinary()
+	}
+	return json.Marshal(p)
+}
+
+// DecodeUdpPackage decodes the package by the version of the tunnel protocol.
+func DecodeUdpPackage(tp *TunnelProtocol) (*UdpPackage, error) {
+	var p UdpPackage
+	var err error
+	if tp.Ver == UdpBinary {
+		err = p.UnmarshalBinary(tp.Data)
+	} else {
+		err = json.Unmarshal(tp.Data, &p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.RemoteAddress == nil {
+		return nil, errUdpPackage
+	}
+	return &p, nil
+}
+
+// NegotiateUdpVer picks the udp framing both sides support, old peers don't send it
+// and fall back to the json framing.
+func NegotiateUdpVer(ver int8) int8 {
+	if ver == UdpBinary {
+		return UdpBinary
+	}
+	return V1
+}
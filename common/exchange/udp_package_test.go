@@ -0,0 +1,101 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exchange
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func udpRoundTrip(t *testing.T, ver int8, addr *net.UDPAddr, data []byte) *UdpPackage {
+	encode, err := EncodeUdpPackage(NewUdpPackage(data, nil, addr), ver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := NewTunnelRead()
+	read.Decode(NewTunnelVerWriter(ver, encode, 1).Encode()[lenSize:])
+	pk, err := DecodeUdpPackage(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pk
+}
+
+func TestUdpPackageBinary(t *testing.T) {
+	addrs := []*net.UDPAddr{
+		{IP: net.ParseIP("192.168.1.10"), Port: 53},
+		{IP: net.ParseIP("2001:db8::1"), Port: 65535},
+	}
+	data := []byte("dns query")
+	for _, ver := range []int8{V1, UdpBinary} {
+		for _, addr := range addrs {
+			pk := udpRoundTrip(t, ver, addr, data)
+			if pk.RemoteAddress.String() != addr.String() {
+				t.Fatalf("ver %d: address %v, want %v", ver, pk.RemoteAddress, addr)
+			}
+			if !bytes.Equal(pk.Data, data) {
+				t.Fatalf("ver %d: data %q, want %q", ver, pk.Data, data)
+			}
+		}
+	}
+	pk := udpRoundTrip(t, UdpBinary, addrs[0], nil)
+	if len(pk.Data) != 0 {
+		t.Fatalf("empty data decoded as %q", pk.Data)
+	}
+}
+
+func TestUdpPackageBinaryInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, {4, 1}, {5, 1, 2, 3, 4, 5, 0, 53}, {16, 1, 2, 3, 4, 0, 53}} {
+		if _, err := DecodeUdpPackage(&TunnelProtocol{Ver: UdpBinary, Data: data}); err == nil {
+			t.Fatalf("decode %v, want error", data)
+		}
+	}
+}
+
+func TestNegotiateUdpVer(t *testing.T) {
+	if NegotiateUdpVer(0) != V1 || NegotiateUdpVer(V1) != V1 || NegotiateUdpVer(UdpBinary) != UdpBinary {
+		t.Fatal("negotiate udp version")
+	}
+}
+
+func benchmarkUdpPackage(b *testing.B, ver int8) {
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 27015}
+	data := bytes.Repeat([]byte{0x5a}, 1200)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encode, err := EncodeUdpPackage(NewUdpPackage(data, nil, addr), ver)
+		if err != nil {
+			b.Fatal(err)
+		}
+		frame := NewTunnelVerWriter(ver, encode, int64(i)).Encode()
+		read := NewTunnelRead()
+		read.Decode(frame[lenSize:])
+		if _, err = DecodeUdpPackage(read); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUdpPackageJson(b *testing.B) {
+	benchmarkUdpPackage(b, V1)
+}
+
+func BenchmarkUdpPackageBinary(b *testing.B) {
+	benchmarkUdpPackage(b, UdpBinary)
+}
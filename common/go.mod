@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/klauspost/compress v1.18.2
 	github.com/panjf2000/gnet/v2 v2.9.5
+	github.com/quic-go/quic-go v0.58.0
 	github.com/spf13/cobra v1.10.2
 	github.com/xtaci/smux v1.5.47
 	golang.org/x/sys v0.40.0
@@ -14,11 +15,12 @@ require (
 )
 
 require (
-
 	github.com/godbus/dbus/v5 v5.2.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
 	github.com/tidwall/match v1.2.0 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
 )
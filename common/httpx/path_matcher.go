@@ -32,16 +32,15 @@ type node struct {
 	isParam    bool
 	isWildcard bool
 	handler    interface{}
+	// path the pattern added for the node, set when the node has a handler.
+	path string
 }
 
-func NewPathMatcher(handler interface{}) *PathMatcher {
+func NewPathMatcher() *PathMatcher {
 	return &PathMatcher{
 		Root: &node{
-			segment:    "",
-			children:   make([]*node, 0),
-			isParam:    false,
-			isWildcard: false,
-			handler:    handler,
+			segment:  "",
+			children: make([]*node, 0),
 		},
 	}
 }
@@ -74,7 +73,6 @@ func (r *PathMatcher) AddPathMatcher(path string, handler interface{}) {
 				children:   make([]*node, 0),             // Initialize empty children slice
 				isParam:    strings.HasPrefix(part, ":"), // Check if it's a parameter
 				isWildcard: strings.HasPrefix(part, "*"), // Check if it's a wildcard
-				handler:    handler,
 			}
 			// Add the new child to current node's children
 			cur.children = append(cur.children, child)
@@ -82,12 +80,13 @@ func (r *PathMatcher) AddPathMatcher(path string, handler interface{}) {
 		// Move to the child node for next iteration
 		cur = child
 	}
-	// Set the handler for the final node
+	// Only the final node matches, not the nodes of the prefixes of the path
 	cur.handler = handler
+	cur.path = "/" + strings.Join(parts, "/")
 }
 
 // Match checks if a given path matches the routing tree
-// It returns a MatchResult indicating whether the path was matched and any extracted parameters
+// It returns a MatchResult indicating whether the path was matched and the pattern it matched
 func (r *PathMatcher) Match(path string) MatchResult {
 	// Split the input path into its components
 	parts := splitPath(path)
@@ -99,6 +98,8 @@ func (r *PathMatcher) Match(path string) MatchResult {
 	if ok && node.handler != nil {
 		return MatchResult{
 			Matched: true,
+			Path:    node.path,
+			Handler: node.handler,
 		}
 	}
 	// Otherwise return failure
@@ -109,6 +110,8 @@ func (r *PathMatcher) Match(path string) MatchResult {
 
 // matchNode is a recursive function that matches a URL path against a tree of nodes.
 // It checks if the given path parts match the route structure and extracts any parameters.
+// At every level an exact segment is tried before a parameter, and a parameter before a
+// wildcard, whatever order the paths were added in.
 //
 // Parameters:
 //
@@ -121,24 +124,35 @@ func (r *PathMatcher) Match(path string) MatchResult {
 //	*node - The matched node if successful, nil otherwise
 //	bool - True if a match was found, false otherwise
 func matchNode(n *node, parts []string, params map[string]string) (*node, bool) {
-	// Base case: if there are no more parts to match, we've successfully matched the path
+	// Base case: if there are no more parts to match, the node itself or a wildcard
+	// child, that matches the empty rest, is the match
 	if len(parts) == 0 {
-		return n, true
+		if n.handler != nil {
+			return n, true
+		}
+		for _, child := range n.children {
+			if child.isWildcard && child.handler != nil {
+				params[child.segment[1:]] = ""
+				return child, true
+			}
+		}
+		return nil, false
 	}
 
 	// Get the first part of the path to match against current node's children
 	part := parts[0]
-	// Iterate through all children of the current node
+	// Case 1: Exact match with current segment
 	for _, child := range n.children {
-		switch {
-		// Case 1: Exact match with current segment
-		case child.segment == part:
+		if !child.isParam && !child.isWildcard && child.segment == part {
 			// Recursively match the remaining parts
 			if res, ok := matchNode(child, parts[1:], params); ok {
 				return res, true
 			}
-		// Case 2: Parameter match (segment starts with ':')
-		case child.isParam:
+		}
+	}
+	// Case 2: Parameter match (segment starts with ':')
+	for _, child := range n.children {
+		if child.isParam {
 			// Extract parameter name (without the leading ':')
 			key := child.segment[1:]
 			// Store the parameter value in the params map
@@ -149,8 +163,11 @@ func matchNode(n *node, parts []string, params map[string]string) (*node, bool)
 			}
 			// If matching fails, remove the parameter from the map
 			delete(params, key)
-		// Case 3: Wildcard match (segment starts with '*')
-		case child.isWildcard:
+		}
+	}
+	// Case 3: Wildcard match (segment starts with '*')
+	for _, child := range n.children {
+		if child.isWildcard && child.handler != nil {
 			// Extract wildcard parameter name (without the leading '*')
 			key := child.segment[1:]
 			// Join all remaining parts to form the wildcard parameter value
@@ -163,8 +180,11 @@ func matchNode(n *node, parts []string, params map[string]string) (*node, bool)
 	return nil, false
 }
 
+// MatchResult is the result of a match, Path is the pattern that matched.
 type MatchResult struct {
 	Matched bool
+	Path    string
+	Handler interface{}
 }
 
 func splitPath(path string) []string {
@@ -181,3 +201,33 @@ func splitPath(path string) []string {
 
 	return parts
 }
+
+// ComparePath orders the patterns from the most to the least specific: the longer path
+// first, then the one with more exact segments, then the one without a wildcard.
+func ComparePath(a, b string) int {
+	ra, rb := pathRank(a), pathRank(b)
+	for i := range ra {
+		if ra[i] != rb[i] {
+			return rb[i] - ra[i]
+		}
+	}
+	return 0
+}
+
+// pathRank the segments before a wildcard, the exact ones, and 1 without a wildcard.
+func pathRank(path string) [3]int {
+	var rank [3]int
+	rank[2] = 1
+	for _, part := range splitPath(path) {
+		switch {
+		case strings.HasPrefix(part, "*"):
+			rank[2] = 0
+		case strings.HasPrefix(part, ":"):
+			rank[0]++
+		default:
+			rank[0]++
+			rank[1]++
+		}
+	}
+	return rank
+}
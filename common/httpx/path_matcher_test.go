@@ -61,8 +61,11 @@ func TestAddAndGetPathMatcher(t *testing.T) {
 		testName string
 	}{
 		{"/index/aaa/bbb", true, "Wildcard match"},
+		{"/index", true, "Wildcard match of the empty rest"},
 		{"/ok/aaa/bbb", false, "No match"},
 		{"/user/aaa/bbb", true, "Parametric match"},
+		{"/user/a/b/c/d/e/f", false, "Too long"},
+		{"/", true, "Root match"},
 	}
 
 	for _, result := range matchResults {
@@ -74,3 +77,52 @@ func TestAddAndGetPathMatcher(t *testing.T) {
 		})
 	}
 }
+
+func TestPathMatcherPrecedence(t *testing.T) {
+	matcher := httpx.NewPathMatcher()
+	for _, path := range []string{"/api/*", "/api/:id", "/api/users", "/static/js/*"} {
+		matcher.AddPathMatcher(path, path)
+	}
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"/api/users", "/api/users"},
+		{"/api/42", "/api/:id"},
+		{"/api/42/detail", "/api/*"},
+		{"/static/js/app.js", "/static/js/*"},
+		{"/static", ""},
+		{"/", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			match := matcher.Match(tc.input)
+			if match.Path != tc.expected || match.Matched != (tc.expected != "") {
+				t.Errorf("For input %s, expected %q but got %q", tc.input, tc.expected, match.Path)
+			}
+			if match.Matched && match.Handler != tc.expected {
+				t.Errorf("For input %s, expected handler %q but got %v", tc.input, tc.expected, match.Handler)
+			}
+		})
+	}
+}
+
+func TestComparePath(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"/api/v1/*", "/api/*", -1},
+		{"/api/users", "/api/:id", -1},
+		{"/api/:id", "/api/*", -1},
+		{"/api/:id", "/api/:name", 0},
+		{"/*", "/", 1},
+		{"/", "/api", 1},
+	}
+	for _, tc := range testCases {
+		got := httpx.ComparePath(tc.a, tc.b)
+		if (got < 0) != (tc.expected < 0) || (got > 0) != (tc.expected > 0) {
+			t.Errorf("ComparePath(%s, %s) = %d, expected %d", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
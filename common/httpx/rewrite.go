@@ -0,0 +1,103 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpx
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+// Rewriter is the compiled rewrite of a http route.
+type Rewriter struct {
+	cfg       *configs.HttpRewriteConfig
+	pathRegex *regexp.Regexp
+}
+
+// NewRewriter compiles the rewrite, it's nil without one.
+func NewRewriter(cfg *configs.HttpRewriteConfig) (*Rewriter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	r := &Rewriter{cfg: cfg}
+	if cfg.PathRegex != "" {
+		re, err := regexp.Compile(cfg.PathRegex)
+		if err != nil {
+			return nil, err
+		}
+		r.pathRegex = re
+	}
+	return r, nil
+}
+
+// Path rewrites the path of a request.
+func (r *Rewriter) Path(path string) string {
+	if prefix := strings.TrimSuffix(r.cfg.StripPrefix, "/"); prefix != "" {
+		if path == prefix {
+			path = "/"
+		} else if strings.HasPrefix(path, prefix+"/") {
+			path = path[len(prefix):]
+		}
+	}
+	if r.pathRegex != nil {
+		path = r.pathRegex.ReplaceAllString(path, r.cfg.PathReplace)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if prefix := strings.TrimSuffix(r.cfg.AddPrefix, "/"); prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		path = prefix + path
+	}
+	return path
+}
+
+// Request rewrites the request to the client.
+func (r *Rewriter) Request(req *http.Request) {
+	if r.cfg.StripPrefix != "" || r.pathRegex != nil || r.cfg.AddPrefix != "" {
+		req.URL.Path = r.Path(req.URL.Path)
+		req.URL.RawPath = ""
+	}
+	if r.cfg.Host != "" {
+		req.Host = r.cfg.Host
+	}
+	applyHeaderRules(req.Header, r.cfg.RequestHeaders)
+}
+
+// Response rewrites the headers of the response.
+func (r *Rewriter) Response(header http.Header) {
+	applyHeaderRules(header, r.cfg.ResponseHeaders)
+}
+
+func applyHeaderRules(header http.Header, rules *configs.HeaderRules) {
+	if rules == nil || header == nil {
+		return
+	}
+	for _, key := range rules.Remove {
+		header.Del(key)
+	}
+	for key, value := range rules.Set {
+		header.Set(key, value)
+	}
+	for key, value := range rules.Append {
+		header.Add(key, value)
+	}
+}
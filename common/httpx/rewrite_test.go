@@ -0,0 +1,91 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpx_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/httpx"
+)
+
+func TestRewriterPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      configs.HttpRewriteConfig
+		input    string
+		expected string
+	}{
+		{"Strip prefix", configs.HttpRewriteConfig{StripPrefix: "/api/"}, "/api/users", "/users"},
+		{"Strip the whole path", configs.HttpRewriteConfig{StripPrefix: "/api"}, "/api", "/"},
+		{"Strip only a segment", configs.HttpRewriteConfig{StripPrefix: "/api"}, "/apix/users", "/apix/users"},
+		{"Add prefix", configs.HttpRewriteConfig{AddPrefix: "/v1/"}, "/users", "/v1/users"},
+		{"Regex", configs.HttpRewriteConfig{PathRegex: `^/old/(.*)$`, PathReplace: "/new/$1"}, "/old/a/b", "/new/a/b"},
+		{"In order", configs.HttpRewriteConfig{StripPrefix: "/api", PathRegex: `^/u/`, PathReplace: "users/", AddPrefix: "/v2"}, "/api/u/1", "/v2/users/1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := httpx.NewRewriter(&tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Path(tc.input); got != tc.expected {
+				t.Errorf("Path(%s) = %s, expected %s", tc.input, got, tc.expected)
+			}
+		})
+	}
+	if _, err := httpx.NewRewriter(&configs.HttpRewriteConfig{PathRegex: "("}); err == nil {
+		t.Errorf("Expected an error of an invalid regex")
+	}
+	if r, err := httpx.NewRewriter(nil); r != nil || err != nil {
+		t.Errorf("Expected no rewriter without a config")
+	}
+}
+
+func TestRewriterHeaders(t *testing.T) {
+	r, _ := httpx.NewRewriter(&configs.HttpRewriteConfig{
+		Host: "local.test",
+		RequestHeaders: &configs.HeaderRules{
+			Set:    map[string]string{"X-Env": "prod"},
+			Append: map[string]string{"Via": "brook"},
+			Remove: []string{"Cookie"},
+		},
+		ResponseHeaders: &configs.HeaderRules{
+			Set:    map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+			Remove: []string{"Server"},
+		},
+	})
+	req := &http.Request{
+		Host:   "public.test",
+		URL:    &url.URL{Path: "/a"},
+		Header: http.Header{"X-Env": {"dev"}, "Via": {"lb"}, "Cookie": {"a=b"}},
+	}
+	r.Request(req)
+	if req.Host != "local.test" || req.URL.Path != "/a" {
+		t.Errorf("Unexpected host %s or path %s", req.Host, req.URL.Path)
+	}
+	if req.Header.Get("X-Env") != "prod" || len(req.Header.Values("Via")) != 2 || req.Header.Get("Cookie") != "" {
+		t.Errorf("Unexpected request headers %v", req.Header)
+	}
+	header := http.Header{"Server": {"nginx"}}
+	r.Response(header)
+	if header.Get("Server") != "" || header.Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("Unexpected response headers %v", header)
+	}
+}
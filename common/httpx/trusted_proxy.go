@@ -0,0 +1,128 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	XForwardedFor = "X-Forwarded-For"
+	Forwarded     = "Forwarded"
+	XRealIp       = "X-Real-Ip"
+)
+
+// TrustedProxies are the proxies in front of the server, e.g. a load balancer, whose
+// X-Forwarded-For and Forwarded headers tell the client.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses the ips and CIDRs of the trusted proxies, the invalid ones
+// are returned in bad.
+func ParseTrustedProxies(list []string) (proxies TrustedProxies, bad []string) {
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if ip, err := netip.ParseAddr(item); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+		} else {
+			bad = append(bad, item)
+		}
+	}
+	return
+}
+
+// Contains tells if the ip is a trusted proxy.
+func (t TrustedProxies) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIp recovers the client of a request from the peer. The hops of the Forwarded,
+// or else the X-Forwarded-For, header are walked from the right while they are trusted
+// proxies; the first one that isn't is the client. The headers of an untrusted peer are
+// ignored, anyone could have written them.
+func (t TrustedProxies) ClientIp(peer netip.Addr, header http.Header) netip.Addr {
+	client := peer.Unmap()
+	if !t.Contains(client) {
+		return client
+	}
+	hops := forwardedHops(header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseHop(hops[i])
+		if !ok {
+			break
+		}
+		client = ip
+		if !t.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedHops returns the for= of the Forwarded header or the X-Forwarded-For, the
+// proxies append to the right.
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values(Forwarded) {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, value := range header.Values(XForwardedFor) {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseHop parses an ip, optionally with a port or in brackets; obfuscated identifiers and
+// unknown aren't ips.
+func parseHop(hop string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(hop); err == nil {
+		return ip.Unmap(), true
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	ip, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpx
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedProxiesClientIp(t *testing.T) {
+	proxies, bad := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::ffff:172.16.0.1", "bogus"})
+	if len(bad) != 1 || bad[0] != "bogus" {
+		t.Fatalf("bad = %v", bad)
+	}
+	testCases := []struct {
+		name     string
+		peer     string
+		header   http.Header
+		expected string
+	}{
+		{
+			name:     "Untrusted peer ignores the header",
+			peer:     "203.0.113.9",
+			header:   http.Header{XForwardedFor: {"1.2.3.4"}},
+			expected: "203.0.113.9",
+		},
+		{
+			name:     "Trusted peer without header",
+			peer:     "10.1.2.3",
+			header:   http.Header{},
+			expected: "10.1.2.3",
+		},
+		{
+			name:     "Rightmost untrusted hop",
+			peer:     "10.1.2.3",
+			header:   http.Header{XForwardedFor: {"6.6.6.6, 1.2.3.4", "192.168.1.1"}},
+			expected: "1.2.3.4",
+		},
+		{
+			name:     "Mapped peer and hop with port",
+			peer:     "::ffff:172.16.0.1",
+			header:   http.Header{XForwardedFor: {"1.2.3.4:5678"}},
+			expected: "1.2.3.4",
+		},
+		{
+			name:     "Forwarded wins",
+			peer:     "10.1.2.3",
+			header:   http.Header{XForwardedFor: {"6.6.6.6"}, Forwarded: {`for=1.2.3.4;proto=https, for="[2001:db8::1]:4711"`}},
+			expected: "2001:db8::1",
+		},
+		{
+			name:     "Obfuscated hop stops the walk",
+			peer:     "10.1.2.3",
+			header:   http.Header{Forwarded: {"for=1.2.3.4, for=_hidden"}},
+			expected: "10.1.2.3",
+		},
+		{
+			name:     "All hops trusted",
+			peer:     "10.1.2.3",
+			header:   http.Header{XForwardedFor: {"10.9.9.9"}},
+			expected: "10.9.9.9",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := proxies.ClientIp(netip.MustParseAddr(tc.peer), tc.header)
+			if got.String() != tc.expected {
+				t.Errorf("ClientIp() = %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
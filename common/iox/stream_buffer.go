@@ -0,0 +1,103 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iox
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// StreamBuffer is a goroutine safe buffer between a writer that never blocks and a reader
+// that waits for the data, the frames of a stream are read through it as one byte stream.
+type StreamBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	notify chan struct{}
+	err    error
+}
+
+// NewStreamBuffer creates an open StreamBuffer.
+func NewStreamBuffer() *StreamBuffer {
+	return &StreamBuffer{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Write appends the data for the reader, io.ErrClosedPipe once the buffer is closed.
+func (s *StreamBuffer) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	n, err = s.buf.Write(p)
+	s.mu.Unlock()
+	s.signal()
+	return n, err
+}
+
+// Read waits for the data, after the close it still reads what is buffered before the error.
+func (s *StreamBuffer) Read(p []byte) (n int, err error) {
+	for {
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, err = s.buf.Read(p)
+			s.mu.Unlock()
+			return n, err
+		}
+		err = s.err
+		s.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		<-s.notify
+	}
+}
+
+// Close closes the buffer, the reader gets io.EOF after the buffered data.
+func (s *StreamBuffer) Close() error {
+	return s.CloseWithError(nil)
+}
+
+// CloseWithError closes the buffer, the reader gets err after the buffered data, io.EOF when nil.
+func (s *StreamBuffer) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// IsClosed tells whether the buffer is closed.
+func (s *StreamBuffer) IsClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err != nil
+}
+
+func (s *StreamBuffer) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
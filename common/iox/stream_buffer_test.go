@@ -0,0 +1,83 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStreamBufferWaitsForData(t *testing.T) {
+	s := NewStreamBuffer()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = s.Write([]byte("hello "))
+		time.Sleep(20 * time.Millisecond)
+		_, _ = s.Write([]byte("world"))
+		_ = s.Close()
+	}()
+	b, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello world" {
+		t.Fatalf("read %q", b)
+	}
+}
+
+func TestStreamBufferClose(t *testing.T) {
+	s := NewStreamBuffer()
+	_, _ = s.Write([]byte("left"))
+	cut := errors.New("cut")
+	_ = s.CloseWithError(cut)
+	_ = s.Close()
+	if !s.IsClosed() {
+		t.Fatal("not closed")
+	}
+	if _, err := s.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Fatalf("write after close: %v", err)
+	}
+	p := make([]byte, 8)
+	n, err := s.Read(p)
+	if err != nil || string(p[:n]) != "left" {
+		t.Fatalf("read %q %v", p[:n], err)
+	}
+	if _, err = s.Read(p); err != cut {
+		t.Fatalf("read after data: %v", err)
+	}
+}
+
+func TestStreamBufferCloseWakesReader(t *testing.T) {
+	s := NewStreamBuffer()
+	done := make(chan error)
+	go func() {
+		_, err := s.Read(make([]byte, 8))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = s.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatalf("read: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader not woken")
+	}
+}
@@ -24,12 +24,17 @@ const (
 	Https TunnelType = "https"
 	Tcp   TunnelType = "tcp"
 	Udp   TunnelType = "udp"
+	Quic  TunnelType = "quic"
+	//Socks5 serves SOCKS5 on the remote port, the client dials the destinations.
+	Socks5 TunnelType = "socks5"
 )
 
 const NetworkTcp = Network(Tcp)
 
 const NetworkUdp = Network(Udp)
 
+const NetworkQuic = Network(Quic)
+
 type Number interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~float32 | ~float64
 }
@@ -18,10 +18,46 @@ package loadbalance
 
 var defaultBalance = NewRoundRobin()
 
+// Strategy is the name of a load balancing strategy.
+type Strategy string
+
+const (
+	StrategyRoundRobin Strategy = "roundRobin"
+	StrategyWeighted   Strategy = "weighted"
+	StrategyLeastConn  Strategy = "leastConn"
+	StrategyHash       Strategy = "hash"
+)
+
+// WeightFunc get the weight of a channel.
+type WeightFunc func(id string) int
+
+// LoadFunc get the in-flight requests of a channel.
+type LoadFunc func(id string) int
+
 type Balance interface {
 	Select(channels []string) string
 }
 
+// HashBalance selects by a key of the request, the same key sticks to the same channel.
+type HashBalance interface {
+	Balance
+	SelectByKey(channels []string, key string) string
+}
+
+// NewBalance creates the balance of the strategy, round robin when the strategy is unknown.
+func NewBalance(strategy Strategy, weight WeightFunc, load LoadFunc) Balance {
+	switch strategy {
+	case StrategyWeighted:
+		return NewWeightedRoundRobin(weight)
+	case StrategyLeastConn:
+		return NewLeastConn(load)
+	case StrategyHash:
+		return NewConsistentHash(defaultReplicas)
+	default:
+		return NewRoundRobin()
+	}
+}
+
 func Select(channels []string) string {
 	return defaultBalance.Select(channels)
 }
@@ -0,0 +1,108 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"hash/crc32"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultReplicas = 160
+
+type hashRing struct {
+	channels []string
+	hashes   []uint32
+	owners   map[uint32]string
+}
+
+// ConsistentHash selects by the hash of a key on a ring of virtual nodes, so adding or
+// removing a channel only moves the keys of that channel.
+type ConsistentHash struct {
+	replicas int
+	lock     sync.Mutex
+	ring     *hashRing
+}
+
+func NewConsistentHash(replicas int) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &ConsistentHash{
+		replicas: replicas,
+	}
+}
+
+func (c *ConsistentHash) Select(channels []string) string {
+	return c.SelectByKey(channels, "")
+}
+
+func (c *ConsistentHash) SelectByKey(channels []string, key string) string {
+	if len(channels) == 0 {
+		return ""
+	}
+	if key == "" {
+		// Without a key there is nothing to stick to.
+		return defaultBalance.Select(channels)
+	}
+	ring := c.getRing(channels)
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= h
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.owners[ring.hashes[i]]
+}
+
+// getRing returns the ring of the channels, it's rebuilt only when the channels change.
+func (c *ConsistentHash) getRing(channels []string) *hashRing {
+	sorted := slices.Clone(channels)
+	slices.Sort(sorted)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ring != nil && slices.Equal(c.ring.channels, sorted) {
+		return c.ring
+	}
+	ring := &hashRing{
+		channels: sorted,
+		hashes:   make([]uint32, 0, len(sorted)*c.replicas),
+		owners:   make(map[uint32]string, len(sorted)*c.replicas),
+	}
+	var b strings.Builder
+	for _, ch := range sorted {
+		for i := 0; i < c.replicas; i++ {
+			b.Reset()
+			b.WriteString(ch)
+			b.WriteByte('#')
+			b.WriteString(strconv.Itoa(i))
+			h := crc32.ChecksumIEEE([]byte(b.String()))
+			if _, ok := ring.owners[h]; ok {
+				continue
+			}
+			ring.owners[h] = ch
+			ring.hashes = append(ring.hashes, h)
+		}
+	}
+	slices.Sort(ring.hashes)
+	c.ring = ring
+	return ring
+}
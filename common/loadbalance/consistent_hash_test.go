@@ -0,0 +1,51 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConsistentHash_SelectByKey(t *testing.T) {
+	ch := NewConsistentHash(0)
+	channels := []string{"a", "b", "c", "d"}
+	selected := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		key := "10.0.0." + strconv.Itoa(i)
+		selected[key] = ch.SelectByKey(channels, key)
+		if again := ch.SelectByKey([]string{"d", "c", "b", "a"}, key); again != selected[key] {
+			t.Fatalf("key %s moved from %s to %s with the same channels", key, selected[key], again)
+		}
+	}
+	moved := 0
+	for key, s := range selected {
+		now := ch.SelectByKey([]string{"a", "b", "c"}, key)
+		if s != "d" && now != s {
+			moved++
+		}
+		if now == "d" {
+			t.Fatalf("key %s selected the removed channel", key)
+		}
+	}
+	if moved != 0 {
+		t.Fatalf("%d keys of the remaining channels moved", moved)
+	}
+	if ch.SelectByKey(nil, "k") != "" {
+		t.Fatal("no channel should select nothing")
+	}
+}
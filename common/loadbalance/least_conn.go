@@ -0,0 +1,55 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"sync/atomic"
+)
+
+// LeastConn selects the channel with the least in-flight requests, the channels
+// with the same load take turns.
+type LeastConn struct {
+	load  LoadFunc
+	index atomic.Uint64
+}
+
+func NewLeastConn(load LoadFunc) *LeastConn {
+	return &LeastConn{
+		load: load,
+	}
+}
+
+func (l *LeastConn) Select(channels []string) string {
+	if len(channels) == 0 {
+		return ""
+	}
+	if l.load == nil {
+		return defaultBalance.Select(channels)
+	}
+	start := int(l.index.Add(1) % uint64(len(channels)))
+	selected := ""
+	least := 0
+	for i := 0; i < len(channels); i++ {
+		c := channels[(start+i)%len(channels)]
+		load := l.load(c)
+		if selected == "" || load < least {
+			selected = c
+			least = load
+		}
+	}
+	return selected
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"testing"
+)
+
+func TestLeastConn_Select(t *testing.T) {
+	loads := map[string]int{"a": 3, "b": 1, "c": 2}
+	lc := NewLeastConn(func(id string) int {
+		return loads[id]
+	})
+	for i := 0; i < 5; i++ {
+		if s := lc.Select([]string{"a", "b", "c"}); s != "b" {
+			t.Fatalf("selected %s, want b", s)
+		}
+	}
+	loads["b"] = 3
+	loads["c"] = 3
+	counts := map[string]int{}
+	for i := 0; i < 30; i++ {
+		counts[lc.Select([]string{"a", "b", "c"})]++
+	}
+	if counts["a"] != 10 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("ties should take turns, got %v", counts)
+	}
+}
@@ -53,11 +53,22 @@ func (w *WeightedRoundRobin) setWeight(weight int) {
 type RoundRobin struct {
 	weighted *hash.SyncMap[string, *WeightedRoundRobin]
 	lock     sync.Mutex
+	weight   WeightFunc
 }
 
 func NewRoundRobin() *RoundRobin {
+	return NewWeightedRoundRobin(nil)
+}
+
+// NewWeightedRoundRobin creates a smooth weighted round robin, the weight of a channel
+// below 1 is taken as 1.
+func NewWeightedRoundRobin(weight WeightFunc) *RoundRobin {
+	if weight == nil {
+		weight = getWeight
+	}
 	return &RoundRobin{
 		weighted: hash.NewSyncMap[string, *WeightedRoundRobin](),
+		weight:   weight,
 	}
 }
 
@@ -73,7 +84,7 @@ func (r *RoundRobin) Select(channels []string) string {
 	var selRr *WeightedRoundRobin
 	for _, c := range channels {
 		id := c
-		weight := getWeight(id)
+		weight := max(r.weight(id), 1)
 		load, b := r.weighted.Load(id)
 		if !b {
 			r.lock.Lock()
@@ -87,6 +98,7 @@ func (r *RoundRobin) Select(channels []string) string {
 		if weight != load.weight {
 			load.setWeight(weight)
 		}
+		load.lastUpdate = now
 		cur := load.add()
 		if cur > maxCurrent {
 			maxCurrent = cur
@@ -27,3 +27,17 @@ func TestRoundRobin_Select(t *testing.T) {
 		t.Log(robin.Select(strings))
 	}
 }
+
+func TestWeightedRoundRobin_Select(t *testing.T) {
+	weights := map[string]int{"a": 5, "b": 1, "c": 0}
+	robin := NewWeightedRoundRobin(func(id string) int {
+		return weights[id]
+	})
+	counts := map[string]int{}
+	for i := 0; i < 70; i++ {
+		counts[robin.Select([]string{"a", "b", "c"})]++
+	}
+	if counts["a"] != 50 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+}
@@ -95,10 +95,12 @@ func initLogger(setting *LoggerSetting) {
 		core := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level)
 		cores = append(cores, core)
 	}
-	if setting.outs.Contains("cli") && writers["cli"] != nil {
-		syncer := writers["cli"]
-		core := zapcore.NewCore(encoder, syncer, level)
-		cores = append(cores, core)
+	// Writers added by AddWriter, e.g. cli, are used when named in the outs.
+	for key, syncer := range writers {
+		if setting.outs.Contains(key) {
+			core := zapcore.NewCore(encoder, syncer, level)
+			cores = append(cores, core)
+		}
 	}
 	if setting.outs.Contains("file") {
 		core := zapcore.NewCore(encoder, fileWriter, level)
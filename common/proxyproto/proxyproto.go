@@ -0,0 +1,260 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package proxyproto writes and parses the PROXY protocol header (v1 and v2), which tells
+// a service the address of the original client of a proxied connection.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+const (
+	v1Prefix = "PROXY "
+	// v1MaxLen the longest v1 line, the CRLF included.
+	v1MaxLen  = 107
+	v2HeadLen = 16
+
+	v2CmdLocal = 0x20
+	v2CmdProxy = 0x21
+
+	v2FamilyInet  = 0x10
+	v2FamilyInet6 = 0x20
+	v2ProtoStream = 0x01
+	v2ProtoDgram  = 0x02
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	// ErrNoHeader the data doesn't start with a PROXY protocol header.
+	ErrNoHeader = errors.New("proxyproto: no header")
+	// ErrIncomplete more data is needed to parse the header.
+	ErrIncomplete = errors.New("proxyproto: incomplete header")
+	ErrInvalid    = errors.New("proxyproto: invalid header")
+)
+
+// Header is a parsed header. Src and Dst are nil when the proxy didn't tell them, for a
+// v2 LOCAL command or an UNKNOWN connection.
+type Header struct {
+	Version int
+	Src     net.Addr
+	Dst     net.Addr
+}
+
+// IsValid tells if the version is one the header can be written in.
+func IsValid(version string) bool {
+	return version == V1 || version == V2
+}
+
+// Append appends the header of the version telling that src connected to dst. The
+// network of src, tcp or udp, is the protocol of the header; v1 only has tcp.
+func Append(b []byte, version string, src, dst net.Addr) ([]byte, error) {
+	srcAp, err := netip.ParseAddrPort(src.String())
+	if err != nil {
+		return nil, err
+	}
+	dstAp, err := netip.ParseAddrPort(dst.String())
+	if err != nil {
+		return nil, err
+	}
+	srcIp, dstIp := srcAp.Addr().Unmap(), dstAp.Addr().Unmap()
+	inet4 := srcIp.Is4() && dstIp.Is4()
+	if !inet4 {
+		srcIp, dstIp = netip.AddrFrom16(srcIp.As16()), netip.AddrFrom16(dstIp.As16())
+	}
+	dgram := strings.HasPrefix(src.Network(), "udp")
+	switch version {
+	case V1:
+		if dgram {
+			return nil, errors.New("proxyproto: v1 has no udp")
+		}
+		family := "TCP6"
+		if inet4 {
+			family = "TCP4"
+		}
+		return fmt.Appendf(b, "PROXY %s %s %s %d %d\r\n", family, srcIp, dstIp, srcAp.Port(), dstAp.Port()), nil
+	case V2:
+		family := byte(v2FamilyInet6)
+		if inet4 {
+			family = v2FamilyInet
+		}
+		proto := byte(v2ProtoStream)
+		if dgram {
+			proto = v2ProtoDgram
+		}
+		b = append(b, v2Signature...)
+		b = append(b, v2CmdProxy, family|proto)
+		b = binary.BigEndian.AppendUint16(b, uint16(2*srcIp.BitLen()/8+4))
+		b = append(b, srcIp.AsSlice()...)
+		b = append(b, dstIp.AsSlice()...)
+		b = binary.BigEndian.AppendUint16(b, srcAp.Port())
+		return binary.BigEndian.AppendUint16(b, dstAp.Port()), nil
+	}
+	return nil, fmt.Errorf("proxyproto: unknown version %s", version)
+}
+
+// Parse parses the header at the start of b, n is the length it takes. It returns
+// ErrIncomplete when b is the beginning of a header, and ErrNoHeader when it isn't.
+func Parse(b []byte) (h *Header, n int, err error) {
+	if len(b) < len(v2Signature) && bytes.HasPrefix(v2Signature, b) {
+		return nil, 0, ErrIncomplete
+	}
+	if bytes.HasPrefix(b, v2Signature) {
+		if len(b) < v2HeadLen {
+			return nil, 0, ErrIncomplete
+		}
+		n = v2HeadLen + int(binary.BigEndian.Uint16(b[14:16]))
+		if len(b) < n {
+			return nil, 0, ErrIncomplete
+		}
+		h, err = parseV2(b[12], b[13], b[v2HeadLen:n])
+		return h, n, err
+	}
+	if len(b) < len(v1Prefix) {
+		if strings.HasPrefix(v1Prefix, string(b)) {
+			return nil, 0, ErrIncomplete
+		}
+		return nil, 0, ErrNoHeader
+	}
+	if string(b[:len(v1Prefix)]) != v1Prefix {
+		return nil, 0, ErrNoHeader
+	}
+	end := bytes.IndexByte(b[:min(len(b), v1MaxLen)], '\n')
+	if end < 0 {
+		if len(b) >= v1MaxLen {
+			return nil, 0, ErrInvalid
+		}
+		return nil, 0, ErrIncomplete
+	}
+	h, err = parseV1(string(b[:end+1]))
+	return h, end + 1, err
+}
+
+// Read reads the header from r, without reading any byte after it.
+func Read(r io.Reader) (*Header, error) {
+	b := make([]byte, len(v2Signature), v1MaxLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(b, v2Signature) {
+		b = b[:v2HeadLen]
+		if _, err := io.ReadFull(r, b[len(v2Signature):]); err != nil {
+			return nil, err
+		}
+		b = append(b, make([]byte, binary.BigEndian.Uint16(b[14:16]))...)
+		if _, err := io.ReadFull(r, b[v2HeadLen:]); err != nil {
+			return nil, err
+		}
+	} else {
+		if string(b[:len(v1Prefix)]) != v1Prefix {
+			return nil, ErrNoHeader
+		}
+		one := make([]byte, 1)
+		for b[len(b)-1] != '\n' && len(b) < v1MaxLen {
+			if _, err := io.ReadFull(r, one); err != nil {
+				return nil, err
+			}
+			b = append(b, one[0])
+		}
+	}
+	h, _, err := Parse(b)
+	if errors.Is(err, ErrIncomplete) {
+		return nil, ErrInvalid
+	}
+	return h, err
+}
+
+func parseV1(line string) (*Header, error) {
+	if !strings.HasSuffix(line, "\r\n") {
+		return nil, ErrInvalid
+	}
+	fields := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{Version: 1}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalid
+	}
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Version: 1, Src: net.TCPAddrFromAddrPort(src), Dst: net.TCPAddrFromAddrPort(dst)}, nil
+}
+
+func parseV1Addr(ip, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.AddrPort{}, ErrInvalid
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, ErrInvalid
+	}
+	return netip.AddrPortFrom(addr, uint16(p)), nil
+}
+
+func parseV2(verCmd, famProto byte, body []byte) (*Header, error) {
+	h := &Header{Version: 2}
+	switch verCmd {
+	case v2CmdLocal:
+		return h, nil
+	case v2CmdProxy:
+	default:
+		return nil, ErrInvalid
+	}
+	var ipLen int
+	switch famProto & 0xf0 {
+	case v2FamilyInet:
+		ipLen = 4
+	case v2FamilyInet6:
+		ipLen = 16
+	default:
+		//Unix sockets and unspecified families carry no address we can use.
+		return h, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, ErrInvalid
+	}
+	src, _ := netip.AddrFromSlice(body[:ipLen])
+	dst, _ := netip.AddrFromSlice(body[ipLen : 2*ipLen])
+	srcAp := netip.AddrPortFrom(src, binary.BigEndian.Uint16(body[2*ipLen:]))
+	dstAp := netip.AddrPortFrom(dst, binary.BigEndian.Uint16(body[2*ipLen+2:]))
+	switch famProto & 0x0f {
+	case v2ProtoStream:
+		h.Src, h.Dst = net.TCPAddrFromAddrPort(srcAp), net.TCPAddrFromAddrPort(dstAp)
+	case v2ProtoDgram:
+		h.Src, h.Dst = net.UDPAddrFromAddrPort(srcAp), net.UDPAddrFromAddrPort(dstAp)
+	}
+	return h, nil
+}
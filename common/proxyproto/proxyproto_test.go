@@ -0,0 +1,90 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestAppend_V1(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}
+	b, err := Append(nil, V1, src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "PROXY TCP4 192.0.2.1 10.0.0.1 5000 80\r\n" {
+		t.Fatalf("got %q", b)
+	}
+	if _, err = Append(nil, V1, &net.UDPAddr{IP: src.IP, Port: 1}, dst); err == nil {
+		t.Fatal("v1 udp accepted")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []struct {
+		version  string
+		src, dst net.Addr
+	}{
+		{V1, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}},
+		{V1, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}},
+		{V2, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}},
+		{V2, &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 5353}},
+	}
+	for _, c := range cases {
+		b, err := Append(nil, c.version, c.src, c.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, "data"...)
+		h, n, err := Parse(b)
+		if err != nil || string(b[n:]) != "data" {
+			t.Fatalf("%s: parse %v %q", c.version, err, b[n:])
+		}
+		if h.Src.String() != c.src.String() || h.Dst.String() != c.dst.String() || h.Src.Network() != c.src.Network() {
+			t.Fatalf("%s: got %v %v, want %v %v", c.version, h.Src, h.Dst, c.src, c.dst)
+		}
+		r := bytes.NewReader(b)
+		if h, err = Read(r); err != nil || h.Src.String() != c.src.String() || r.Len() != len("data") {
+			t.Fatalf("%s: read %v %v, %d left", c.version, h, err, r.Len())
+		}
+	}
+}
+
+func TestParse_Incomplete(t *testing.T) {
+	b, _ := Append(nil, V2, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2})
+	for _, l := range []int{1, 12, 16, len(b) - 1} {
+		if _, _, err := Parse(b[:l]); !errors.Is(err, ErrIncomplete) {
+			t.Fatalf("%d bytes: got %v", l, err)
+		}
+	}
+	if _, _, err := Parse([]byte("PROXY TCP4 1.2.3.4")); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("v1 got %v", err)
+	}
+	if _, _, err := Parse([]byte("GET / HTTP/1.1\r\n")); !errors.Is(err, ErrNoHeader) {
+		t.Fatalf("http got %v", err)
+	}
+}
+
+func TestParse_Unknown(t *testing.T) {
+	h, n, err := Parse([]byte("PROXY UNKNOWN\r\n"))
+	if err != nil || n != 15 || h.Src != nil {
+		t.Fatalf("got %v %d %v", h, n, err)
+	}
+}
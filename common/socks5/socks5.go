@@ -0,0 +1,359 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package socks5 implements the server side of SOCKS5 (RFC 1928) with the username and
+// password authentication (RFC 1929), and the frames a socks5 tunnel carries on its work
+// connections.
+package socks5
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+const (
+	Version = 0x05
+
+	MethodNoAuth       = 0x00
+	MethodUserPass     = 0x02
+	MethodNoAcceptable = 0xff
+
+	userPassVersion = 0x01
+
+	CmdConnect      = 0x01
+	CmdUdpAssociate = 0x03
+
+	AtypIPv4   = 0x01
+	AtypDomain = 0x03
+	AtypIPv6   = 0x04
+
+	RepSuccess            = 0x00
+	RepFailure            = 0x01
+	RepNetworkUnreachable = 0x03
+	RepHostUnreachable    = 0x04
+	RepConnectionRefused  = 0x05
+	RepCmdNotSupported    = 0x07
+	RepAtypNotSupported   = 0x08
+)
+
+var (
+	ErrVersion        = errors.New("socks5: unsupported version")
+	ErrAuth           = errors.New("socks5: authentication failed")
+	ErrCmd            = errors.New("socks5: unsupported command")
+	ErrAtyp           = errors.New("socks5: unsupported address type")
+	ErrFragment       = errors.New("socks5: fragmented datagram")
+	ErrShortDatagram  = errors.New("socks5: short datagram")
+	ErrFrameTooLarge  = errors.New("socks5: frame too large")
+	errNoAcceptMethod = errors.New("socks5: no acceptable method")
+)
+
+// Request is the command of a SOCKS5 client, Addr is the destination as host:port.
+type Request struct {
+	Cmd  byte
+	Addr string
+}
+
+// Handshake authenticates the SOCKS5 client with the username and the password, none
+// when the username is empty, then reads its request. A request that can't be served is
+// answered with the failure before the error is returned.
+func Handshake(rw io.ReadWriter, username, password string) (*Request, error) {
+	if err := negotiate(rw, username, password); err != nil {
+		return nil, err
+	}
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(rw, head); err != nil {
+		return nil, err
+	}
+	if head[0] != Version {
+		return nil, ErrVersion
+	}
+	addr, err := ReadAddr(rw)
+	if err != nil {
+		if errors.Is(err, ErrAtyp) {
+			_ = WriteReply(rw, RepAtypNotSupported, "")
+		}
+		return nil, err
+	}
+	if head[1] != CmdConnect && head[1] != CmdUdpAssociate {
+		_ = WriteReply(rw, RepCmdNotSupported, "")
+		return nil, ErrCmd
+	}
+	return &Request{Cmd: head[1], Addr: addr}, nil
+}
+
+func negotiate(rw io.ReadWriter, username, password string) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(rw, head); err != nil {
+		return err
+	}
+	if head[0] != Version {
+		return ErrVersion
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(rw, methods); err != nil {
+		return err
+	}
+	method := byte(MethodNoAuth)
+	if username != "" {
+		method = MethodUserPass
+	}
+	if !slices.Contains(methods, method) {
+		_, _ = rw.Write([]byte{Version, MethodNoAcceptable})
+		return errNoAcceptMethod
+	}
+	if _, err := rw.Write([]byte{Version, method}); err != nil {
+		return err
+	}
+	if method == MethodNoAuth {
+		return nil
+	}
+	return authenticate(rw, username, password)
+}
+
+func authenticate(rw io.ReadWriter, username, password string) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(rw, head); err != nil {
+		return err
+	}
+	if head[0] != userPassVersion {
+		return ErrVersion
+	}
+	user, err := readString(rw, int(head[1]))
+	if err != nil {
+		return err
+	}
+	plen := make([]byte, 1)
+	if _, err = io.ReadFull(rw, plen); err != nil {
+		return err
+	}
+	pass, err := readString(rw, int(plen[0]))
+	if err != nil {
+		return err
+	}
+	userOk := subtle.ConstantTimeCompare([]byte(user), []byte(username))
+	passOk := subtle.ConstantTimeCompare([]byte(pass), []byte(password))
+	if userOk&passOk != 1 {
+		_, _ = rw.Write([]byte{userPassVersion, 0x01})
+		return ErrAuth
+	}
+	_, err = rw.Write([]byte{userPassVersion, 0x00})
+	return err
+}
+
+// WriteReply answers the request with the reply code and the bound address, zeros when
+// bind is empty.
+func WriteReply(w io.Writer, rep byte, bind string) error {
+	if bind == "" {
+		bind = "0.0.0.0:0"
+	}
+	b, err := AppendAddr([]byte{Version, rep, 0x00}, bind)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// ReplyOf maps the error of dialing the destination to a reply code.
+func ReplyOf(err error) byte {
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return RepSuccess
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return RepConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return RepNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.As(err, &dnsErr), errors.Is(err, syscall.ETIMEDOUT):
+		return RepHostUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RepHostUnreachable
+	}
+	return RepFailure
+}
+
+// ReadAddr reads an address as ATYP, ADDR and PORT.
+func ReadAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp[0] {
+	case AtypIPv4, AtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if atyp[0] == AtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case AtypDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(r, l); err != nil {
+			return "", err
+		}
+		domain, err := readString(r, int(l[0]))
+		if err != nil {
+			return "", err
+		}
+		host = domain
+	default:
+		return "", ErrAtyp
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// ParseAddr parses the address at the start of b, n is the length it takes.
+func ParseAddr(b []byte) (addr string, n int, err error) {
+	if len(b) < 1 {
+		return "", 0, ErrShortDatagram
+	}
+	switch b[0] {
+	case AtypIPv4:
+		n = 1 + net.IPv4len
+	case AtypIPv6:
+		n = 1 + net.IPv6len
+	case AtypDomain:
+		if len(b) < 2 {
+			return "", 0, ErrShortDatagram
+		}
+		n = 2 + int(b[1])
+	default:
+		return "", 0, ErrAtyp
+	}
+	if len(b) < n+2 {
+		return "", 0, ErrShortDatagram
+	}
+	var host string
+	if b[0] == AtypDomain {
+		host = string(b[2:n])
+	} else {
+		host = net.IP(b[1:n]).String()
+	}
+	port := binary.BigEndian.Uint16(b[n : n+2])
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), n + 2, nil
+}
+
+// AppendAddr appends the address as ATYP, ADDR and PORT.
+func AppendAddr(b []byte, addr string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: invalid port %s", port)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(append(b, AtypIPv4), ip4...)
+		} else {
+			b = append(append(b, AtypIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("socks5: domain too long %s", host)
+		}
+		b = append(append(b, AtypDomain, byte(len(host))), host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(p)), nil
+}
+
+// ParseDatagram parses a SOCKS5 UDP datagram into the address and the data, fragments
+// are not supported.
+func ParseDatagram(b []byte) (addr string, data []byte, err error) {
+	if len(b) < 3 {
+		return "", nil, ErrShortDatagram
+	}
+	if b[2] != 0 {
+		return "", nil, ErrFragment
+	}
+	addr, n, err := ParseAddr(b[3:])
+	if err != nil {
+		return "", nil, err
+	}
+	return addr, b[3+n:], nil
+}
+
+// WriteRequest writes the request on the work connection, the client answers with a reply
+// code.
+func WriteRequest(w io.Writer, req *Request) error {
+	b, err := AppendAddr([]byte{req.Cmd}, req.Addr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// ReadRequest reads the request written by WriteRequest.
+func ReadRequest(r io.Reader) (*Request, error) {
+	cmd := make([]byte, 1)
+	if _, err := io.ReadFull(r, cmd); err != nil {
+		return nil, err
+	}
+	addr, err := ReadAddr(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{Cmd: cmd[0], Addr: addr}, nil
+}
+
+// WriteFrame writes a datagram of an udp association on the work connection, it is
+// prefixed with its length.
+func WriteFrame(w io.Writer, b []byte) error {
+	if len(b) > 0xffff {
+		return ErrFrameTooLarge
+	}
+	frame := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(b)), uint16(len(b)))
+	_, err := w.Write(append(frame, b...))
+	return err
+}
+
+// ReadFrame reads a datagram written by WriteFrame into buf, which holds 65535 bytes.
+func ReadFrame(r io.Reader, buf []byte) (int, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(head))
+	if n > len(buf) {
+		return 0, ErrFrameTooLarge
+	}
+	return io.ReadFull(r, buf[:n])
+}
+
+func readString(r io.Reader, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
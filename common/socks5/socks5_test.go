@@ -0,0 +1,113 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package socks5
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// conn replays the bytes of the client and records the answers of the server.
+type conn struct {
+	io.Reader
+	out bytes.Buffer
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+func TestHandshake_UserPass(t *testing.T) {
+	in := []byte{Version, 1, MethodUserPass}
+	in = append(in, userPassVersion, 4, 'u', 's', 'e', 'r', 4, 'p', 'a', 's', 's')
+	in = append(in, Version, CmdConnect, 0, AtypDomain, 9, 'l', 'o', 'c', 'a', 'l', 'h', 'o', 's', 't', 0x1f, 0x90)
+	c := &conn{Reader: bytes.NewReader(in)}
+	req, err := Handshake(c, "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Cmd != CmdConnect || req.Addr != "localhost:8080" {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	if !bytes.Equal(c.out.Bytes(), []byte{Version, MethodUserPass, userPassVersion, 0}) {
+		t.Fatalf("unexpected answers %v", c.out.Bytes())
+	}
+}
+
+func TestHandshake_WrongPassword(t *testing.T) {
+	in := []byte{Version, 1, MethodUserPass, userPassVersion, 1, 'u', 1, 'x'}
+	c := &conn{Reader: bytes.NewReader(in)}
+	if _, err := Handshake(c, "u", "p"); !errors.Is(err, ErrAuth) {
+		t.Fatalf("got %v, want ErrAuth", err)
+	}
+}
+
+func TestHandshake_NoAuthRefused(t *testing.T) {
+	c := &conn{Reader: bytes.NewReader([]byte{Version, 1, MethodNoAuth})}
+	if _, err := Handshake(c, "u", "p"); err == nil {
+		t.Fatal("no auth accepted")
+	}
+	if !bytes.Equal(c.out.Bytes(), []byte{Version, MethodNoAcceptable}) {
+		t.Fatalf("unexpected answers %v", c.out.Bytes())
+	}
+}
+
+func TestAddr_RoundTrip(t *testing.T) {
+	for _, addr := range []string{"10.0.0.1:22", "[fe80::1]:443", "db.lan:5432"} {
+		b, err := AppendAddr(nil, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, n, err := ParseAddr(b)
+		if err != nil || got != addr || n != len(b) {
+			t.Fatalf("parse %s: got %s %d %v", addr, got, n, err)
+		}
+		got, err = ReadAddr(bytes.NewReader(b))
+		if err != nil || got != addr {
+			t.Fatalf("read %s: got %s %v", addr, got, err)
+		}
+	}
+}
+
+func TestParseDatagram(t *testing.T) {
+	b, _ := AppendAddr([]byte{0, 0, 0}, "1.2.3.4:53")
+	addr, data, err := ParseDatagram(append(b, 'q'))
+	if err != nil || addr != "1.2.3.4:53" || string(data) != "q" {
+		t.Fatalf("got %s %q %v", addr, data, err)
+	}
+	b[2] = 1
+	if _, _, err = ParseDatagram(b); !errors.Is(err, ErrFragment) {
+		t.Fatalf("got %v, want ErrFragment", err)
+	}
+	if _, _, err = ParseDatagram(b[:5]); err == nil {
+		t.Fatal("short datagram parsed")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, []byte("one"))
+	_ = WriteFrame(&buf, []byte("two"))
+	b := make([]byte, 0xffff)
+	for _, want := range []string{"one", "two"} {
+		n, err := ReadFrame(&buf, b)
+		if err != nil || string(b[:n]) != want {
+			t.Fatalf("got %q %v, want %q", b[:n], err, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tlsx builds the crypto/tls configs used by the server port and
+// tunnel port from configs.TlsConfig.
+package tlsx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+// IsEnable reports whether the given config turns TLS on.
+func IsEnable(cfg *configs.TlsConfig) bool {
+	return cfg != nil && cfg.Enable
+}
+
+// HasCertificate reports whether the given config carries a certificate pair.
+func HasCertificate(cfg *configs.TlsConfig) bool {
+	return IsEnable(cfg) && cfg.CertFile != "" && cfg.KeyFile != ""
+}
+
+// NewServerConfig
+//
+//	@Description: Build the tls.Config of a listener. When a CA file is set the
+//	peer certificate is verified against it, and required if RequireClientCert is true.
+//	@param cfg
+//	@return *tls.Config nil when TLS is disabled.
+//	@return error
+func NewServerConfig(cfg *configs.TlsConfig) (*tls.Config, error) {
+	if !IsEnable(cfg) {
+		return nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls: certFile and keyFile are required on the server")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: load key pair error: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.CaFile != "" {
+		pool, err := loadCertPool(cfg.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// NewClientConfig
+//
+//	@Description: Build the tls.Config of a dialer. The certificate pair is optional
+//	and only sent when the server asks for it.
+//	@param cfg
+//	@return *tls.Config nil when TLS is disabled.
+//	@return error
+func NewClientConfig(cfg *configs.TlsConfig) (*tls.Config, error) {
+	if !IsEnable(cfg) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CaFile != "" {
+		pool, err := loadCertPool(cfg.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load key pair error: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// IsVerifiedPeer reports whether conn is a TLS connection whose peer presented
+// a certificate that passed verification.
+func IsVerifiedPeer(conn net.Conn) bool {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return false
+	}
+	state := tc.ConnectionState()
+	return state.HandshakeComplete && len(state.VerifiedChains) > 0
+}
+
+// NewSelfSignedCertificate generates a throwaway certificate for listeners that
+// must speak TLS, such as QUIC, when no certificate is configured.
+func NewSelfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "brook"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("tls: read ca file error: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificate found in %s", file)
+	}
+	return pool, nil
+}
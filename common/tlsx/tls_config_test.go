@@ -0,0 +1,170 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tlsx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, dir, name string, parent *testCert, isCa bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  isCa,
+		BasicConstraintsValid: true,
+	}
+	signCert, signKey := tpl, key
+	if parent != nil {
+		signCert, signKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signCert, &key.PublicKey, signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	_ = os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return &testCert{cert: cert, key: key}
+}
+
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (*tls.Conn, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errCh := make(chan error, 1)
+	go func() {
+		cc, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err == nil {
+			// TLS 1.3 reports a rejected client certificate on the first read.
+			_ = cc.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = cc.Read(make([]byte, 1))
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				err = nil
+			}
+			_ = cc.Close()
+		}
+		errCh <- err
+	}()
+	sc, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := tls.Server(sc, serverCfg)
+	err = server.Handshake()
+	if err != nil {
+		_ = server.Close()
+	}
+	if cerr := <-errCh; err == nil {
+		err = cerr
+	}
+	return server, err
+}
+
+func TestMutualTls(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true)
+	newTestCert(t, dir, "brook.server", ca, false)
+	newTestCert(t, dir, "brook.client", ca, false)
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	serverCfg, err := NewServerConfig(&configs.TlsConfig{
+		Enable:   true,
+		CertFile: path("brook.server.crt"),
+		KeyFile:  path("brook.server.key"),
+		CaFile:   path("ca.crt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCfg, err := NewClientConfig(&configs.TlsConfig{
+		Enable:     true,
+		CertFile:   path("brook.client.crt"),
+		KeyFile:    path("brook.client.key"),
+		CaFile:     path("ca.crt"),
+		ServerName: "brook.server",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := handshake(t, serverCfg, clientCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsVerifiedPeer(conn) {
+		t.Error("client certificate should be verified")
+	}
+
+	anonymous, _ := NewClientConfig(&configs.TlsConfig{
+		Enable:     true,
+		CaFile:     path("ca.crt"),
+		ServerName: "brook.server",
+	})
+	conn, err = handshake(t, serverCfg, anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsVerifiedPeer(conn) {
+		t.Error("connection without client certificate should not be verified")
+	}
+
+	serverCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if _, err = handshake(t, serverCfg, anonymous); err == nil {
+		t.Error("client certificate is required")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	cfg, err := NewServerConfig(&configs.TlsConfig{Enable: false})
+	if cfg != nil || err != nil {
+		t.Error("disabled tls should return nil config")
+	}
+	if _, err = NewServerConfig(&configs.TlsConfig{Enable: true}); err == nil {
+		t.Error("server without certificate should fail")
+	}
+}
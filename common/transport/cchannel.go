@@ -0,0 +1,175 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/common/lang"
+	"github.com/google/uuid"
+)
+
+// CChannel is a Channel over a plain net.Conn, one channel per connection.
+// It is used where a connection is not multiplexed by smux, e.g. the server
+// port running over TLS.
+type CChannel struct {
+	conn        net.Conn
+	id          string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	attr        map[lang.KeyType]interface{}
+	closeEvents []CloseEvent
+	lastTime    time.Time
+	active      time.Time
+	once        sync.Once
+}
+
+// NewCChannel creates a new CChannel with the given connection.
+func NewCChannel(conn net.Conn, parent context.Context) *CChannel {
+	ctx, cancelFunc := context.WithCancel(parent)
+	return &CChannel{
+		conn:        conn,
+		ctx:         ctx,
+		id:          uuid.NewString(),
+		cancel:      cancelFunc,
+		attr:        map[lang.KeyType]interface{}{},
+		closeEvents: make([]CloseEvent, 0),
+		lastTime:    time.Now(),
+		active:      time.Now(),
+	}
+}
+
+func (c *CChannel) SendTo([]byte, net.Addr) (int, error) {
+	return 0, nil
+}
+
+// Close closes the CChannel by closing the underlying connection
+func (c *CChannel) Close() error {
+	c.once.Do(func() {
+		_ = c.conn.Close()
+		c.cancel()
+		for _, event := range c.closeEvents {
+			if event != nil {
+				event(c)
+			}
+		}
+		clear(c.closeEvents)
+	})
+	return nil
+}
+
+func (c *CChannel) ActiveTime() time.Time {
+	return c.active
+}
+
+// SetDeadline sets the deadline for both read and write operations
+func (c *CChannel) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for read operations
+func (c *CChannel) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for write operations
+func (c *CChannel) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// GetConn returns the underlying connection
+func (c *CChannel) GetConn() net.Conn {
+	return c.conn
+}
+
+// RemoteAddr returns the remote network address
+func (c *CChannel) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// LocalAddr returns the local network address
+func (c *CChannel) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *CChannel) AddAttr(key lang.KeyType, value interface{}) {
+	c.attr[key] = value
+}
+
+func (c *CChannel) OnClose(event CloseEvent) {
+	c.closeEvents = append(c.closeEvents, event)
+}
+
+func (c *CChannel) IsClose() bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *CChannel) GetAttr(key lang.KeyType) (interface{}, bool) {
+	value, ok := c.attr[key]
+	return value, ok
+}
+
+// Read reads data into p
+func (c *CChannel) Read(p []byte) (n int, err error) {
+	if c.IsClose() {
+		return 0, io.EOF
+	}
+	c.lastTime = time.Now()
+	return c.conn.Read(p)
+}
+
+// Write writes data from p
+func (c *CChannel) Write(p []byte) (n int, err error) {
+	if c.IsClose() {
+		return 0, io.EOF
+	}
+	if len(p) > 0 {
+		n, err = c.conn.Write(p)
+	}
+	return
+}
+
+// GetReader returns the reader for this channel
+func (c *CChannel) GetReader() io.Reader {
+	return c
+}
+
+// GetWriter returns the writer for this channel
+func (c *CChannel) GetWriter() io.Writer {
+	return c
+}
+
+func (c *CChannel) GetId() string {
+	return c.id
+}
+
+func (c *CChannel) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+func (c *CChannel) LastTime() time.Time {
+	return c.lastTime
+}
@@ -27,16 +27,15 @@ import (
 
 	"github.com/g-brook/brook/common/lang"
 	"github.com/google/uuid"
-	"github.com/xtaci/smux"
 )
 
 // SChannel struct holds the secure channel information
 // r and w are the reader and writer for the channel
-// stream is the underlying smux stream
+// stream is the underlying smux or QUIC stream
 // buf is a buffer for storing data temporarily
 // isBindTunnel indicates if the channel is bound to a tunnel
 type SChannel struct {
-	stream       *smux.Stream
+	stream       Stream
 	IsOpenTunnel bool
 	id           string
 	ctx          context.Context
@@ -48,10 +47,10 @@ type SChannel struct {
 	once         sync.Once
 }
 
-// NewSChannel creates a new SChannel with the given smux stream
+// NewSChannel creates a new SChannel with the given smux or QUIC stream
 // It initializes a pipe for reading and writing
 func NewSChannel(
-	stream *smux.Stream,
+	stream Stream,
 	parent context.Context,
 	isOpenTunnel bool) *SChannel {
 	ctx, cancelFunc := context.WithCancel(parent)
@@ -0,0 +1,97 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QuicAlpn is the ALPN of the QUIC carrier between client and server.
+const QuicAlpn = "brook"
+
+// NewQuicConfig returns the QUIC settings shared by the client and the server carrier.
+func NewQuicConfig() *quic.Config {
+	return &quic.Config{
+		KeepAlivePeriod:    10 * time.Second,
+		MaxIdleTimeout:     30 * time.Second,
+		MaxIncomingStreams: 10000,
+	}
+}
+
+// Stream is one multiplexed stream of a tunnel session, a smux stream or a QUIC stream.
+type Stream interface {
+	net.Conn
+
+	// GetDieCh returns a channel that is closed when the stream is closed.
+	GetDieCh() <-chan struct{}
+}
+
+// QuicStream adapts a QUIC stream to Stream.
+type QuicStream struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+// NewQuicStream wraps the stream of the given QUIC connection.
+func NewQuicStream(stream *quic.Stream, conn *quic.Conn) *QuicStream {
+	return &QuicStream{
+		Stream: stream,
+		conn:   conn,
+	}
+}
+
+// Close closes both directions of the stream, quic.Stream.Close only closes the write side.
+func (q *QuicStream) Close() error {
+	q.Stream.CancelRead(0)
+	return q.Stream.Close()
+}
+
+// Read reads from the stream. A reset or a lost connection is reported as io.EOF,
+// the same way a closed smux stream is, so read loops stop on it.
+func (q *QuicStream) Read(p []byte) (int, error) {
+	n, err := q.Stream.Read(p)
+	if err != nil && err != io.EOF {
+		var ne net.Error
+		if !errors.As(err, &ne) || !ne.Timeout() {
+			return n, io.EOF
+		}
+	}
+	return n, err
+}
+
+func (q *QuicStream) LocalAddr() net.Addr {
+	return q.conn.LocalAddr()
+}
+
+func (q *QuicStream) RemoteAddr() net.Addr {
+	return q.conn.RemoteAddr()
+}
+
+func (q *QuicStream) GetDieCh() <-chan struct{} {
+	return q.Stream.Context().Done()
+}
+
+// Context returns the context of the stream.
+func (q *QuicStream) Context() context.Context {
+	return q.Stream.Context()
+}
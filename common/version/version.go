@@ -24,7 +24,7 @@ const BuildVersion = "0.3.1"
 
 const Version = 3
 
-const DBVersion = 4
+const DBVersion = 6
 
 // GetBuildVersion application version.
 func GetBuildVersion() string {
@@ -19,11 +19,14 @@ package plugins
 import (
 	"errors"
 	"net"
+	"net/netip"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/httpx"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/modules"
@@ -42,23 +45,36 @@ func init() {
 type SecurityPlugin struct {
 	srv.BaseServerHandler
 	security atomic.Value // *ipSecuritySnapshot
+	// trusted the proxies of a http tunnel, it checks the client behind them on every request.
+	trusted atomic.Pointer[httpx.TrustedProxies]
+	// cfg the config the plugin is bound to, a tunnel update binds the new one.
+	cfg         atomic.Pointer[configs.ServerTunnelConfig]
+	refreshOnce sync.Once
 }
 
 func (b *SecurityPlugin) Bind(cfg *configs.ServerTunnelConfig) {
+	b.cfg.Store(cfg)
 	b.refreshIpSecurity(cfg)
-	threading.GoSafe(func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				b.refreshIpSecurity(cfg)
+	b.refreshOnce.Do(func() {
+		threading.GoSafe(func() {
+			ticker := time.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					b.refreshIpSecurity(b.cfg.Load())
+				}
 			}
-		}
+		})
 	})
 }
 
 func (b *SecurityPlugin) refreshIpSecurity(cfg *configs.ServerTunnelConfig) {
+	var trusted httpx.TrustedProxies
+	if cfg != nil && (cfg.Type == lang.Http || cfg.Type == lang.Https) {
+		trusted, _ = httpx.ParseTrustedProxies(cfg.TrustedProxies)
+	}
+	b.trusted.Store(&trusted)
 	if cfg == nil || cfg.IpStrategy == "" {
 		b.security.Store(&ipSecuritySnapshot{isMatch: false})
 		return
@@ -103,6 +119,30 @@ func (b *SecurityPlugin) Open(ch trp.Channel, traverse srv.TraverseBy) error {
 		log.Warn("%s:invalid ip,reject.", ipStr)
 		return errors.New("invalid ip address")
 	}
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		if trusted := b.trusted.Load(); trusted != nil && trusted.Contains(addr) {
+			traverse()
+			return nil
+		}
+	}
+	if err = b.checkIp(s, ip); err != nil {
+		return err
+	}
+	traverse()
+	return nil
+}
+
+// CheckIp checks the client a http tunnel recovered from the headers of its trusted proxies.
+func (b *SecurityPlugin) CheckIp(ip net.IP) error {
+	s := b.getSecuritySnapshot()
+	if s == nil || !s.isMatch {
+		return nil
+	}
+	return b.checkIp(s, ip)
+}
+
+func (b *SecurityPlugin) checkIp(s *ipSecuritySnapshot, ip net.IP) error {
+	ipStr := ip.String()
 	if s.strategy == lang.StrategyIntranet {
 		if !isPrivateOrLoopbackIP(ip) {
 			log.Warn("%s:non-private ip,reject.", ipStr)
@@ -122,7 +162,6 @@ func (b *SecurityPlugin) Open(ch trp.Channel, traverse srv.TraverseBy) error {
 			return errors.New("invalid ip address")
 		}
 	}
-	traverse()
 	return nil
 }
 
@@ -0,0 +1,39 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package run
+
+import (
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/scmd/web/service"
+	"github.com/g-brook/brook/server/tunnel/http"
+)
+
+// startAcme enables the ACME certificates of the https tunnels, they are kept in the
+// certificate table when the web is started, otherwise in the cache dir.
+func startAcme(config *configs.ServerConfig, isStartWeb bool) {
+	ac := config.Acme
+	if ac == nil || !ac.Enable {
+		return
+	}
+	if isStartWeb {
+		http.AcmeCache = service.NewAcmeCache()
+	}
+	if err := http.InitAcme(ac); err != nil {
+		log.Error("init acme error: %v", err)
+	}
+}
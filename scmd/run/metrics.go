@@ -0,0 +1,65 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/server/metrics"
+)
+
+var metricsServer *http.Server
+
+// startMetrics serves the prometheus metrics on the metrics port, or on the web port
+// when no metrics port is configured.
+func startMetrics(config *configs.ServerConfig, isStartWeb bool) {
+	mc := config.Metrics
+	if mc == nil || !mc.Enable {
+		return
+	}
+	path := metrics.NormalizePath(mc.Path)
+	if mc.Port <= 0 {
+		if !isStartWeb {
+			log.Warn("metrics is enabled but neither the metrics port nor the web is enabled")
+			return
+		}
+		http.Handle(path, metrics.Handler())
+		log.Info("metrics is served on the web port at %s", path)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics.Handler())
+	metricsServer = &http.Server{Addr: fmt.Sprintf(":%d", mc.Port), Handler: mux}
+	threading.GoSafe(func() {
+		log.Info("start metrics server on port %d", mc.Port)
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("start metrics server err: %v", err)
+		}
+	})
+}
+
+func stopMetrics() {
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(context.Background())
+	}
+}
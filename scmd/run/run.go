@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 
 	"github.com/g-brook/brook/common/cmd"
@@ -32,6 +33,7 @@ import (
 	"github.com/g-brook/brook/common/version"
 	"github.com/g-brook/brook/scmd/standard"
 	"github.com/g-brook/brook/scmd/web"
+	"github.com/g-brook/brook/scmd/web/api"
 	"github.com/g-brook/brook/scmd/web/service"
 	"github.com/g-brook/brook/server/defin"
 	"github.com/g-brook/brook/server/remote"
@@ -40,6 +42,7 @@ import (
 
 var (
 	serverConfig configs.ServerConfig
+	reloadLock   sync.Mutex
 	cmdValue     = cmd.NewSevCmdValue()
 	name         = "Brook Tunnel Server(brook-sev)"
 )
@@ -80,8 +83,49 @@ func rootRun(_ *cobra.Command, _ []string) {
 	initLogger(&serverConfig)
 	configCheck(&serverConfig)
 	run()
-	<-ctx.Done()
-	shutdown()
+	// Reload the configs on SIGHUP, so config management can apply changes without a restart.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			if err := reload(); err != nil {
+				log.Error("reload error %v", err)
+			}
+		case <-ctx.Done():
+			shutdown()
+			return
+		}
+	}
+}
+
+// reload re-reads the tunnel configs of the configs file, or of the database when
+// the web is enabled, and applies them to the running tunnels.
+func reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	log.Info("brook reloading configs...")
+	err := notify.NotifyReloading()
+	if err != nil {
+		log.Error("notify reloading error: %v", err)
+	}
+	defer func() {
+		err = notify.NotifyReadiness()
+		if err != nil {
+			log.Error("notify readiness error: %v", err)
+		}
+	}()
+	if !serverConfig.EnableWeb && cmdValue.ConfigPath != "" {
+		config, err := configs.GetServerConfig(cmdValue.ConfigPath)
+		if err != nil {
+			return err
+		}
+		serverConfig.Tunnel = config.Tunnel
+	}
+	standard.ReloadTunnelConfig(&serverConfig)
+	log.Info("brook reload configs success")
+	return nil
 }
 
 func configCheck(config *configs.ServerConfig) {
@@ -118,6 +162,8 @@ func run() {
 	if serverConfig.EnableWeb || isStartWeb {
 		web.NewWebServer(serverConfig.WebPort)
 	}
+	startMetrics(&serverConfig, serverConfig.EnableWeb || isStartWeb)
+	startAcme(&serverConfig, serverConfig.EnableWeb || isStartWeb)
 	//Start In-Server.
 	remote.Inserver = remote.New().Start(&serverConfig)
 	// Get tunnelServer infos.
@@ -133,9 +179,11 @@ func afterRun(config *configs.ServerConfig) {
 	var token string
 	if config.EnableWeb {
 		token = service.GetToken()
+		remote.Credentials = service.NewCredentialStore()
 	} else {
 		token = config.Token
 	}
+	api.ReloadFun = reload
 	defin.Set(defin.TokenKey, token)
 	defin.Set(defin.ServerPort, config.ServerPort)
 }
@@ -146,6 +194,7 @@ func shutdown() {
 	if remote.Inserver != nil {
 		remote.Inserver.Shutdown()
 	}
+	stopMetrics()
 	if serverConfig.EnableWeb {
 		web.Close()
 	}
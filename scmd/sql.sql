@@ -54,6 +54,7 @@ CREATE TABLE IF NOT EXISTS web_logger
     status   integer,
     proxy_id text,
     http_id  text,
+    client_ip text,
     time     ANY
 );
 
@@ -90,4 +91,15 @@ CREATE TABLE IF NOT EXISTS ip_rules (
                                         ip TEXT NOT NULL,                      -- IP 或 CIDR
                                         remark TEXT,
                                         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS client_credential
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT NOT NULL UNIQUE,
+    secret_hash TEXT NOT NULL UNIQUE, -- sha256 of the client secret
+    proxy_ids   TEXT,                 -- allowed proxy ids, separated by ',', * for all
+    expire_at   TIMESTAMP,            -- null never expires
+    revoked     INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -42,6 +42,14 @@ func (receiver *LocalTunnelConfig) Store(cfgId string, cfg *base.ConfigNode) {
 	receiver.configs.Store(cfgId, cfg)
 }
 
+func (receiver *LocalTunnelConfig) Delete(cfgId string) {
+	receiver.configs.Delete(cfgId)
+}
+
+func (receiver *LocalTunnelConfig) All() []*base.ConfigNode {
+	return receiver.configs.Values()
+}
+
 func (receiver *LocalTunnelConfig) Module() modules.ModuleInfo {
 	return modules.ModuleInfo{
 		ID:         moduleName,
@@ -92,11 +100,19 @@ func InitTunnelConfig(sc *sf.ServerConfig) {
 	}
 }
 
+// ReloadTunnelConfig applies the tunnel configs of the file or the database to the running tunnels.
+func ReloadTunnelConfig(sc *sf.ServerConfig) {
+	base.TunnelCfm.Reload(getTunnelConfig(sc))
+}
+
 // GetTunnelConfig retrieves the server tunnel configuration
 // This function is used to obtain the configuration settings for establishing a server tunnel
 // It returns a ServerTunnelConfig struct which contains all necessary parameters for tunnel setup
 func getTunnelConfig(sc *sf.ServerConfig) []*sf.ServerTunnelConfig {
 	if !sc.EnableWeb {
+		for _, item := range sc.Tunnel {
+			item.IsFileCert = item.CertFile != ""
+		}
 		return sc.Tunnel
 	}
 	config := sql.GetAllProxyConfig()
@@ -123,6 +139,19 @@ func getTunnelWebConfig(stc *sf.ServerTunnelConfig, refProxyId int) bool {
 			}
 		}
 		_ = json.Unmarshal([]byte(proxy), &stc.Http)
+		for i := range stc.Http {
+			h := &stc.Http[i]
+			if h.CertId <= 0 {
+				continue
+			}
+			cert, err := sql.GetCertificateByID(h.CertId)
+			if err != nil || cert.ID == 0 {
+				log.Warn("certificate %d of http route %s not found", h.CertId, h.Id)
+				continue
+			}
+			h.CertContent = cert.Content
+			h.KeyContent = cert.PrivateKey
+		}
 		return true
 	}
 	return false
@@ -23,6 +23,7 @@ import (
 	sql2 "database/sql"
 	"encoding/pem"
 	"fmt"
+	"strings"
 
 	"github.com/g-brook/brook/common/transform"
 	"github.com/g-brook/brook/scmd/web/errs"
@@ -132,6 +133,10 @@ func getCertificates(req *Request[Certificate]) *Response {
 	converter := transform.NewConverter()
 	var outputs []*Certificate
 	for _, cert := range certificates {
+		// the ACME account key and challenge tokens are not certificates.
+		if strings.HasPrefix(cert.Name, sql.AcmeCertPrefix) && !cert.ExpireTime.Valid {
+			continue
+		}
 		var ct Certificate
 		err = converter.Convert(cert, &ct)
 		if err != nil {
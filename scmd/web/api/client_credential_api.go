@@ -0,0 +1,185 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	sql2 "database/sql"
+	"encoding/hex"
+	"strings"
+
+	"github.com/g-brook/brook/scmd/web/errs"
+	"github.com/g-brook/brook/scmd/web/sql"
+)
+
+func init() {
+	RegisterRoute(NewRoute("/credentials/getAll", "POST"), getCredentialsAll)
+	RegisterRoute(NewRoute("/credentials/add", "POST"), addCredential)
+	RegisterRoute(NewRoute("/credentials/update", "POST"), updateCredential)
+	RegisterRoute(NewRoute("/credentials/resetSecret", "POST"), resetCredentialSecret)
+	RegisterRoute(NewRoute("/credentials/revoke", "POST"), revokeCredential)
+	RegisterRoute(NewRoute("/credentials/del", "POST"), delCredential)
+}
+
+// HashSecret returns the stored form of a client secret.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// SplitProxyIds parses the proxy_ids column.
+func SplitProxyIds(proxyIds string) []string {
+	var out []string
+	for _, id := range strings.Split(proxyIds, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validateCredential(body *ClientCredential, requireId bool) *Response {
+	if requireId && body.Id <= 0 {
+		return NewResponseFail(errs.CodeSysErr, "id is empty")
+	}
+	if body.Name == "" {
+		return NewResponseFail(errs.CodeSysErr, "name is empty")
+	}
+	for _, id := range body.ProxyIds {
+		if strings.Contains(id, ",") {
+			return NewResponseFail(errs.CodeSysErr, "proxyId is invalid")
+		}
+	}
+	return nil
+}
+
+func toCredentialDb(body *ClientCredential) *sql.ClientCredential {
+	out := &sql.ClientCredential{
+		Id:       body.Id,
+		Name:     body.Name,
+		ProxyIds: strings.Join(body.ProxyIds, ","),
+	}
+	if body.ExpireAt != nil {
+		out.ExpireAt = sql2.NullTime{Time: *body.ExpireAt, Valid: true}
+	}
+	return out
+}
+
+func fromCredentialDb(c *sql.ClientCredential) *ClientCredential {
+	out := &ClientCredential{
+		Id:        c.Id,
+		Name:      c.Name,
+		ProxyIds:  SplitProxyIds(c.ProxyIds),
+		Revoked:   c.Revoked == 1,
+		CreatedAt: c.CreatedAt,
+	}
+	if c.ExpireAt.Valid {
+		out.ExpireAt = &c.ExpireAt.Time
+	}
+	return out
+}
+
+func getCredentialsAll(*Request[any]) *Response {
+	all, err := sql.SelectClientCredentialAll()
+	if err != nil {
+		return NewResponseFail(errs.CodeSysErr, "query credentials failed")
+	}
+	out := make([]*ClientCredential, 0, len(all))
+	for _, c := range all {
+		out = append(out, fromCredentialDb(c))
+	}
+	return NewResponseSuccess(out)
+}
+
+func addCredential(request *Request[ClientCredential]) *Response {
+	body := request.Body
+	if resp := validateCredential(&body, false); resp != nil {
+		return resp
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return NewResponseFail(errs.CodeSysErr, "generate secret failed")
+	}
+	c := toCredentialDb(&body)
+	c.SecretHash = HashSecret(secret)
+	if err = sql.AddClientCredential(c); err != nil {
+		return NewResponseFail(errs.CodeSysErr, "add credential failed")
+	}
+	body.Secret = secret
+	return NewResponseSuccess(body)
+}
+
+func updateCredential(request *Request[ClientCredential]) *Response {
+	body := request.Body
+	if resp := validateCredential(&body, true); resp != nil {
+		return resp
+	}
+	if err := sql.UpdateClientCredential(toCredentialDb(&body)); err != nil {
+		return NewResponseFail(errs.CodeSysErr, "update credential failed")
+	}
+	return NewResponseSuccess(nil)
+}
+
+func resetCredentialSecret(request *Request[ClientCredential]) *Response {
+	body := request.Body
+	if body.Id <= 0 {
+		return NewResponseFail(errs.CodeSysErr, "id is empty")
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return NewResponseFail(errs.CodeSysErr, "generate secret failed")
+	}
+	if err = sql.UpdateClientCredentialSecret(body.Id, HashSecret(secret)); err != nil {
+		return NewResponseFail(errs.CodeSysErr, "reset secret failed")
+	}
+	return NewResponseSuccess(&ClientCredential{Id: body.Id, Secret: secret})
+}
+
+func revokeCredential(request *Request[ClientCredential]) *Response {
+	body := request.Body
+	if body.Id <= 0 {
+		return NewResponseFail(errs.CodeSysErr, "id is empty")
+	}
+	revoked := 0
+	if body.Revoked {
+		revoked = 1
+	}
+	if err := sql.RevokeClientCredential(body.Id, revoked); err != nil {
+		return NewResponseFail(errs.CodeSysErr, "revoke credential failed")
+	}
+	return NewResponseSuccess(nil)
+}
+
+func delCredential(request *Request[ClientCredential]) *Response {
+	body := request.Body
+	if body.Id <= 0 {
+		return NewResponseFail(errs.CodeSysErr, "id is empty")
+	}
+	if err := sql.DelClientCredential(body.Id); err != nil {
+		return NewResponseFail(errs.CodeSysErr, "delete credential failed")
+	}
+	return NewResponseSuccess(nil)
+}
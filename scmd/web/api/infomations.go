@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/transform"
 	"github.com/g-brook/brook/scmd/web/sql"
 )
@@ -77,6 +78,10 @@ type ServerClientInfo struct {
 	Host     string `json:"host"`
 	LastTime string `json:"lastTime"`
 	AgentId  string `json:"agentId"`
+	Weight   int    `json:"weight"`
+	Standby  bool   `json:"standby"`
+	Healthy  bool   `json:"healthy"`
+	Serving  bool   `json:"serving"`
 }
 
 type WebConfigInfo struct {
@@ -87,6 +92,21 @@ type WebConfigInfo struct {
 		Id     string   `json:"id"`
 		Domain string   `json:"domain"`
 		Paths  []string `json:"paths"`
+		//Priority, Methods, Headers and Query order the routes and narrow them down to
+		//the requests, as the http config of the tunnel.
+		Priority int               `json:"priority,omitempty"`
+		Methods  []string          `json:"methods,omitempty"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		Query    map[string]string `json:"query,omitempty"`
+		//CertId is the certificate of the route, the certificate of the proxy is the fallback.
+		CertId *int `json:"certId,omitempty"`
+		//Rewrite is the path, host and header rules of the route.
+		Rewrite *configs.HttpRewriteConfig `json:"rewrite,omitempty"`
+		//Timeout and KeepAlive of the requests of the route.
+		Timeout   *configs.HttpTimeoutConfig `json:"timeout,omitempty"`
+		KeepAlive bool                       `json:"keepAlive,omitempty"`
+		//H2c the local server speaks HTTP/2 without TLS.
+		H2c bool `json:"h2c,omitempty"`
 	} `json:"proxy"`
 }
 
@@ -202,3 +222,14 @@ func (r WebConfigInfo) toDb() *sql.WebProxyConfig {
 		Proxy:      string(j),
 	}
 }
+
+type ClientCredential struct {
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	ProxyIds  []string   `json:"proxyIds"`
+	ExpireAt  *time.Time `json:"expireAt"`
+	Revoked   bool       `json:"revoked"`
+	CreatedAt time.Time  `json:"createdAt"`
+	//Secret is only returned when it's generated.
+	Secret string `json:"secret,omitempty"`
+}
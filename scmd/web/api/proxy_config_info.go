@@ -20,8 +20,11 @@ import (
 	sql2 "database/sql"
 	"encoding/json"
 	"math/rand"
+	"slices"
+	"strings"
 
 	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/httpx"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/scmd/web/errs"
@@ -139,11 +142,15 @@ func delProxyConfig(req *Request[ProxyConfig]) *Response {
 	if req.Body.Idx <= 0 {
 		return NewResponseFail(errs.CodeSysErr, "idx is empty")
 	}
+	//Look up the proxy id first, it is gone after the delete.
+	info := sql.GetProxyConfigByIdNotState(req.Body.Idx)
 	err := sql.DelProxyConfig(req.Body.Idx)
 	if err != nil {
 		return NewResponseFail(errs.CodeSysErr, "delete proxy configs failed")
 	}
-	toPushConfig(req.Body.Idx)
+	if info != nil {
+		base.TunnelCfm.Push(info.ProxyID)
+	}
 	return NewResponseSuccess(nil)
 }
 
@@ -201,6 +208,28 @@ func addWebConfigs(req *Request[WebConfigInfo]) *Response {
 	if body.Proxy == nil || len(body.Proxy) == 0 {
 		return NewResponseFail(errs.CodeSysErr, "Http is empty")
 	}
+	for _, p := range body.Proxy {
+		if slices.ContainsFunc(p.Methods, func(m string) bool {
+			return m == "" || strings.ContainsAny(m, " \t")
+		}) {
+			return NewResponseFail(errs.CodeSysErr, "methods of http "+p.Id+" are invalid")
+		}
+		if _, ok := p.Headers[""]; ok {
+			return NewResponseFail(errs.CodeSysErr, "headers of http "+p.Id+" have an empty name")
+		}
+		if _, ok := p.Query[""]; ok {
+			return NewResponseFail(errs.CodeSysErr, "query of http "+p.Id+" has an empty name")
+		}
+		if _, err := httpx.NewRewriter(p.Rewrite); err != nil {
+			return NewResponseFail(errs.CodeSysErr, "rewrite of http "+p.Id+" is invalid: "+err.Error())
+		}
+		if p.CertId == nil {
+			continue
+		}
+		if cert, err := sql.GetCertificateByID(*p.CertId); err != nil || cert.ID == 0 {
+			return NewResponseFail(errs.CodeSysErr, "certificate of http "+p.Id+" not found")
+		}
+	}
 	config := sql.GetWebProxyConfig(body.RefProxyId)
 	var err error
 	if config == nil {
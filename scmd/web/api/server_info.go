@@ -48,6 +48,10 @@ func getServerInfoByProxyId(req *Request[QueryServerInfo]) *Response {
 			Host:     it.RemoteAddr().String(),
 			LastTime: it.LastTime().Format("2006-04-02 15:04:05"),
 			AgentId:  it.GetId(),
+			Weight:   it.Weight,
+			Standby:  it.Standby,
+			Healthy:  it.Healthy,
+			Serving:  it.Serving,
 		})
 	}
 
@@ -27,15 +27,26 @@ import (
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/notify"
 	"github.com/g-brook/brook/common/pid"
+	"github.com/g-brook/brook/scmd/web/errs"
 )
 
+// ReloadFun reloads the server configuration, it's set by the run command.
+var ReloadFun func() error
+
 func init() {
 	RegisterRoute(NewRoute("/reload", "POST"), reload)
 	RegisterRoute(NewRoute("/stop", "POST"), stop)
 }
 
 func reload(*Request[AuthInfo]) *Response {
-	return nil
+	if ReloadFun == nil {
+		return NewResponseFail(errs.CodeSysErr, "reload is not supported")
+	}
+	if err := ReloadFun(); err != nil {
+		log.Error("reload error: %v", err)
+		return NewResponseFail(errs.CodeSysErr, "reload failed")
+	}
+	return NewResponseSuccess(nil)
 }
 
 func stop(*Request[AuthInfo]) *Response {
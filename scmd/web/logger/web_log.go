@@ -32,11 +32,12 @@ type WebLogger struct {
 	Status   int       `json:"status"`
 	ProxyId  string    `json:"proxyId"`
 	HttpId   string    `json:"httpId"`
+	ClientIp string    `json:"clientIp"`
 	Time     time.Time `json:"time"`
 }
 
 func WithWebLog(logger *WebLogger) {
-	log.Debug("info %v,%v,%v,%v,%v,%v,%v", logger.ProxyId, logger.Protocol, logger.Path, logger.Host, logger.Method, logger.Status, logger.HttpId)
+	log.Debug("info %v,%v,%v,%v,%v,%v,%v,%v", logger.ProxyId, logger.Protocol, logger.Path, logger.Host, logger.Method, logger.Status, logger.HttpId, logger.ClientIp)
 	_ = sql.AddWebLog(&sql.DBWebLogger{
 		Protocol: logger.Protocol,
 		Path:     logger.Path,
@@ -45,6 +46,7 @@ func WithWebLog(logger *WebLogger) {
 		Status:   logger.Status,
 		ProxyId:  logger.ProxyId,
 		HttpId:   logger.HttpId,
+		ClientIp: logger.ClientIp,
 		Time:     sql2.NullString{String: logger.Time.Format("2006-01-02 15:04:05"), Valid: true},
 	})
 }
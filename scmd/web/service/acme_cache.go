@@ -0,0 +1,108 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	sql2 "database/sql"
+	"encoding/pem"
+	"strings"
+
+	"github.com/g-brook/brook/scmd/web/sql"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AcmeCache keeps the ACME certificates, the account key and the challenge tokens
+// in the certificate table.
+type AcmeCache struct {
+}
+
+func NewAcmeCache() *AcmeCache {
+	return &AcmeCache{}
+}
+
+func (a *AcmeCache) Get(_ context.Context, key string) ([]byte, error) {
+	cert, err := sql.GetCertificateByName(sql.AcmeCertPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, autocert.ErrCacheMiss
+	}
+	// autocert expects the private key before the certificate chain.
+	return []byte(cert.PrivateKey + cert.Content), nil
+}
+
+func (a *AcmeCache) Put(_ context.Context, key string, data []byte) error {
+	cert := toAcmeCertificate(key, data)
+	old, err := sql.GetCertificateByName(cert.Name)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return sql.AddCertificate(cert)
+	}
+	cert.ID = old.ID
+	return sql.UpdateCertificate(cert)
+}
+
+func (a *AcmeCache) Delete(_ context.Context, key string) error {
+	return sql.DeleteCertificateByName(sql.AcmeCertPrefix + key)
+}
+
+// toAcmeCertificate splits the pem blocks into the private key and the certificate chain,
+// data without pem blocks, e.g. a challenge token, is kept as the content.
+func toAcmeCertificate(key string, data []byte) *sql.Certificate {
+	cert := &sql.Certificate{Name: sql.AcmeCertPrefix + key}
+	var keyPem, certPem bytes.Buffer
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			_ = pem.Encode(&keyPem, block)
+		} else {
+			_ = pem.Encode(&certPem, block)
+		}
+	}
+	switch {
+	case certPem.Len() > 0:
+		cert.Content = certPem.String()
+		cert.PrivateKey = keyPem.String()
+		cert.Desc = "ACME certificate"
+		if block, _ := pem.Decode(certPem.Bytes()); block != nil {
+			if leaf, err := x509.ParseCertificate(block.Bytes); err == nil {
+				cert.ExpireTime = sql2.NullString{
+					String: leaf.NotAfter.Format("2006-01-02 15:04:05"),
+					Valid:  true,
+				}
+			}
+		}
+	case keyPem.Len() > 0:
+		cert.PrivateKey = keyPem.String()
+		cert.Desc = "ACME account key"
+	default:
+		cert.Content = string(data)
+		cert.Desc = "ACME challenge"
+	}
+	return cert
+}
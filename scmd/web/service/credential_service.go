@@ -0,0 +1,63 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"github.com/g-brook/brook/scmd/web/api"
+	"github.com/g-brook/brook/scmd/web/sql"
+	"github.com/g-brook/brook/server/remote"
+)
+
+// CredentialStore reads the client credentials from the web store.
+type CredentialStore struct {
+}
+
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{}
+}
+
+func (c *CredentialStore) FindBySecret(secret string) (*remote.ClientIdentity, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	credential, err := sql.SelectClientCredentialBySecret(api.HashSecret(secret))
+	if err != nil || credential == nil {
+		return nil, err
+	}
+	return toIdentity(credential), nil
+}
+
+func (c *CredentialStore) FindById(id int) (*remote.ClientIdentity, error) {
+	credential, err := sql.SelectClientCredentialById(id)
+	if err != nil || credential == nil {
+		return nil, err
+	}
+	return toIdentity(credential), nil
+}
+
+func toIdentity(c *sql.ClientCredential) *remote.ClientIdentity {
+	identity := &remote.ClientIdentity{
+		Id:       c.Id,
+		Name:     c.Name,
+		ProxyIds: api.SplitProxyIds(c.ProxyIds),
+		Revoked:  c.Revoked == 1,
+	}
+	if c.ExpireAt.Valid {
+		identity.ExpireAt = c.ExpireAt.Time
+	}
+	return identity
+}
@@ -20,6 +20,9 @@ import (
 	"database/sql"
 )
 
+// AcmeCertPrefix ACME证书、账户密钥及验证令牌的名称前缀
+const AcmeCertPrefix = "acme:"
+
 // Certificate 证书结构体
 type Certificate struct {
 	ID         int            `db:"id" maps:"id"`
@@ -85,3 +88,34 @@ func GetCertificateByID(id int) (*Certificate, error) {
 	}
 	return cert, nil
 }
+
+// GetCertificateByName 根据名称查询证书, 不存在时返回nil
+func GetCertificateByName(name string) (*Certificate, error) {
+	query := `SELECT id, name, content, private_key, desc,expire_time FROM certificate WHERE name = ?`
+	rs, err := Query(query, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	if !rs.rows.Next() {
+		return nil, nil
+	}
+	cert := &Certificate{}
+	err = rs.rows.Scan(&cert.ID, &cert.Name, &cert.Content, &cert.PrivateKey, &cert.Desc, &cert.ExpireTime)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// UpdateCertificate 更新证书
+func UpdateCertificate(cert *Certificate) error {
+	query := `UPDATE certificate SET content = ?, private_key = ?, desc = ?, expire_time = ? WHERE id = ?`
+	return Exec(query, cert.Content, cert.PrivateKey, cert.Desc, cert.ExpireTime, cert.ID)
+}
+
+// DeleteCertificateByName 根据名称删除证书
+func DeleteCertificateByName(name string) error {
+	query := `DELETE FROM certificate WHERE name = ?`
+	return Exec(query, name)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ClientCredential struct {
+	Id         int          `db:"id" maps:"id"`
+	Name       string       `db:"name" maps:"name"`
+	SecretHash string       `db:"secret_hash" maps:"-"`
+	ProxyIds   string       `db:"proxy_ids" maps:"-"`
+	ExpireAt   sql.NullTime `db:"expire_at" maps:"-"`
+	Revoked    int          `db:"revoked" maps:"revoked"`
+	CreatedAt  time.Time    `db:"created_at" maps:"created_at"`
+}
+
+var credentialColumns = "id,name,secret_hash,proxy_ids,expire_at,revoked,created_at"
+
+func AddClientCredential(c *ClientCredential) error {
+	return Exec(
+		`INSERT INTO client_credential(name, secret_hash, proxy_ids, expire_at, revoked, created_at)
+         VALUES (?, ?, ?, ?, 0, CURRENT_TIMESTAMP)`,
+		c.Name,
+		c.SecretHash,
+		c.ProxyIds,
+		c.ExpireAt,
+	)
+}
+
+func UpdateClientCredential(c *ClientCredential) error {
+	return Exec(
+		`UPDATE client_credential SET name = ?, proxy_ids = ?, expire_at = ? WHERE id = ?`,
+		c.Name,
+		c.ProxyIds,
+		c.ExpireAt,
+		c.Id,
+	)
+}
+
+func UpdateClientCredentialSecret(id int, secretHash string) error {
+	return Exec("UPDATE client_credential SET secret_hash = ? WHERE id = ?", secretHash, id)
+}
+
+func RevokeClientCredential(id int, revoked int) error {
+	return Exec("UPDATE client_credential SET revoked = ? WHERE id = ?", revoked, id)
+}
+
+func DelClientCredential(id int) error {
+	return Exec("DELETE FROM client_credential WHERE id = ?", id)
+}
+
+func SelectClientCredentialById(id int) (*ClientCredential, error) {
+	return selectOneClientCredential("id = ?", id)
+}
+
+func SelectClientCredentialBySecret(secretHash string) (*ClientCredential, error) {
+	return selectOneClientCredential("secret_hash = ?", secretHash)
+}
+
+func SelectClientCredentialAll() ([]*ClientCredential, error) {
+	selectSQL := fmt.Sprintf("select %s from client_credential", credentialColumns)
+	res, err := Query(selectSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var list []*ClientCredential
+	for res.rows.Next() {
+		if p, err := scanClientCredential(res.rows); err != nil {
+			return nil, err
+		} else {
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+func selectOneClientCredential(where string, args ...any) (*ClientCredential, error) {
+	selectSQL := fmt.Sprintf("select %s from client_credential where %s", credentialColumns, where)
+	res, err := Query(selectSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for res.rows.Next() {
+		return scanClientCredential(res.rows)
+	}
+	return nil, nil
+}
+
+func scanClientCredential(rows *sql.Rows) (*ClientCredential, error) {
+	var p ClientCredential
+	var proxyIds sql.NullString
+	err := rows.Scan(
+		&p.Id,
+		&p.Name,
+		&p.SecretHash,
+		&proxyIds,
+		&p.ExpireAt,
+		&p.Revoked,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.ProxyIds = proxyIds.String
+	return &p, nil
+}
@@ -31,19 +31,20 @@ type DBWebLogger struct {
 	Status   int            `db:"status" json:"status"`
 	ProxyId  string         `db:"proxy_id" json:"proxyId"`
 	HttpId   string         `db:"http_id" json:"httpId"`
+	ClientIp string         `db:"client_ip" json:"clientIp"`
 	Time     sql.NullString `db:"time" json:"time"`
 }
 
 func AddWebLog(log *DBWebLogger) error {
 	err := Exec(`
-            INSERT INTO web_logger(protocol, path, host, method, status, proxy_id, http_id,time)
-            VALUES (?, ?, ?, ?, ?,?,?,?);
-        `, log.Protocol, log.Path, log.Host, log.Method, log.Status, log.ProxyId, log.HttpId, log.Time)
+            INSERT INTO web_logger(protocol, path, host, method, status, proxy_id, http_id, client_ip,time)
+            VALUES (?, ?, ?, ?, ?,?,?,?,?);
+        `, log.Protocol, log.Path, log.Host, log.Method, log.Status, log.ProxyId, log.HttpId, log.ClientIp, log.Time)
 	return err
 }
 
 func QueryWebLogByProxyId(proxyId string) []*DBWebLogger {
-	res, err := Query("select protocol, path, host, method, status, proxy_id, http_id,time from web_logger where proxy_id=? order by id desc limit 100", proxyId)
+	res, err := Query("select protocol, path, host, method, status, proxy_id, http_id, ifnull(client_ip, ''),time from web_logger where proxy_id=? order by id desc limit 100", proxyId)
 	if err != nil {
 		return nil
 	}
@@ -51,7 +52,7 @@ func QueryWebLogByProxyId(proxyId string) []*DBWebLogger {
 	var list []*DBWebLogger
 	for res.rows.Next() {
 		var p DBWebLogger
-		if err := res.rows.Scan(&p.Protocol, &p.Path, &p.Host, &p.Method, &p.Status, &p.ProxyId, &p.HttpId, &p.Time); err != nil {
+		if err := res.rows.Scan(&p.Protocol, &p.Path, &p.Host, &p.Method, &p.Status, &p.ProxyId, &p.HttpId, &p.ClientIp, &p.Time); err != nil {
 			log.Error("query web log error %v", err)
 			return nil
 		}
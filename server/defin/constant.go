@@ -34,4 +34,17 @@ const (
 	TokenKey lang.KeyType = "runtime_token"
 
 	ServerPort lang.KeyType = "server_port"
+
+	UdpVerKey lang.KeyType = "udp_ver"
+
+	WeightKey lang.KeyType = "weight"
+
+	P2pPortKey lang.KeyType = "p2p_port"
+
+	ProxyProtocolKey lang.KeyType = "proxy_protocol"
+
+	WebsocketStreamKey lang.KeyType = "websocket_stream"
+
+	// ManagerIdKey the manager channel a tunnel connection proved it's of by the session key.
+	ManagerIdKey lang.KeyType = "manager_id"
 )
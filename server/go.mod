@@ -3,17 +3,16 @@ module github.com/g-brook/brook/server
 go 1.25.0
 
 require (
-	github.com/gobwas/ws v1.4.0
 	github.com/google/uuid v1.6.0
 	github.com/panjf2000/gnet/v2 v2.9.7
+	github.com/quic-go/quic-go v0.58.0
 	github.com/xtaci/smux v1.5.57
+	golang.org/x/crypto v0.50.0
 	golang.org/x/net v0.53.0
 )
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/gobwas/httphead v0.1.0 // indirect
-	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/klauspost/compress v1.18.2 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/ncruces/go-strftime v1.0.0 // indirect
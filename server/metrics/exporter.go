@@ -0,0 +1,144 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricFamily is one metric of the prometheus text format.
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...[2]string) {
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (f *metricFamily) write(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+	for _, s := range f.samples {
+		_, _ = io.WriteString(w, f.name)
+		if len(s.labels) > 0 {
+			_, _ = io.WriteString(w, "{")
+			for i, l := range s.labels {
+				if i > 0 {
+					_, _ = io.WriteString(w, ",")
+				}
+				_, _ = fmt.Fprintf(w, "%s=\"%s\"", l[0], labelEscaper.Replace(l[1]))
+			}
+			_, _ = io.WriteString(w, "}")
+		}
+		_, _ = fmt.Fprintf(w, " %s\n", strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+func label(name, value string) [2]string {
+	return [2]string{name, value}
+}
+
+// Export writes the metrics in the prometheus text format.
+func (receiver *Metrics) Export(w io.Writer) {
+	in := &metricFamily{name: "brook_tunnel_received_bytes_total", help: "Bytes received from the users of the tunnel.", typ: "counter"}
+	out := &metricFamily{name: "brook_tunnel_sent_bytes_total", help: "Bytes sent to the users of the tunnel.", typ: "counter"}
+	connections := &metricFamily{name: "brook_tunnel_connections", help: "Active user connections of the tunnel.", typ: "gauge"}
+	clients := &metricFamily{name: "brook_tunnel_clients", help: "Clients registered to the tunnel.", typ: "gauge"}
+	poolIdle := &metricFamily{name: "brook_tunnel_pool_idle", help: "Idle worker connections in the pool of the tunnel.", typ: "gauge"}
+	uptime := &metricFamily{name: "brook_tunnel_uptime_seconds", help: "Seconds since the tunnel started.", typ: "gauge"}
+	servers := receiver.GetServers()
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Id() < servers[j].Id()
+	})
+	for _, server := range servers {
+		labels := [][2]string{
+			label("proxy_id", server.Id()),
+			label("type", server.Type()),
+			label("port", strconv.Itoa(server.Port())),
+		}
+		if traffic := receiver.GetTraffics(server.Id()); traffic != nil {
+			inBytes, outBytes := traffic.Total()
+			in.add(float64(inBytes), labels...)
+			out.add(float64(outBytes), labels...)
+		}
+		connections.add(float64(server.Connections()), labels...)
+		clients.add(float64(server.Clients()), labels...)
+		poolIdle.add(float64(server.PoolIdle()), labels...)
+		if !server.Runtime().IsZero() {
+			uptime.add(time.Since(server.Runtime()).Seconds(), labels...)
+		}
+	}
+	httpStatus := &metricFamily{name: "brook_http_responses_total", help: "Responses of the http proxy by status code.", typ: "counter"}
+	keys := receiver.httpStatus.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].proxyId != keys[j].proxyId {
+			return keys[i].proxyId < keys[j].proxyId
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		if counter, ok := receiver.httpStatus.Load(key); ok {
+			httpStatus.add(float64(counter.Load()), label("proxy_id", key.proxyId), label("code", strconv.Itoa(key.status)))
+		}
+	}
+	login := &metricFamily{name: "brook_login_total", help: "Logins of the clients by result.", typ: "counter"}
+	login.add(float64(receiver.loginSuccess.Load()), label("result", "success"))
+	login.add(float64(receiver.loginFailure.Load()), label("result", "failure"))
+	goroutines := &metricFamily{name: "brook_goroutines", help: "Goroutines of the server.", typ: "gauge"}
+	goroutines.add(float64(runtime.NumGoroutine()))
+	for _, f := range []*metricFamily{in, out, connections, clients, poolIdle, uptime, httpStatus, login, goroutines} {
+		f.write(w)
+	}
+}
+
+// Handler serves the metrics for the prometheus scraper.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w := bufio.NewWriter(writer)
+		M.Export(w)
+		_ = w.Flush()
+	})
+}
+
+// NormalizePath returns the path of the endpoint, /metrics by default.
+func NormalizePath(path string) string {
+	if path == "" {
+		return "/metrics"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
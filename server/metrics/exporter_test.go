@@ -0,0 +1,117 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTunnel is a tunnel server with fixed metrics.
+type testTunnel struct {
+	id, typ string
+	port    int
+	runtime time.Time
+}
+
+func (t *testTunnel) Id() string                { return t.id }
+func (t *testTunnel) Name() string              { return t.id }
+func (t *testTunnel) Port() int                 { return t.port }
+func (t *testTunnel) Type() string              { return t.typ }
+func (t *testTunnel) Connections() int          { return 3 }
+func (t *testTunnel) Clients() int              { return 2 }
+func (t *testTunnel) PoolIdle() int             { return 1 }
+func (t *testTunnel) Runtime() time.Time        { return t.runtime }
+func (t *testTunnel) ClientsInfo() []ClientInfo { return nil }
+
+// varying are the samples that change between runs.
+var varying = regexp.MustCompile(`(?m)^((?:brook_goroutines|brook_tunnel_uptime_seconds)(?:\{[^}]*\})?) .*$`)
+
+const golden = `# HELP brook_tunnel_received_bytes_total Bytes received from the users of the tunnel.
+# TYPE brook_tunnel_received_bytes_total counter
+brook_tunnel_received_bytes_total{proxy_id="a\"b\\c\nd",type="tcp",port="9001"} 0
+brook_tunnel_received_bytes_total{proxy_id="web",type="http",port="8080"} 1024
+# HELP brook_tunnel_sent_bytes_total Bytes sent to the users of the tunnel.
+# TYPE brook_tunnel_sent_bytes_total counter
+brook_tunnel_sent_bytes_total{proxy_id="a\"b\\c\nd",type="tcp",port="9001"} 0
+brook_tunnel_sent_bytes_total{proxy_id="web",type="http",port="8080"} 2048
+# HELP brook_tunnel_connections Active user connections of the tunnel.
+# TYPE brook_tunnel_connections gauge
+brook_tunnel_connections{proxy_id="a\"b\\c\nd",type="tcp",port="9001"} 3
+brook_tunnel_connections{proxy_id="web",type="http",port="8080"} 3
+# HELP brook_tunnel_clients Clients registered to the tunnel.
+# TYPE brook_tunnel_clients gauge
+brook_tunnel_clients{proxy_id="a\"b\\c\nd",type="tcp",port="9001"} 2
+brook_tunnel_clients{proxy_id="web",type="http",port="8080"} 2
+# HELP brook_tunnel_pool_idle Idle worker connections in the pool of the tunnel.
+# TYPE brook_tunnel_pool_idle gauge
+brook_tunnel_pool_idle{proxy_id="a\"b\\c\nd",type="tcp",port="9001"} 1
+brook_tunnel_pool_idle{proxy_id="web",type="http",port="8080"} 1
+# HELP brook_tunnel_uptime_seconds Seconds since the tunnel started.
+# TYPE brook_tunnel_uptime_seconds gauge
+brook_tunnel_uptime_seconds{proxy_id="web",type="http",port="8080"} X
+# HELP brook_http_responses_total Responses of the http proxy by status code.
+# TYPE brook_http_responses_total counter
+brook_http_responses_total{proxy_id="web",code="200"} 2
+brook_http_responses_total{proxy_id="web",code="502"} 1
+# HELP brook_login_total Logins of the clients by result.
+# TYPE brook_login_total counter
+brook_login_total{result="success"} 1
+brook_login_total{result="failure"} 0
+# HELP brook_goroutines Goroutines of the server.
+# TYPE brook_goroutines gauge
+brook_goroutines X
+`
+
+func TestExport(t *testing.T) {
+	m := newMetrics()
+	web := &testTunnel{id: "web", typ: "http", port: 8080, runtime: time.Now().Add(-time.Minute)}
+	traffic := m.PutServer(web)
+	traffic.AddInBytes(1024)
+	traffic.AddOutBytes(2048)
+	// The label escaping: quotes, backslashes and newlines of the proxy id.
+	m.PutServer(&testTunnel{id: "a\"b\\c\nd", typ: "tcp", port: 9001})
+	m.AddHttpStatus("web", 502)
+	m.AddHttpStatus("web", 200)
+	m.AddHttpStatus("web", 200)
+	m.AddLogin(true)
+
+	var out strings.Builder
+	m.Export(&out)
+	if got := varying.ReplaceAllString(out.String(), "$1 X"); got != golden {
+		t.Fatalf("Export =\n%s\nwant\n%s", got, golden)
+	}
+}
+
+func TestLabelEscaper(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`plain`, `plain`},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+		{"\\\"\n", `\\\"\n`},
+	}
+	for _, tt := range tests {
+		if got := labelEscaper.Replace(tt.in); got != tt.want {
+			t.Errorf("labelEscaper.Replace(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -17,22 +17,32 @@
 package metrics
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/g-brook/brook/common/hash"
 )
 
+type httpStatusKey struct {
+	proxyId string
+	status  int
+}
+
 type Metrics struct {
-	servers  *hash.SyncSet[TunnelMetrics]
-	traffics *hash.SyncMap[string, *TunnelTraffic]
+	servers      *hash.SyncSet[TunnelMetrics]
+	traffics     *hash.SyncMap[string, *TunnelTraffic]
+	httpStatus   *hash.SyncMap[httpStatusKey, *atomic.Uint64]
+	loginSuccess atomic.Uint64
+	loginFailure atomic.Uint64
 }
 
 var M = newMetrics()
 
 func newMetrics() *Metrics {
 	return &Metrics{
-		servers:  hash.NewSyncSet[TunnelMetrics](),
-		traffics: hash.NewSyncMap[string, *TunnelTraffic](),
+		servers:    hash.NewSyncSet[TunnelMetrics](),
+		traffics:   hash.NewSyncMap[string, *TunnelTraffic](),
+		httpStatus: hash.NewSyncMap[httpStatusKey, *atomic.Uint64](),
 	}
 }
 
@@ -59,6 +69,26 @@ func (receiver *Metrics) PutTraffics(traffic *TunnelTraffic) {
 	receiver.traffics.Store(traffic.Id, traffic)
 }
 
-func (receiver *Metrics) GetTraffics(id string) {
-	receiver.traffics.Load(id)
+func (receiver *Metrics) GetTraffics(id string) *TunnelTraffic {
+	traffic, _ := receiver.traffics.Load(id)
+	return traffic
+}
+
+// AddHttpStatus counts a response of the http proxy.
+func (receiver *Metrics) AddHttpStatus(proxyId string, status int) {
+	key := httpStatusKey{proxyId: proxyId, status: status}
+	counter, ok := receiver.httpStatus.Load(key)
+	if !ok {
+		counter, _ = receiver.httpStatus.LoadOrStore(key, new(atomic.Uint64))
+	}
+	counter.Add(1)
+}
+
+// AddLogin counts a login of a client on the server port.
+func (receiver *Metrics) AddLogin(success bool) {
+	if success {
+		receiver.loginSuccess.Add(1)
+	} else {
+		receiver.loginFailure.Add(1)
+	}
 }
@@ -29,6 +29,17 @@ type TunnelMetrics interface {
 	Type() string
 	Connections() int
 	Clients() int
+	PoolIdle() int
 	Runtime() time.Time
-	ClientsInfo() []transport.Channel
+	ClientsInfo() []ClientInfo
+}
+
+// ClientInfo is a tunnel channel with the status of the client that registered it.
+type ClientInfo struct {
+	transport.Channel
+	Weight  int
+	Standby bool
+	Healthy bool
+	// Serving reports whether the client gets the new connections.
+	Serving bool
 }
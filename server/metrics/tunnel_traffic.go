@@ -18,6 +18,7 @@ package metrics
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,6 +36,8 @@ type TunnelTraffic struct {
 	mu       sync.Mutex
 	interval time.Duration
 	size     int
+	inTotal  atomic.Uint64
+	outTotal atomic.Uint64
 }
 
 func NewTunnelTraffic(Id string, port int, name string, window time.Duration, interval time.Duration) *TunnelTraffic {
@@ -61,6 +64,11 @@ func (ts *TunnelTraffic) AddOutBytes(bytes int) {
 }
 
 func (ts *TunnelTraffic) addBytes(bytes int, isIn bool) {
+	if isIn {
+		ts.inTotal.Add(uint64(bytes))
+	} else {
+		ts.outTotal.Add(uint64(bytes))
+	}
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
@@ -99,6 +107,11 @@ func (ts *TunnelTraffic) Sum() (in uint64, out uint64) {
 	return
 }
 
+// Total returns the incoming and outgoing traffic since the tunnel started.
+func (ts *TunnelTraffic) Total() (in uint64, out uint64) {
+	return ts.inTotal.Load(), ts.outTotal.Load()
+}
+
 //func (ts *TunnelTraffic) Print() {
 //	go func() {
 //		ticker := time.NewTicker(5 * time.Second)
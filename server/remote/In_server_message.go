@@ -29,6 +29,8 @@ var Inserver *InServer
 type TunnelCfg struct {
 	RemotePort  int
 	Destination string
+	// Network the destination takes, see exchange.OpenTunnelResp.
+	Network string
 }
 
 func NewTunnelCfg(remotePort int, destination string) *TunnelCfg {
@@ -45,5 +47,8 @@ func OpenTunnelServer(req *exchange.OpenTunnelReq, ch transport.Channel) (*Tunne
 		log.Error("not found open tunnel function")
 		return nil, fmt.Errorf("not found open tunnel function")
 	}
+	if err := authorize(ch.GetId(), req.ProxyId); err != nil {
+		return nil, err
+	}
 	return OpenTunnelServerFun(req, ch)
 }
@@ -0,0 +1,184 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+)
+
+// AllProxy grants a client identity every proxy id.
+const AllProxy = "*"
+
+// ClientIdentity
+// @Description: A named client credential and the proxy ids it may open.
+type ClientIdentity struct {
+	Id       int
+	Name     string
+	ProxyIds []string
+	ExpireAt time.Time
+	Revoked  bool
+}
+
+// Valid returns an error when the identity is revoked or expired.
+func (c *ClientIdentity) Valid() error {
+	if c.Revoked {
+		return fmt.Errorf("client %s is revoked", c.Name)
+	}
+	if !c.ExpireAt.IsZero() && time.Now().After(c.ExpireAt) {
+		return fmt.Errorf("client %s is expired", c.Name)
+	}
+	return nil
+}
+
+// Allow reports whether the identity may open the proxy id.
+func (c *ClientIdentity) Allow(proxyId string) bool {
+	return slices.Contains(c.ProxyIds, AllProxy) || slices.Contains(c.ProxyIds, proxyId)
+}
+
+// CredentialStore
+// @Description: Lookup of per-client credentials, provided by the web store.
+type CredentialStore interface {
+	// FindBySecret returns the identity owning the secret, nil if there is none.
+	FindBySecret(secret string) (*ClientIdentity, error)
+
+	// FindById reloads an identity so that revocation applies to open sessions.
+	FindById(id int) (*ClientIdentity, error)
+}
+
+// Credentials is nil when only the shared token is used.
+var Credentials CredentialStore
+
+// session is a logged-in manager channel. identity is nil for the shared token
+// or a client certificate, both of which may open every proxy.
+type session struct {
+	identity *ClientIdentity
+	channel  transport.Channel
+	// key is handed to the client only, its tunnel connections show it with the unId.
+	key string
+	// managed sessions get their tunnels pushed.
+	managed bool
+}
+
+var sessions = hash.NewSyncMap[string, *session]()
+
+// login checks the token of a manager channel and binds the resulting session to it.
+func login(token string, ch transport.Channel) error {
+	if token != "" && token == defin.GetToken() {
+		addSession(ch, &session{})
+		return nil
+	}
+	if Credentials == nil {
+		return fmt.Errorf("token not match")
+	}
+	identity, err := Credentials.FindBySecret(token)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return fmt.Errorf("token not match")
+	}
+	if err = identity.Valid(); err != nil {
+		return err
+	}
+	log.Info("Client %s login: %v", identity.Name, ch.RemoteAddr())
+	addSession(ch, &session{identity: identity})
+	return nil
+}
+
+func addSession(ch transport.Channel, s *session) {
+	id := ch.GetId()
+	s.channel = ch
+	s.key = newSessionKey()
+	sessions.Store(id, s)
+	ch.OnClose(func(channel transport.Channel) {
+		sessions.Delete(id)
+	})
+}
+
+func newSessionKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authorize checks that the session of the manager channel unId may open proxyId, unId
+// is the id of the channel the request came in on.
+// Nothing is enforced while no credential store is configured.
+func authorize(unId string, proxyId string) error {
+	if Credentials == nil {
+		return nil
+	}
+	s, ok := sessions.Load(unId)
+	if !ok {
+		return fmt.Errorf("client not login")
+	}
+	return s.authorize(proxyId)
+}
+
+// authorizeTunnel checks a request of a tunnel connection, which is not the manager
+// channel: unId only names the session, the key proves the request is its client's.
+func authorizeTunnel(unId string, key string, proxyId string) error {
+	if Credentials == nil {
+		return nil
+	}
+	s, ok := sessions.Load(unId)
+	if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(s.key)) != 1 {
+		return fmt.Errorf("client not login")
+	}
+	return s.authorize(proxyId)
+}
+
+// managerOf returns the id of the manager channel whose session key the tunnel connection
+// shows, empty when it shows none or another one.
+func managerOf(unId string, key string) string {
+	s, ok := sessions.Load(unId)
+	if !ok || key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(s.key)) != 1 {
+		return ""
+	}
+	return unId
+}
+
+func (s *session) authorize(proxyId string) error {
+	if s.identity == nil {
+		return nil
+	}
+	identity, err := Credentials.FindById(s.identity.Id)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return fmt.Errorf("client %s is removed", s.identity.Name)
+	}
+	if err = identity.Valid(); err != nil {
+		return err
+	}
+	if !identity.Allow(proxyId) {
+		log.Warn("Client %s is not allowed to open %s", identity.Name, proxyId)
+		return fmt.Errorf("client %s is not allowed to open %s", identity.Name, proxyId)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+)
+
+type testStore map[int]*ClientIdentity
+
+func (s testStore) FindBySecret(secret string) (*ClientIdentity, error) {
+	for _, identity := range s {
+		if identity.Name == secret {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s testStore) FindById(id int) (*ClientIdentity, error) {
+	return s[id], nil
+}
+
+// testChannel is a manager or tunnel channel with just an id.
+type testChannel struct {
+	transport.Channel
+	id string
+}
+
+func (c *testChannel) GetId() string {
+	return c.id
+}
+
+func (c *testChannel) OnClose(transport.CloseEvent) {
+}
+
+func (c *testChannel) RemoteAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// loginClients logs in the client a, which may open the proxy a only, and b with b.
+func loginClients(t *testing.T) (a *session, b *session) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	defin.Set(defin.TokenKey, "shared")
+	old := Credentials
+	Credentials = testStore{
+		1: {Id: 1, Name: "a", ProxyIds: []string{"a"}},
+		2: {Id: 2, Name: "b", ProxyIds: []string{"b"}},
+	}
+	t.Cleanup(func() {
+		Credentials = old
+		sessions.Delete("ma")
+		sessions.Delete("mb")
+	})
+	for _, name := range []string{"a", "b"} {
+		if err := login(name, &testChannel{id: "m" + name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ = sessions.Load("ma")
+	b, _ = sessions.Load("mb")
+	return a, b
+}
+
+func TestTunnelRequestsUseTheirOwnSession(t *testing.T) {
+	a, b := loginClients(t)
+	if a.key == "" || a.key == b.key {
+		t.Fatalf("session keys %q %q", a.key, b.key)
+	}
+	tunnelCh := &testChannel{id: "tunnel"}
+	tests := []struct {
+		name    string
+		unId    string
+		key     string
+		proxyId string
+		want    string
+	}{
+		{"claims the unId of b", "mb", a.key, "b", "client not login"},
+		{"claims the unId of b without key", "mb", "", "b", "client not login"},
+		{"opens the proxy of b", "ma", a.key, "b", "not allowed"},
+		{"opens its own proxy", "ma", a.key, "a", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := doRegister(&exchange.RegisterReqAndRsp{ProxyId: tt.proxyId, UnId: tt.unId, SessionKey: tt.key}, tunnelCh)
+			checkAuthorization(t, "register", err, tt.want)
+			_, err = clientWorkConnProcess(&exchange.ClientWorkConnReq{ProxyId: tt.proxyId, UnId: tt.unId, SessionKey: tt.key}, tunnelCh)
+			checkAuthorization(t, "work conn", err, tt.want)
+		})
+	}
+}
+
+// checkAuthorization wants the error of a rejected request, an allowed one fails later on
+// for want of a real tunnel.
+func checkAuthorization(t *testing.T, what string, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err == nil || strings.Contains(err.Error(), "not login") || strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("%s: not authorized: %v", what, err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("%s: got %v, want %q", what, err, want)
+	}
+}
+
+func TestManagerOf(t *testing.T) {
+	a, b := loginClients(t)
+	tests := []struct {
+		name string
+		unId string
+		key  string
+		want string
+	}{
+		{"its own session", "ma", a.key, "ma"},
+		{"claims the unId of b", "mb", a.key, ""},
+		{"claims the unId of b without key", "mb", "", ""},
+		{"unknown unId", "mc", b.key, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := managerOf(tt.unId, tt.key); got != tt.want {
+				t.Fatalf("managerOf = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
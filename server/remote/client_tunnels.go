@@ -0,0 +1,72 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"errors"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/log"
+)
+
+// ClientTunnelsFun returns the tunnels served by the clients, built from the tunnel configs
+// of the server.
+var ClientTunnelsFun func() []*configs.ClientTunnelConfig
+
+// errManagedIdentity refuses a managed client that logged in without its own credentials.
+var errManagedIdentity = errors.New("a managed client needs its own client credentials, " +
+	"the tunnels it serves are the ones its credentials allow")
+
+// clientTunnels returns the tunnels the identity of the session allows, none without an
+// identity: the shared token and the certificates may open every tunnel but are assigned none.
+func clientTunnels(s *session) []*configs.ClientTunnelConfig {
+	if ClientTunnelsFun == nil || s.identity == nil || Credentials == nil {
+		return nil
+	}
+	// Reload the identity, so a push follows the tunnels it's assigned now.
+	identity, err := Credentials.FindById(s.identity.Id)
+	if err != nil || identity == nil || identity.Valid() != nil {
+		return nil
+	}
+	var tunnels []*configs.ClientTunnelConfig
+	for _, t := range ClientTunnelsFun() {
+		if identity.Allow(t.ProxyId) {
+			tunnels = append(tunnels, t)
+		}
+	}
+	return tunnels
+}
+
+// PushClientTunnels sends the tunnels to every managed client, it is called after the
+// tunnel configs changed.
+func PushClientTunnels() {
+	sessions.Range(func(id string, s *session) bool {
+		if !s.managed || s.channel == nil || s.channel.IsClose() {
+			return true
+		}
+		request, err := exchange.NewRequest(&exchange.TunnelsPush{Tunnels: clientTunnels(s)})
+		if err != nil {
+			log.Error("New tunnels push to %v error: %v", s.channel.RemoteAddr(), err)
+			return true
+		}
+		if _, err = s.channel.Write(request.Bytes()); err != nil {
+			log.Warn("Push tunnels to %v error: %v", s.channel.RemoteAddr(), err)
+		}
+		return true
+	})
+}
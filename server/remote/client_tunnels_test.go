@@ -0,0 +1,164 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/server/defin"
+)
+
+// pushChannel is a manager channel that keeps what the server writes to it.
+type pushChannel struct {
+	testChannel
+	lock   sync.Mutex
+	writes [][]byte
+}
+
+func (c *pushChannel) GetConn() net.Conn {
+	return nil
+}
+
+func (c *pushChannel) IsClose() bool {
+	return false
+}
+
+func (c *pushChannel) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writes = append(c.writes, bytes.Clone(p))
+	return len(p), nil
+}
+
+// pushed decodes the tunnels of the pushes written to the channel.
+func (c *pushChannel) pushed(t *testing.T) [][]string {
+	t.Helper()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var pushes [][]string
+	for _, w := range c.writes {
+		p, err := exchange.Decoder(bytes.NewReader(w))
+		if err != nil {
+			t.Fatal(err)
+		}
+		push, err := exchange.Parse[exchange.TunnelsPush](p.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pushes = append(pushes, proxyIds(push.Tunnels))
+	}
+	return pushes
+}
+
+func proxyIds(tunnels []*configs.ClientTunnelConfig) []string {
+	ids := make([]string, 0, len(tunnels))
+	for _, t := range tunnels {
+		ids = append(ids, t.ProxyId)
+	}
+	return ids
+}
+
+// serverTunnels makes the server serve the tunnels a, b and c.
+func serverTunnels(t *testing.T) {
+	defin.Set(defin.TunnelPortKey, 8919)
+	defin.Set(defin.P2pPortKey, 0)
+	old := ClientTunnelsFun
+	ClientTunnelsFun = func() []*configs.ClientTunnelConfig {
+		var tunnels []*configs.ClientTunnelConfig
+		for _, id := range []string{"a", "b", "c"} {
+			tunnels = append(tunnels, &configs.ClientTunnelConfig{ProxyId: id, TunnelType: lang.Tcp, Destination: "127.0.0.1:80"})
+		}
+		return tunnels
+	}
+	t.Cleanup(func() { ClientTunnelsFun = old })
+}
+
+func TestLoginDeliversTheTunnelsOfTheClient(t *testing.T) {
+	loginClients(t)
+	serverTunnels(t)
+	Credentials.(testStore)[3] = &ClientIdentity{Id: 3, Name: "all", ProxyIds: []string{AllProxy}}
+	tests := []struct {
+		name    string
+		token   string
+		managed bool
+		want    []string
+		err     bool
+	}{
+		{"client a", "a", true, []string{"a"}, false},
+		{"client of every tunnel", "all", true, []string{"a", "b", "c"}, false},
+		{"not managed", "a", false, []string{"a"}, false},
+		{"shared token managed", "shared", true, nil, true},
+		{"shared token", "shared", false, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &pushChannel{testChannel: testChannel{id: "login"}}
+			t.Cleanup(func() { sessions.Delete("login") })
+			rsp, err := loginProcess(&exchange.LoginReq{Token: tt.token, Managed: tt.managed}, ch)
+			if tt.err {
+				if err == nil {
+					t.Fatal("managed login without credentials accepted")
+				}
+				if _, ok := sessions.Load("login"); ok {
+					t.Fatal("refused login kept its session")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := proxyIds(rsp.(exchange.LoginResp).Tunnels); !slices.Equal(got, tt.want) {
+				t.Fatalf("login tunnels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushClientTunnels(t *testing.T) {
+	loginClients(t)
+	serverTunnels(t)
+	managed := &pushChannel{testChannel: testChannel{id: "managed"}}
+	unmanaged := &pushChannel{testChannel: testChannel{id: "unmanaged"}}
+	t.Cleanup(func() {
+		sessions.Delete("managed")
+		sessions.Delete("unmanaged")
+	})
+	if _, err := loginProcess(&exchange.LoginReq{Token: "b", Managed: true}, managed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loginProcess(&exchange.LoginReq{Token: "b"}, unmanaged); err != nil {
+		t.Fatal(err)
+	}
+	PushClientTunnels()
+	// The identity is reloaded, the push follows the tunnels assigned since the login.
+	Credentials.(testStore)[2].ProxyIds = []string{"b", "c"}
+	PushClientTunnels()
+	want := [][]string{{"b"}, {"b", "c"}}
+	if got := managed.pushed(t); len(got) != 2 || !slices.Equal(got[0], want[0]) || !slices.Equal(got[1], want[1]) {
+		t.Fatalf("pushed %v, want %v", got, want)
+	}
+	if got := unmanaged.pushed(t); len(got) != 0 {
+		t.Fatalf("pushed %v to an unmanaged client", got)
+	}
+}
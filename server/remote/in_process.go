@@ -22,8 +22,10 @@ import (
 
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/tlsx"
 	"github.com/g-brook/brook/common/transport"
 	"github.com/g-brook/brook/server/defin"
+	"github.com/g-brook/brook/server/metrics"
 	"github.com/g-brook/brook/server/tunnel"
 )
 
@@ -34,6 +36,10 @@ func init() {
 	Register(exchange.OpenTunnel, openTunnelProcess, true)
 	Register(exchange.UdpRegister, dupRegisterProcess, true)
 	Register(exchange.ClientWorkerConnReq, clientWorkConnProcess, true)
+	Register(exchange.CloseTunnel, closeTunnelProcess, true)
+	Register(exchange.Visit, visitProcess, true)
+	Register(exchange.P2pVisit, p2pVisitProcess, true)
+	Register(exchange.P2pAnswer, p2pAnswerProcess, true)
 }
 
 type InProcess[T exchange.InBound] func(request T, ch transport.Channel) (any, error)
@@ -54,6 +60,10 @@ func pingProcess(request *exchange.Heartbeat, ch transport.Channel) (any, error)
 }
 
 func dupRegisterProcess(request *exchange.UdpRegisterReqAndRsp, ch transport.Channel) (any, error) {
+	request.Ver = exchange.NegotiateUdpVer(request.Ver)
+	if sch, ok := ch.(*transport.SChannel); ok {
+		sch.AddAttr(defin.UdpVerKey, request.Ver)
+	}
 	return doRegister(request, ch)
 }
 
@@ -65,6 +75,9 @@ func registerProcess(request *exchange.RegisterReqAndRsp, ch transport.Channel)
 }
 
 func doRegister(request exchange.TRegister, ch transport.Channel) (any, error) {
+	if err := authorizeTunnel(request.GetUnId(), request.GetSessionKey(), request.GetProxyId()); err != nil {
+		return nil, err
+	}
 	// Check the type of the channel and perform channel-specific operations
 	switch sch := ch.(type) {
 	case *transport.SChannel:
@@ -72,13 +85,17 @@ func doRegister(request exchange.TRegister, ch transport.Channel) (any, error) {
 		sch.IsOpenTunnel = request.IsOpen()
 		sch.AddAttr(defin.HttpIdKey, request.GetHttpId())
 		sch.AddAttr(defin.ProxyIdKey, request.GetProxyId())
+		sch.AddAttr(defin.WeightKey, request.GetWeight())
+		sch.AddAttr(defin.ProxyProtocolKey, request.IsProxyProtocol())
+		sch.AddAttr(defin.WebsocketStreamKey, request.IsWebsocketStream())
+		sch.AddAttr(defin.ManagerIdKey, managerOf(request.GetUnId(), request.GetSessionKey()))
 	default:
 		// Log error and return error for unsupported channel types
 		log.Error("Not support channel type: %T", ch)
 		return nil, fmt.Errorf("not support channel type:%T", ch)
 	}
 	port := request.GetTunnelPort()
-	t := tunnel.GetTunnel(port)
+	t := tunnel.FindTunnel(port, request.GetProxyId())
 	if t == nil {
 		// Log error and return error if tunnel is not found
 		log.Error("Not found tunnel: %d", port)
@@ -94,16 +111,35 @@ func doRegister(request exchange.TRegister, ch transport.Channel) (any, error) {
 }
 
 func loginProcess(req *exchange.LoginReq, ch transport.Channel) (any, error) {
-	token := defin.GetToken()
-	if token != req.Token {
-		log.Warn("token not match,1:%v,2:%v", token, req.Token)
-		return nil, fmt.Errorf("token not match")
+	if tlsx.IsVerifiedPeer(ch.GetConn()) {
+		// A client certificate signed by the configured CA stands in for the token.
+		log.Debug("Login with client certificate: %v", ch.RemoteAddr())
+		addSession(ch, &session{})
+	} else if err := login(req.Token, ch); err != nil {
+		log.Warn("Login fail: %v, %v", ch.RemoteAddr(), err)
+		metrics.M.AddLogin(false)
+		return nil, err
 	}
+	if s, ok := sessions.Load(ch.GetId()); ok && req.Managed && s.identity == nil {
+		// The shared token and the certificates tell no client, so no tunnels of its own.
+		sessions.Delete(ch.GetId())
+		log.Warn("Login fail: %v, %v", ch.RemoteAddr(), errManagedIdentity)
+		metrics.M.AddLogin(false)
+		return nil, errManagedIdentity
+	}
+	metrics.M.AddLogin(true)
 	port := defin.Get[int](defin.TunnelPortKey)
-	return exchange.LoginResp{
+	rsp := exchange.LoginResp{
 		TunnelPort: port,
 		UnId:       ch.GetId(),
-	}, nil
+		P2pPort:    defin.Get[int](defin.P2pPortKey),
+	}
+	if s, ok := sessions.Load(ch.GetId()); ok {
+		s.managed = req.Managed
+		rsp.SessionKey = s.key
+		rsp.Tunnels = clientTunnels(s)
+	}
+	return rsp, nil
 }
 
 func openTunnelProcess(req *exchange.OpenTunnelReq, ch transport.Channel) (any, error) {
@@ -115,17 +151,59 @@ func openTunnelProcess(req *exchange.OpenTunnelReq, ch transport.Channel) (any,
 		UnId:        req.UnId,
 		RemotePort:  cfg.RemotePort,
 		Destination: cfg.Destination,
+		Network:     cfg.Network,
 	}, nil
 }
 
+// closeTunnelProcess stops sending the user connections of the tunnel to the client.
+func closeTunnelProcess(req *exchange.CloseTunnelReq, ch transport.Channel) (any, error) {
+	t := tunnel.FindTunnel(0, req.ProxyId)
+	if t == nil {
+		return req, nil
+	}
+	log.Info("Client %v stops serving the tunnel %s", ch.RemoteAddr(), req.ProxyId)
+	t.RemoveManager(ch)
+	return req, nil
+}
+
+// visitProcess connects the stream of a visitor client to a secret tunnel, the stream
+// carries the connection after the response is written.
+func visitProcess(req *exchange.VisitReq, ch transport.Channel) (any, error) {
+	sch, ok := ch.(*transport.SChannel)
+	if !ok {
+		return nil, fmt.Errorf("not support channel type:%T", ch)
+	}
+	if err := authorizeTunnel(req.UnId, req.SessionKey, req.ProxyId); err != nil {
+		return nil, err
+	}
+	t := tunnel.FindTunnel(0, req.ProxyId)
+	if t == nil {
+		return nil, fmt.Errorf("not found tunnel:%s", req.ProxyId)
+	}
+	vt, ok := t.(tunnel.VisitTunnel)
+	if !ok {
+		return nil, fmt.Errorf("tunnel %s can't be visited", req.ProxyId)
+	}
+	pipe, err := vt.Visit(ch, req.Secret)
+	if err != nil {
+		return nil, err
+	}
+	sch.IsOpenTunnel = true
+	log.Info("Visitor %v connected to tunnel %s", ch.RemoteAddr(), req.ProxyId)
+	return afterWrite{data: req, after: pipe}, nil
+}
+
 func clientWorkConnProcess(request *exchange.ClientWorkConnReq, ch transport.Channel) (any, error) {
+	if err := authorizeTunnel(request.UnId, request.SessionKey, request.ProxyId); err != nil {
+		return nil, err
+	}
 	switch sch := ch.(type) {
 	case *transport.SChannel:
 		// If it's a secure channel, mark it as a tunnel and add the proxy ID attribute
 		sch.IsOpenTunnel = true
 	}
 	port := request.TunnelPort
-	t := tunnel.GetTunnel(port)
+	t := tunnel.FindTunnel(port, request.ProxyId)
 	if t == nil {
 		// Log error and return error if tunnel is not found
 		log.Error("Not found tunnel: %d", port)
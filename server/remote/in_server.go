@@ -18,14 +18,17 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"net"
 	"os"
 
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/tlsx"
 	"github.com/g-brook/brook/common/transport"
 	"github.com/g-brook/brook/server/defin"
 	"github.com/g-brook/brook/server/srv"
@@ -42,8 +45,14 @@ type InServer struct {
 	//Current server.
 	server *srv.Server
 
+	//tlsServer serves the server port when TLS is enabled.
+	tlsServer *srv.DupServer
+
 	//tunnelServer
 	tunnelServer *srv.DupServer
+
+	//quicServer serves the tunnel port over QUIC when it's enabled.
+	quicServer *srv.QuicServer
 }
 
 func New() *InServer {
@@ -74,6 +83,12 @@ func (t *InServer) Reader(ch transport.Channel, traverse srv.TraverseBy) error {
 			return err
 		}
 		inProcess(req, ch)
+	} else if c, ok := ch.(*transport.CChannel); ok {
+		req, err := exchange.Decoder(c)
+		if err != nil {
+			return err
+		}
+		inProcess(req, ch)
 	}
 	if traverse != nil {
 		traverse()
@@ -104,11 +119,17 @@ func (t *InServer) Shutdown() {
 		// Shutdown the server
 		t.server.Shutdown(context.Background())
 	}
+	if t.tlsServer != nil {
+		t.tlsServer.Shutdown(context.Background())
+	}
 	// Check if the tunnel server is not nil
 	if t.tunnelServer != nil {
 		// Shutdown the tunnel server
 		t.tunnelServer.Shutdown(context.Background())
 	}
+	if t.quicServer != nil {
+		t.quicServer.Shutdown(context.Background())
+	}
 }
 
 // This function handles the processing of a request from a client
@@ -136,6 +157,10 @@ func inProcess(p *exchange.Protocol, conn transport.Channel) {
 	if !entry.isResponse() {
 		return
 	}
+	var after func()
+	if w, ok := data.(afterWrite); ok {
+		data, after = w.data, w.after
+	}
 	if data != nil {
 		// If there is data in the response, marshal it into bytes
 		byts, err := json.Marshal(data)
@@ -157,8 +182,14 @@ func inProcess(p *exchange.Protocol, conn transport.Channel) {
 	// If there is an error writing the response, log a warning
 	if err != nil {
 		log.Warn("Writer %s , marshal json, error %s ", cmd, err.Error())
+		if after != nil {
+			_ = conn.Close()
+		}
 		return
 	}
+	if after != nil {
+		after()
+	}
 }
 
 // Start
@@ -178,6 +209,9 @@ func (t *InServer) Start(cf *configs.ServerConfig) *InServer {
 
 // This function starts the InServer by starting the onStartServer and onStartTunnelServer functions in separate goroutines
 func (t *InServer) onStart(cf *configs.ServerConfig) {
+	if cf.TunnelPort < cf.ServerPort {
+		cf.TunnelPort = cf.ServerPort + 10
+	}
 	// Start the onStartServer function in a separate goroutine
 	threading.GoSafe(func() {
 		t.onStartServer(cf)
@@ -186,9 +220,31 @@ func (t *InServer) onStart(cf *configs.ServerConfig) {
 	threading.GoSafe(func() {
 		t.onStartTunnelServer(cf)
 	})
+	if cf.EnableQuic {
+		threading.GoSafe(func() {
+			t.onStartQuicServer(cf)
+		})
+	}
+	defin.Set(defin.P2pPortKey, 0)
+	if cf.P2pPort > 0 {
+		threading.GoSafe(func() {
+			t.onStartP2pServer(cf)
+		})
+	}
 }
 
 func (t *InServer) onStartServer(cf *configs.ServerConfig) {
+	if tlsx.IsEnable(cf.Tls) {
+		// gnet can't terminate TLS, so the server port falls back to net.Listener.
+		t.tlsServer = srv.NewDupServer(cf.ServerPort, srv.WithServerTls(newTlsConfig(cf)))
+		t.tlsServer.AddHandler(t)
+		err := t.tlsServer.Start()
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	t.server = srv.NewServer(cf.ServerPort)
 	t.server.AddHandler(t)
 	err := t.server.Start()
@@ -200,11 +256,11 @@ func (t *InServer) onStartServer(cf *configs.ServerConfig) {
 
 func (t *InServer) onStartTunnelServer(cf *configs.ServerConfig) {
 	port := cf.TunnelPort
-	if port < cf.ServerPort {
-		port = cf.ServerPort + 10
-		cf.TunnelPort = port
+	opts := []srv.ServerOption{srv.WithServerSmux(srv.DefaultServerSmux())}
+	if tlsx.IsEnable(cf.Tls) {
+		opts = append(opts, srv.WithServerTls(newTlsConfig(cf)))
 	}
-	t.tunnelServer = srv.NewDupServer(port, srv.WithServerSmux(srv.DefaultServerSmux()))
+	t.tunnelServer = srv.NewDupServer(port, opts...)
 	t.tunnelServer.AddHandler(t)
 	defin.Set(defin.TunnelPortKey, port)
 	err := t.tunnelServer.Start()
@@ -214,6 +270,58 @@ func (t *InServer) onStartTunnelServer(cf *configs.ServerConfig) {
 	}
 }
 
+// onStartQuicServer listens QUIC on the udp port that has the same number as the tunnel port.
+func (t *InServer) onStartQuicServer(cf *configs.ServerConfig) {
+	var tlsConfig *tls.Config
+	if tlsx.IsEnable(cf.Tls) {
+		tlsConfig = newTlsConfig(cf).Clone()
+	} else {
+		cert, err := tlsx.NewSelfSignedCertificate()
+		if err != nil {
+			log.Error("Generate quic certificate error: %v", err)
+			os.Exit(1)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	tlsConfig.NextProtos = []string{transport.QuicAlpn}
+	t.quicServer = srv.NewQuicServer(cf.TunnelPort, srv.WithServerTls(tlsConfig))
+	t.quicServer.AddHandler(t)
+	err := t.quicServer.Start()
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// onStartP2pServer tells the clients their public udp address, for the hole punching of
+// the p2p visitors.
+func (t *InServer) onStartP2pServer(cf *configs.ServerConfig) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: cf.P2pPort})
+	if err != nil {
+		log.Error("Start p2p server error: %v", err)
+		os.Exit(1)
+	}
+	defin.Set(defin.P2pPortKey, cf.P2pPort)
+	log.Info("P2p server started:%d", cf.P2pPort)
+	serveP2pProbe(conn)
+}
+
+func newTlsConfig(cf *configs.ServerConfig) *tls.Config {
+	tlsConfig, err := tlsx.NewServerConfig(cf.Tls)
+	if err != nil {
+		log.Error("Load tls config error: %v", err)
+		os.Exit(1)
+	}
+	return tlsConfig
+}
+
+// afterWrite is a response that runs after it was written, e.g. to start piping the stream
+// that carried the request.
+type afterWrite struct {
+	data  any
+	after func()
+}
+
 type handlerEntry struct {
 	newRequest func(data []byte) (exchange.InBound, error)
 	process    func(request exchange.InBound, conn transport.Channel) (any, error)
@@ -0,0 +1,128 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+	"github.com/g-brook/brook/server/tunnel"
+	"github.com/google/uuid"
+)
+
+// p2pAnswerTimeout is how long a visitor waits for the serving client to answer.
+const p2pAnswerTimeout = 10 * time.Second
+
+// p2pOffer is an offer waiting for the answer of the serving client.
+type p2pOffer struct {
+	managerId string
+	answer    chan *exchange.P2pAnswerReq
+}
+
+var p2pOffers = hash.NewSyncMap[string, *p2pOffer]()
+
+// serveP2pProbe answers each probe with the address it came from.
+func serveP2pProbe(conn *net.UDPConn) {
+	buf := make([]byte, 64)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Error("P2p server stopped: %v", err)
+			return
+		}
+		if string(buf[:n]) != exchange.P2pProbe {
+			continue
+		}
+		_, _ = conn.WriteToUDP([]byte(exchange.P2pProbe+addr.String()), addr)
+	}
+}
+
+// p2pVisitProcess asks a client serving the secret tunnel for its address and returns it
+// to the visitor. It waits for the answer, so it only runs on the streams of the tunnel
+// connection, each of which is read by its own goroutine.
+func p2pVisitProcess(req *exchange.P2pVisitReq, ch transport.Channel) (any, error) {
+	if _, ok := ch.(*transport.SChannel); !ok {
+		return nil, fmt.Errorf("not support channel type:%T", ch)
+	}
+	if defin.Get[int](defin.P2pPortKey) == 0 {
+		return nil, errors.New("p2p is disabled")
+	}
+	if err := authorizeTunnel(req.UnId, req.SessionKey, req.ProxyId); err != nil {
+		return nil, err
+	}
+	t := tunnel.FindTunnel(0, req.ProxyId)
+	if t == nil {
+		return nil, fmt.Errorf("not found tunnel:%s", req.ProxyId)
+	}
+	vt, ok := t.(tunnel.VisitTunnel)
+	if !ok {
+		return nil, fmt.Errorf("tunnel %s can't be visited", req.ProxyId)
+	}
+	if err := vt.Authorize(req.Secret); err != nil {
+		log.Warn("P2p visitor %v of tunnel %s: %v", ch.RemoteAddr(), req.ProxyId, err)
+		return nil, err
+	}
+	manager := vt.GetManager()
+	if manager == nil {
+		return nil, fmt.Errorf("no client serves tunnel %s", req.ProxyId)
+	}
+	offer := &p2pOffer{
+		managerId: manager.GetId(),
+		answer:    make(chan *exchange.P2pAnswerReq, 1),
+	}
+	sid := strings.ReplaceAll(uuid.NewString(), "-", "")
+	p2pOffers.Store(sid, offer)
+	defer p2pOffers.Delete(sid)
+	request, _ := exchange.NewRequest(&exchange.P2pOfferReq{
+		Sid:      sid,
+		ProxyId:  req.ProxyId,
+		PeerAddr: req.Addr,
+	})
+	if _, err := manager.Write(request.Bytes()); err != nil {
+		return nil, fmt.Errorf("offer p2p of tunnel %s error: %v", req.ProxyId, err)
+	}
+	select {
+	case answer := <-offer.answer:
+		if answer.Error != "" {
+			return nil, fmt.Errorf("p2p of tunnel %s: %s", req.ProxyId, answer.Error)
+		}
+		log.Info("P2p visitor %s meets %s of tunnel %s", req.Addr, answer.Addr, req.ProxyId)
+		return exchange.P2pVisitResp{Sid: sid, PeerAddr: answer.Addr, CertHash: answer.CertHash}, nil
+	case <-time.After(p2pAnswerTimeout):
+		return nil, fmt.Errorf("the client of tunnel %s didn't answer p2p", req.ProxyId)
+	}
+}
+
+// p2pAnswerProcess hands the answer of the serving client to the waiting visitor.
+func p2pAnswerProcess(req *exchange.P2pAnswerReq, ch transport.Channel) (any, error) {
+	offer, ok := p2pOffers.Load(req.Sid)
+	if !ok || offer.managerId != ch.GetId() {
+		return nil, fmt.Errorf("not found p2p offer:%s", req.Sid)
+	}
+	select {
+	case offer.answer <- req:
+	default:
+	}
+	return req, nil
+}
@@ -18,6 +18,7 @@ package srv
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -55,16 +56,23 @@ func NewDupServer(port int, opt ...ServerOption) *DupServer {
 }
 
 func (sever *DupServer) Start() error {
-	if !sever.isTunnelServer() {
+	if sever.isTunnelServer() {
+		sever.streamAssignment()
+	} else if sever.isTls() {
+		sever.connAssignment()
+	} else {
 		return errors.New("server is disabled,please use server")
 	}
-	sever.streamAssignment()
 	addr := fmt.Sprintf(":%d", sever.port)
 	listener, err := net.Listen(string(sever.opts.network), addr)
 	if err != nil {
 		log.Error("Server Listen %s error: %v", addr, err)
 		return err
 	}
+	if sever.isTls() {
+		listener = tls.NewListener(listener, sever.opts.tlsConfig)
+		log.Info("Server Listen %s with TLS", addr)
+	}
 	log.Info("Server Listen %s success", addr)
 	sever.ln = listener
 	for {
@@ -142,6 +150,10 @@ func (sever *DupServer) isTunnelServer() bool {
 	return sever.opts.withSmux != nil && sever.opts.withSmux.enable
 }
 
+func (sever *DupServer) isTls() bool {
+	return sever.opts.tlsConfig != nil
+}
+
 func (sever *DupServer) next(fun func(s ServerHandler, conn trp.Channel) (bool, error), conn trp.Channel) error {
 	for i := 0; i < len(sever.handlers); i++ {
 		var newCh trp.Channel
@@ -186,19 +198,9 @@ func (sever *DupServer) streamAssignment() {
 				}
 				log.Info("accept success stream. %s:%s", conn.LocalAddr(), stream.RemoteAddr())
 				channel := trp.NewSChannel(stream, context.Background(), false)
-				err = sever.OnOpen(channel)
-				if err != nil {
-					if err == io.EOF {
-						sever.OnClose(channel)
-						return
-					}
-					log.Error("Tunnel Server next error. %v", err)
-					sever.OnError(channel, err)
+				if err = sever.openChannel(channel); err == io.EOF {
+					return
 				}
-				threading.GoSafe(func() {
-					sever.readLoopStream(channel)
-				})
-				addHealthyCheckStream(channel)
 			}
 
 		})
@@ -206,6 +208,58 @@ func (sever *DupServer) streamAssignment() {
 	}
 }
 
+// openChannel runs a new stream through the handlers and starts reading it.
+func (sever *DupServer) openChannel(channel *trp.SChannel) error {
+	err := sever.OnOpen(channel)
+	if err != nil {
+		if err == io.EOF {
+			sever.OnClose(channel)
+			return err
+		}
+		log.Error("Tunnel Server next error. %v", err)
+		sever.OnError(channel, err)
+	}
+	threading.GoSafe(func() {
+		sever.readLoopStream(channel)
+	})
+	addHealthyCheckStream(channel)
+	return nil
+}
+
+// connAssignment serves every accepted connection as one channel, without smux.
+func (sever *DupServer) connAssignment() {
+	sever.startTunnelServer = func(conn net.Conn, option *SmuxServerOption) error {
+		channel := trp.NewCChannel(conn, context.Background())
+		err := sever.OnOpen(channel)
+		if err != nil {
+			log.Error("Server open channel error. %v", err)
+			sever.OnClose(channel)
+			return err
+		}
+		threading.GoSafe(func() {
+			sever.readLoopConn(channel)
+		})
+		return nil
+	}
+}
+
+func (sever *DupServer) readLoopConn(ch *trp.CChannel) {
+	for {
+		if ch.IsClose() {
+			break
+		}
+		err := sever.OnRead(ch)
+		if err != nil {
+			if err != io.EOF {
+				log.Debug("Server read error. %v", err)
+				sever.OnError(ch, err)
+			}
+			break
+		}
+	}
+	sever.OnClose(ch)
+}
+
 func (sever *DupServer) readLoopStream(ch *trp.SChannel) {
 	for {
 		if ch.IsOpenTunnel {
@@ -50,6 +50,14 @@ type GChannel struct {
 
 	isDatagram bool
 
+	// headerPending the PROXY protocol header of the connection hasn't been read yet.
+	headerPending bool
+
+	// remoteAddr and localAddr are the addresses the PROXY protocol header told.
+	remoteAddr net.Addr
+
+	localAddr net.Addr
+
 	once sync.Once
 }
 
@@ -161,10 +169,16 @@ func (c *GChannel) IsClose() bool {
 }
 
 func (c *GChannel) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
 	return c.conn.RemoteAddr()
 }
 
 func (c *GChannel) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
 	return c.conn.LocalAddr()
 }
 
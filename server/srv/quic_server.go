@@ -0,0 +1,87 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package srv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+	trp "github.com/g-brook/brook/common/transport"
+	"github.com/quic-go/quic-go"
+)
+
+// QuicServer serves tunnel streams over QUIC. Every QUIC stream becomes a SChannel
+// and goes through the same handlers as a smux stream of DupServer.
+type QuicServer struct {
+	*DupServer
+	ln *quic.Listener
+}
+
+// NewQuicServer creates a QUIC server, WithServerTls is required.
+func NewQuicServer(port int, opt ...ServerOption) *QuicServer {
+	return &QuicServer{
+		DupServer: NewDupServer(port, opt...),
+	}
+}
+
+func (q *QuicServer) Start() error {
+	if !q.isTls() {
+		return fmt.Errorf("quic server %d requires a tls config", q.port)
+	}
+	addr := fmt.Sprintf(":%d", q.port)
+	listener, err := quic.ListenAddr(addr, q.opts.tlsConfig, trp.NewQuicConfig())
+	if err != nil {
+		log.Error("Quic Server Listen %s error: %v", addr, err)
+		return err
+	}
+	log.Info("Quic Server Listen %s success", addr)
+	q.ln = listener
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			log.Error("Quic Server Accept error: %v", err)
+			q.OnError(nil, err)
+			break
+		}
+		threading.GoSafe(func() {
+			q.acceptStreams(conn)
+		})
+	}
+	return nil
+}
+
+func (q *QuicServer) acceptStreams(conn *quic.Conn) {
+	log.Debug("Start quic server accept stream. %s:%s", conn.LocalAddr(), conn.RemoteAddr())
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			log.Error("quic connection is close.PORT:%v, %v", conn.LocalAddr(), err.Error())
+			return
+		}
+		channel := trp.NewSChannel(trp.NewQuicStream(stream, conn), context.Background(), false)
+		_ = q.openChannel(channel)
+	}
+}
+
+func (q *QuicServer) Shutdown(ctx context.Context) {
+	log.Info("Quic Server shutdown: %d.", q.port)
+	if q.ln != nil {
+		_ = q.ln.Close()
+	}
+}
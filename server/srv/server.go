@@ -25,6 +25,7 @@ import (
 	"github.com/g-brook/brook/common/hash"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/proxyproto"
 	trp "github.com/g-brook/brook/common/transport"
 	"github.com/panjf2000/gnet/v2"
 )
@@ -157,6 +158,14 @@ func (sever *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 	log.Debug("Open an Connection: %s", c.RemoteAddr().String())
 	c.SetContext(NewConnContext(false, ""))
 	conn := NewChannel(c, sever)
+	if sever.opts.proxyProtocol && !sever.isDatagram() {
+		conn.headerPending = true
+		return nil, gnet.None
+	}
+	return nil, sever.open(conn)
+}
+
+func (sever *Server) open(conn *GChannel) gnet.Action {
 	defer sever.removeIfConnection(conn)
 	err := sever.next(func(s ServerHandler, newCh trp.Channel) (bool, error) {
 		b := true
@@ -167,9 +176,34 @@ func (sever *Server) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 	}, conn)
 	if err != nil {
 		_ = conn.Close()
-		return nil, gnet.Close
+		return gnet.Close
+	}
+	return gnet.None
+}
+
+// readProxyHeader reads the PROXY protocol header in front of the data of the connection,
+// and opens the handlers with the addresses it tells.
+func (sever *Server) readProxyHeader(conn *GChannel) gnet.Action {
+	buf, err := conn.Peek(-1)
+	if err != nil {
+		return gnet.Close
+	}
+	header, n, err := proxyproto.Parse(buf)
+	if errors.Is(err, proxyproto.ErrIncomplete) {
+		return gnet.None
+	}
+	if err != nil {
+		log.Warn("Server %d read PROXY protocol header of %v error: %v", sever.port, conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return gnet.Close
+	}
+	_, _ = conn.Discard(n)
+	conn.headerPending = false
+	if header.Src != nil && header.Dst != nil {
+		conn.remoteAddr = header.Src
+		conn.localAddr = header.Dst
 	}
-	return nil, gnet.None
+	return sever.open(conn)
 }
 
 func (sever *Server) OnTraffic(c gnet.Conn) gnet.Action {
@@ -179,6 +213,11 @@ func (sever *Server) OnTraffic(c gnet.Conn) gnet.Action {
 		return gnet.Close
 	}
 	defer sever.removeIfConnection(conn)
+	if conn.headerPending {
+		if action := sever.readProxyHeader(conn); action != gnet.None || conn.headerPending || c.InboundBuffered() == 0 {
+			return action
+		}
+	}
 	conn.GetContext().LastActive()
 	sever.next(func(s ServerHandler, newCh trp.Channel) (bool, error) {
 		b := true
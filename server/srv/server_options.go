@@ -17,6 +17,7 @@
 package srv
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/g-brook/brook/common/lang"
@@ -34,6 +35,8 @@ type sOptions struct {
 	withSmux       *SmuxServerOption
 	network        lang.Network
 	newChannelFunc NewChannelFunction
+	tlsConfig      *tls.Config
+	proxyProtocol  bool
 }
 
 // SmuxServerOption
@@ -102,3 +105,25 @@ func WithNetwork(pt lang.Network) ServerOption {
 		opts.network = pt
 	}
 }
+
+// WithServerTls
+//
+//	@Description: Serve the listener over TLS. Only supported by DupServer.
+//	@param cfg
+//	@return ServerOption
+func WithServerTls(cfg *tls.Config) ServerOption {
+	return func(opts *sOptions) {
+		opts.tlsConfig = cfg
+	}
+}
+
+// WithProxyProtocol
+//
+//	@Description: Read the PROXY protocol header in front of the data of a tcp connection,
+//	the handlers are opened once it tells the address of the visitor.
+//	@return ServerOption
+func WithProxyProtocol() ServerOption {
+	return func(opts *sOptions) {
+		opts.proxyProtocol = true
+	}
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tunnel
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/loadbalance"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/transport"
+)
+
+// failCooldown is how long a client isn't selected after a failure.
+var failCooldown = 30 * time.Second
+
+// Backend is a client serving a tunnel, reached by its manager channel.
+type Backend struct {
+	Manager transport.Channel
+	// Weight of the client for the weighted strategy, at least 1.
+	Weight int
+	// Standby clients only get traffic when no primary client is healthy.
+	Standby   bool
+	downUntil time.Time
+}
+
+// Healthy reports whether the client is connected and not cooling down after a failure.
+func (b *Backend) Healthy() bool {
+	return !b.Manager.IsClose() && time.Now().After(b.downUntil)
+}
+
+// Backends selects the client of the tunnel for the new user connections.
+type Backends struct {
+	lock     sync.Mutex
+	backends map[string]*Backend
+	// channels binds the tunnel channels to the id of the backend that registered them.
+	channels *hash.SyncMap[string, string]
+	balance  loadbalance.Balance
+	strategy string
+}
+
+// NewBackends creates the backends with the strategy of the tunnel, weighted round robin
+// by default so the weights of the clients are always honored.
+func NewBackends(strategy string) *Backends {
+	b := &Backends{
+		backends: make(map[string]*Backend),
+		channels: hash.NewSyncMap[string, string](),
+	}
+	b.SetStrategy(strategy)
+	return b
+}
+
+// SetStrategy replaces the balance when the strategy of the tunnel changed on reload.
+func (b *Backends) SetStrategy(strategy string) {
+	if strategy == "" {
+		strategy = string(loadbalance.StrategyWeighted)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.balance != nil && b.strategy == strategy {
+		return
+	}
+	b.strategy = strategy
+	b.balance = loadbalance.NewBalance(loadbalance.Strategy(strategy), b.weight, b.load)
+}
+
+// Put adds the manager channel of a client.
+func (b *Backends) Put(manager transport.Channel) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[manager.GetId()]; ok {
+		backend.Manager = manager
+		return
+	}
+	b.backends[manager.GetId()] = &Backend{
+		Manager: manager,
+		Weight:  1,
+	}
+}
+
+// Remove removes the client of the manager channel.
+func (b *Backends) Remove(manager transport.Channel) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[manager.GetId()]; ok && backend.Manager == manager {
+		delete(b.backends, manager.GetId())
+	}
+}
+
+// Bind binds a registered tunnel channel to the client of the manager channel it proved
+// with the session key, with the weight and the role the client registered with; a
+// channel that proved none keeps the clients as they are.
+func (b *Backends) Bind(ch transport.Channel, managerId string, weight int, standby bool) {
+	if managerId == "" {
+		return
+	}
+	b.channels.Store(ch.GetId(), managerId)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[managerId]; ok {
+		backend.Weight = max(weight, 1)
+		backend.Standby = standby
+	}
+}
+
+// Unbind removes the binding of a closed tunnel channel.
+func (b *Backends) Unbind(ch transport.Channel) {
+	b.channels.Delete(ch.GetId())
+}
+
+// BackendOf returns the client that registered the tunnel channel.
+func (b *Backends) BackendOf(ch transport.Channel) (Backend, bool) {
+	managerId, ok := b.channels.Load(ch.GetId())
+	if !ok {
+		return Backend{}, false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	backend, ok := b.backends[managerId]
+	if !ok {
+		return Backend{}, false
+	}
+	return *backend, true
+}
+
+// Failed keeps the client of the manager channel out of the selection for a while.
+func (b *Backends) Failed(manager transport.Channel) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[manager.GetId()]; ok {
+		backend.downUntil = time.Now().Add(failCooldown)
+		log.Warn("Tunnel client %v failed, skip it for %v", manager.RemoteAddr(), failCooldown)
+	}
+}
+
+// Len returns the count of the clients.
+func (b *Backends) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.backends)
+}
+
+// Serving returns the ids of the clients that get the new connections: the healthy
+// primaries, the healthy standbys when no primary is healthy, and the connected clients
+// when all of them are cooling down.
+func (b *Backends) Serving() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var primaries, standbys, connected []string
+	for id, backend := range b.backends {
+		if backend.Manager.IsClose() {
+			delete(b.backends, id)
+			continue
+		}
+		connected = append(connected, id)
+		if !backend.Healthy() {
+			continue
+		}
+		if backend.Standby {
+			standbys = append(standbys, id)
+		} else {
+			primaries = append(primaries, id)
+		}
+	}
+	if len(primaries) > 0 {
+		return primaries
+	}
+	if len(standbys) > 0 {
+		return standbys
+	}
+	return connected
+}
+
+// Select returns the manager channel of the client for a new connection.
+func (b *Backends) Select() transport.Channel {
+	ids := b.Serving()
+	// The balance keeps its state by position, so keep the order stable.
+	slices.Sort(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	b.lock.Lock()
+	balance := b.balance
+	b.lock.Unlock()
+	id := balance.Select(ids)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[id]; ok {
+		return backend.Manager
+	}
+	return nil
+}
+
+func (b *Backends) weight(id string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if backend, ok := b.backends[id]; ok {
+		return backend.Weight
+	}
+	return 1
+}
+
+// load counts the tunnel channels of the client, the work connections in use.
+func (b *Backends) load(id string) int {
+	n := 0
+	b.channels.Range(func(_ string, managerId string) bool {
+		if managerId == id {
+			n++
+		}
+		return true
+	})
+	return n
+}
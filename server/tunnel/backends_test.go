@@ -0,0 +1,185 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tunnel
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+)
+
+// testChannel is a manager or tunnel channel with an id and the attributes of its
+// registration.
+type testChannel struct {
+	transport.Channel
+	id     string
+	closed atomic.Bool
+	attrs  map[lang.KeyType]any
+}
+
+func (c *testChannel) GetId() string                { return c.id }
+func (c *testChannel) IsClose() bool                { return c.closed.Load() }
+func (c *testChannel) OnClose(transport.CloseEvent) {}
+func (c *testChannel) RemoteAddr() net.Addr         { return &net.TCPAddr{} }
+
+func (c *testChannel) GetAttr(key lang.KeyType) (any, bool) {
+	v, ok := c.attrs[key]
+	return v, ok
+}
+
+// testBackend a client of the tunnel as it's put and bound.
+type testBackend struct {
+	id      string
+	weight  int
+	standby bool
+	failed  bool
+	closed  bool
+}
+
+func newTestBackends(strategy string, clients ...testBackend) *Backends {
+	b := NewBackends(strategy)
+	for _, c := range clients {
+		manager := &testChannel{id: c.id}
+		b.Put(manager)
+		b.Bind(&testChannel{id: c.id + "-tunnel"}, c.id, c.weight, c.standby)
+		if c.failed {
+			b.Failed(manager)
+		}
+		manager.closed.Store(c.closed)
+	}
+	return b
+}
+
+func TestBackendsServing(t *testing.T) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	tests := []struct {
+		name    string
+		clients []testBackend
+		want    []string
+	}{
+		{"primaries", []testBackend{{id: "a"}, {id: "b"}, {id: "s", standby: true}}, []string{"a", "b"}},
+		{"failing primary", []testBackend{{id: "a", failed: true}, {id: "b"}, {id: "s", standby: true}}, []string{"b"}},
+		{"failing primaries to standby", []testBackend{{id: "a", failed: true}, {id: "s", standby: true}}, []string{"s"}},
+		{"closed primary to standby", []testBackend{{id: "a", closed: true}, {id: "s", standby: true}}, []string{"s"}},
+		{"all failing", []testBackend{{id: "a", failed: true}, {id: "s", standby: true, failed: true}}, []string{"a", "s"}},
+		{"all closed", []testBackend{{id: "a", closed: true}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newTestBackends("", tt.clients...).Serving()
+			if !sameIds(got, tt.want) {
+				t.Fatalf("Serving = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendsCooldown(t *testing.T) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	old := failCooldown
+	failCooldown = 100 * time.Millisecond
+	t.Cleanup(func() { failCooldown = old })
+	b := newTestBackends("", testBackend{id: "a", failed: true}, testBackend{id: "s", standby: true})
+	if got := b.Select(); got == nil || got.GetId() != "s" {
+		t.Fatalf("Select while a cools down = %v, want s", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := b.Select(); got == nil || got.GetId() != "a" {
+		t.Fatalf("Select after the cooldown = %v, want a", got)
+	}
+}
+
+func TestBackendsSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		clients  []testBackend
+		want     map[string]int
+	}{
+		{"weighted", "", []testBackend{{id: "a", weight: 3}, {id: "b", weight: 1}}, map[string]int{"a": 75, "b": 25}},
+		{"weight at least 1", "", []testBackend{{id: "a", weight: 0}, {id: "b", weight: -2}}, map[string]int{"a": 50, "b": 50}},
+		{"round robin ignores weight", "roundRobin", []testBackend{{id: "a", weight: 3}, {id: "b"}}, map[string]int{"a": 50, "b": 50}},
+		{"standby gets none", "", []testBackend{{id: "a"}, {id: "s", standby: true, weight: 5}}, map[string]int{"a": 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackends(tt.strategy, tt.clients...)
+			got := map[string]int{}
+			for i := 0; i < 100; i++ {
+				got[b.Select().GetId()]++
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Select spread %v, want %v", got, tt.want)
+			}
+			for id, n := range tt.want {
+				if got[id] != n {
+					t.Fatalf("Select spread %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterConnBindsTheProvenManager(t *testing.T) {
+	b := NewBaseTunnelServer(&configs.ServerTunnelConfig{Id: "t", Type: lang.Tcp})
+	a, victim := &testChannel{id: "a"}, &testChannel{id: "victim"}
+	b.PutManager(a)
+	b.PutManager(victim)
+	// a claims the unId of the victim, but proved the session of a.
+	ch := &testChannel{id: "tunnel", attrs: map[lang.KeyType]any{defin.ManagerIdKey: "a"}}
+	if _, err := b.RegisterConn(ch, &exchange.RegisterReqAndRsp{UnId: "victim", Weight: 5, Standby: true}); err != nil {
+		t.Fatal(err)
+	}
+	if backend, ok := b.Backends.BackendOf(ch); !ok || backend.Manager != a || backend.Weight != 5 || !backend.Standby {
+		t.Fatalf("tunnel channel bound to %+v, want a with weight 5 on standby", backend)
+	}
+	// A channel that proved no manager changes none.
+	anon := &testChannel{id: "anon"}
+	if _, err := b.RegisterConn(anon, &exchange.RegisterReqAndRsp{UnId: "victim", Standby: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Backends.BackendOf(anon); ok {
+		t.Fatal("tunnel channel without a proven manager bound")
+	}
+	if got := b.Backends.Select(); got != victim {
+		t.Fatalf("Select = %v, want the victim still a primary", got)
+	}
+}
+
+func sameIds(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := map[string]bool{}
+	for _, id := range got {
+		seen[id] = true
+	}
+	for _, id := range want {
+		if !seen[id] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package base
+
+import (
+	"sort"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+)
+
+// ClientTunnels returns the client side of the tunnel configs, so that a client can take
+// its tunnels from the server. Tunnels without a destination can't be served and are skipped,
+// an http tunnel is served for all of its routes.
+func ClientTunnels() []*configs.ClientTunnelConfig {
+	if TunnelCfm.ConfigApi == nil {
+		return nil
+	}
+	var tunnels []*configs.ClientTunnelConfig
+	for _, node := range TunnelCfm.ConfigApi.All() {
+		cfg := node.Config
+		if cfg.Destination == "" {
+			log.Debug("tunnel %s has no destination, not delivered to the clients", cfg.Id)
+			continue
+		}
+		tunnel := &configs.ClientTunnelConfig{
+			TunnelType:  cfg.Type,
+			ProxyId:     cfg.Id,
+			Destination: cfg.Destination,
+		}
+		if cfg.Type == lang.Http || cfg.Type == lang.Https {
+			if len(cfg.Http) == 0 {
+				continue
+			}
+			tunnel.HttpId = cfg.Http[0].Id
+			for _, h := range cfg.Http {
+				tunnel.HttpIds = append(tunnel.HttpIds, h.Id)
+			}
+		}
+		tunnels = append(tunnels, tunnel)
+	}
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].ProxyId < tunnels[j].ProxyId
+	})
+	return tunnels
+}
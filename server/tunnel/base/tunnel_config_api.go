@@ -27,6 +27,7 @@ import (
 	"github.com/g-brook/brook/common/modules"
 	"github.com/g-brook/brook/common/queue"
 	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/server/remote"
 )
 
 type ConfigNode struct {
@@ -46,6 +47,12 @@ type TunnelConfigApi interface {
 	UpdateConfig(proxyId string) *ConfigNode
 
 	Store(cfgId string, cfg *ConfigNode)
+
+	// Delete remove the tunnel configs by proxy id.
+	Delete(cfgId string)
+
+	// All get all tunnel configs.
+	All() []*ConfigNode
 }
 
 var TunnelCfm = &ConfigManager{
@@ -63,6 +70,8 @@ func TransformProtocol(protocol string) lang.TunnelType {
 		return lang.Tcp
 	case "UDP":
 		return lang.Udp
+	case "QUIC":
+		return lang.Quic
 	default:
 		return ""
 	}
@@ -97,6 +106,7 @@ func (receiver *ConfigManager) Running(api TunnelConfigApi) {
 						load(newConfig)
 					}
 				}
+				remote.PushClientTunnels()
 			}
 		}
 	})
@@ -29,6 +29,8 @@ import (
 	"github.com/g-brook/brook/server/remote"
 	"github.com/g-brook/brook/server/tunnel"
 	"github.com/g-brook/brook/server/tunnel/http"
+	"github.com/g-brook/brook/server/tunnel/quic"
+	"github.com/g-brook/brook/server/tunnel/socks5"
 	"github.com/g-brook/brook/server/tunnel/tcp"
 )
 
@@ -37,6 +39,7 @@ var servers *hash.SyncMap[string, tunnel.TunnelServer]
 func init() {
 	servers = hash.NewSyncMap[string, tunnel.TunnelServer]()
 	remote.OpenTunnelServerFun = OpenTunnelServer
+	remote.ClientTunnelsFun = ClientTunnels
 }
 
 // OpenTunnelServer open tcp tunnel server
@@ -51,7 +54,7 @@ func OpenTunnelServer(request *exchange.OpenTunnelReq, manager Channel) (*remote
 	t, b := servers.Load(cfgNode.Config.Id)
 	if b {
 		t.PutManager(manager)
-		return remote.NewTunnelCfg(cfgNode.Config.Port, cfgNode.Config.Destination), nil
+		return tunnelCfg(cfgNode.Config, cfgNode.Config.Port), nil
 	}
 	baseServer, err := running(cfgNode.Config)
 	if err != nil {
@@ -64,7 +67,17 @@ func OpenTunnelServer(request *exchange.OpenTunnelReq, manager Channel) (*remote
 		})
 		t.PutManager(manager)
 	}
-	return remote.NewTunnelCfg(baseServer.Port(), baseServer.Cfg.Destination), err
+	return tunnelCfg(baseServer.Cfg(), baseServer.Port()), err
+}
+
+// tunnelCfg tells the client the destination of the tunnel and the network it takes, a
+// quic tunnel that doesn't terminate QUIC relays the packets to a udp destination.
+func tunnelCfg(config *configs.ServerTunnelConfig, port int) *remote.TunnelCfg {
+	cfg := remote.NewTunnelCfg(port, config.Destination)
+	if config.Type == lang.Quic && !config.Terminate {
+		cfg.Network = string(lang.NetworkUdp)
+	}
+	return cfg
 }
 
 func running(config *configs.ServerTunnelConfig) (*tunnel.BaseTunnelServer, error) {
@@ -77,6 +90,16 @@ func running(config *configs.ServerTunnelConfig) (*tunnel.BaseTunnelServer, erro
 	} else if config.Type == lang.Udp {
 		server = tcp.NewUdpTunnelServer(baseServer)
 		netWork = lang.NetworkUdp
+	} else if config.Type == lang.Quic && config.Terminate {
+		server = quic.NewQuicTunnelServer(baseServer)
+		netWork = lang.NetworkUdp
+	} else if config.Type == lang.Quic {
+		//The QUIC packets are relayed as they are, the client's local service ends QUIC.
+		server = tcp.NewUdpTunnelServer(baseServer)
+		netWork = lang.NetworkUdp
+	} else if config.Type == lang.Socks5 {
+		server = socks5.NewSocks5TunnelServer(baseServer)
+		netWork = lang.NetworkTcp
 	} else if config.Type == lang.Https || config.Type == lang.Http {
 		tunnelServer, err := http.NewHttpTunnelServer(baseServer)
 		if err != nil {
@@ -0,0 +1,49 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package base
+
+import (
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+)
+
+func TestTunnelCfg(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  configs.ServerTunnelConfig
+		network string
+	}{
+		{"quic relays the packets", configs.ServerTunnelConfig{Type: lang.Quic}, string(lang.NetworkUdp)},
+		{"quic terminates", configs.ServerTunnelConfig{Type: lang.Quic, Terminate: true}, ""},
+		{"tcp", configs.ServerTunnelConfig{Type: lang.Tcp}, ""},
+		{"udp", configs.ServerTunnelConfig{Type: lang.Udp}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Destination = "127.0.0.1:4433"
+			cfg := tunnelCfg(&tt.config, 9000)
+			if cfg.RemotePort != 9000 || cfg.Destination != "127.0.0.1:4433" {
+				t.Fatalf("tunnelCfg = %+v", cfg)
+			}
+			if cfg.Network != tt.network {
+				t.Fatalf("Network = %q, want %q", cfg.Network, tt.network)
+			}
+		})
+	}
+}
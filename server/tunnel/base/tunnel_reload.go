@@ -0,0 +1,148 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package base
+
+import (
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/server/remote"
+	"github.com/g-brook/brook/server/tunnel"
+)
+
+// drainTimeout is how long a removed tunnel server waits for its user connections.
+var drainTimeout = 30 * time.Second
+
+// Reload diffs the tunnel configs against the running tunnel servers.
+// New tunnels are started when a client opens them, removed tunnels stop accepting at
+// once and are shut down after their connections drain, and routes, certificates and ip strategies of the running
+// tunnels are updated in place. A tunnel whose listener changed, see listenerChanged, is
+// restarted for the clients that had opened it.
+func (receiver *ConfigManager) Reload(cfgs []*configs.ServerTunnelConfig) {
+	if receiver.ConfigApi == nil {
+		return
+	}
+	newCfgs := make(map[string]*configs.ServerTunnelConfig, len(cfgs))
+	for _, cfg := range cfgs {
+		newCfgs[cfg.Id] = cfg
+	}
+	for _, node := range receiver.ConfigApi.All() {
+		id := node.Config.Id
+		if _, ok := newCfgs[id]; ok {
+			continue
+		}
+		log.Info("Reload: tunnel %s removed", id)
+		receiver.ConfigApi.Delete(id)
+		receiver.stop(id)
+	}
+	for id, cfg := range newCfgs {
+		old := receiver.ConfigApi.GetConfig(id)
+		if old != nil && reflect.DeepEqual(*old.Config, *cfg) {
+			continue
+		}
+		node := &ConfigNode{Config: cfg}
+		receiver.ConfigApi.Store(id, node)
+		if old == nil {
+			log.Info("Reload: tunnel %s added", id)
+			continue
+		}
+		if listenerChanged(old.Config, cfg) {
+			log.Info("Reload: tunnel %s changed to %s:%d, restart it", id, cfg.Type, cfg.Port)
+			receiver.restart(node)
+			continue
+		}
+		log.Info("Reload: tunnel %s updated", id)
+		if notify, ok := receiver.listens.Load(id); ok {
+			notify(node)
+		}
+	}
+	remote.PushClientTunnels()
+}
+
+// listenerChanged tells whether the listener of the tunnel is set up differently: the port,
+// the type, a secret tcp tunnel, the PROXY protocol and how a quic tunnel ends QUIC, its
+// ALPN and certificate. The others, e.g. http2 of a http tunnel, are read per connection.
+func listenerChanged(old, cfg *configs.ServerTunnelConfig) bool {
+	if old.Port != cfg.Port || old.Type != cfg.Type || (old.Secret == "") != (cfg.Secret == "") ||
+		old.ProxyProtocol != cfg.ProxyProtocol || old.Terminate != cfg.Terminate ||
+		!slices.Equal(old.Alpn, cfg.Alpn) {
+		return true
+	}
+	return cfg.Type == lang.Quic && (old.IsFileCert != cfg.IsFileCert || old.CertFile != cfg.CertFile ||
+		old.KeyFile != cfg.KeyFile || old.CertContent != cfg.CertContent || old.KeyContent != cfg.KeyContent)
+}
+
+// stop removes the running tunnel server of the proxy id and shuts it down in the background.
+func (receiver *ConfigManager) stop(proxyId string) {
+	t, ok := servers.LoadAndDelete(proxyId)
+	if !ok {
+		return
+	}
+	receiver.listens.Delete(proxyId)
+	tunnel.RemoveTunnel(t)
+	t.StopAccept()
+	threading.GoSafe(func() {
+		drain(t)
+	})
+}
+
+// restart stops the old tunnel server at once, the port may be reused by the new one,
+// and opens the new one for the managers of the old one.
+func (receiver *ConfigManager) restart(node *ConfigNode) {
+	t, ok := servers.LoadAndDelete(node.Config.Id)
+	if !ok {
+		return
+	}
+	receiver.listens.Delete(node.Config.Id)
+	tunnel.RemoveTunnel(t)
+	t.Shutdown()
+	managers := t.Managers()
+	if len(managers) == 0 {
+		return
+	}
+	node.openLock.Lock()
+	defer node.openLock.Unlock()
+	baseServer, err := running(node.Config)
+	if err != nil {
+		log.Error("Reload: restart tunnel %s error: %v", node.Config.Id, err)
+		return
+	}
+	receiver.AddListen(node.Config.Id, func(cfg *ConfigNode) {
+		baseServer.UpdateConfig(cfg.Config)
+	})
+	if newServer, ok := servers.Load(node.Config.Id); ok {
+		for _, manager := range managers {
+			newServer.PutManager(manager)
+		}
+	}
+}
+
+// drain waits until the user connections the tunnel had accepted before it stopped
+// accepting are closed, or the drain timeout passes.
+func drain(t tunnel.TunnelServer) {
+	deadline := time.Now().Add(drainTimeout)
+	for t.Connections() > 0 && time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+	}
+	log.Info("Reload: tunnel %s:%d stopped", t.Id(), t.Port())
+	t.Shutdown()
+}
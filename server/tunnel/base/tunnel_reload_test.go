@@ -0,0 +1,242 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package base
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/modules"
+	"github.com/g-brook/brook/common/queue"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/tunnel"
+)
+
+// testConfigApi keeps the tunnel configs in memory.
+type testConfigApi struct {
+	lock  sync.Mutex
+	nodes map[string]*ConfigNode
+}
+
+func (a *testConfigApi) Module() modules.ModuleInfo {
+	return modules.ModuleInfo{}
+}
+
+func (a *testConfigApi) GetConfig(proxyId string) *ConfigNode {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.nodes[proxyId]
+}
+
+func (a *testConfigApi) UpdateConfig(proxyId string) *ConfigNode {
+	return a.GetConfig(proxyId)
+}
+
+func (a *testConfigApi) Store(cfgId string, cfg *ConfigNode) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.nodes[cfgId] = cfg
+}
+
+func (a *testConfigApi) Delete(cfgId string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.nodes, cfgId)
+}
+
+func (a *testConfigApi) All() []*ConfigNode {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	nodes := make([]*ConfigNode, 0, len(a.nodes))
+	for _, node := range a.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// testServer is a running tunnel server that records how it's stopped.
+type testServer struct {
+	tunnel.TunnelServer
+	id         string
+	port       int
+	managers   []transport.Channel
+	stopAccept atomic.Bool
+	shutdown   atomic.Bool
+}
+
+func (s *testServer) Id() string                        { return s.id }
+func (s *testServer) Port() int                         { return s.port }
+func (s *testServer) Managers() []transport.Channel     { return s.managers }
+func (s *testServer) PutManager(ch transport.Channel)   { s.managers = append(s.managers, ch) }
+func (s *testServer) Connections() int                  { return 0 }
+func (s *testServer) StopAccept()                       { s.stopAccept.Store(true) }
+func (s *testServer) Shutdown()                         { s.shutdown.Store(true) }
+func (s *testServer) RemoveManager(_ transport.Channel) {}
+
+// testChannel is a manager channel with just an id.
+type testChannel struct {
+	transport.Channel
+	id string
+}
+
+func (c *testChannel) GetId() string                { return c.id }
+func (c *testChannel) IsClose() bool                { return false }
+func (c *testChannel) OnClose(transport.CloseEvent) {}
+func (c *testChannel) RemoteAddr() net.Addr         { return &net.TCPAddr{} }
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestConfigManagerReload(t *testing.T) {
+	old := drainTimeout
+	drainTimeout = time.Second
+	t.Cleanup(func() { drainTimeout = old })
+
+	api := &testConfigApi{nodes: map[string]*ConfigNode{}}
+	manager := &ConfigManager{
+		ConfigApi: api,
+		queue:     queue.NewMemoryQueue[string](1),
+		listens:   hash.NewSyncMap[string, ConfigNotify](),
+	}
+	kept := &configs.ServerTunnelConfig{Id: "kept", Type: lang.Tcp, Port: 9001, Destination: "127.0.0.1:80"}
+	updated := &configs.ServerTunnelConfig{Id: "updated", Type: lang.Tcp, Port: 9002, Destination: "127.0.0.1:80"}
+	removed := &configs.ServerTunnelConfig{Id: "removed", Type: lang.Tcp, Port: 9003}
+	quic := &configs.ServerTunnelConfig{Id: "quic", Type: lang.Quic, Port: 9004, Terminate: true}
+	moved := &configs.ServerTunnelConfig{Id: "moved", Type: lang.Tcp, Port: freePort(t)}
+	running := map[string]*testServer{}
+	var notified sync.Map
+	for _, cfg := range []*configs.ServerTunnelConfig{kept, updated, removed, quic, moved} {
+		api.Store(cfg.Id, &ConfigNode{Config: cfg})
+		server := &testServer{id: cfg.Id, port: cfg.Port}
+		running[cfg.Id] = server
+		servers.Store(cfg.Id, server)
+		manager.AddListen(cfg.Id, func(node *ConfigNode) {
+			notified.Store(node.Config.Id, node.Config)
+		})
+	}
+	running["moved"].managers = []transport.Channel{&testChannel{id: "manager"}}
+	t.Cleanup(func() {
+		for _, id := range []string{"kept", "updated", "removed", "quic", "moved"} {
+			if t, ok := servers.LoadAndDelete(id); ok {
+				t.Shutdown()
+			}
+		}
+	})
+
+	keptCopy := *kept
+	updatedCopy := *updated
+	updatedCopy.Destination = "127.0.0.1:81"
+	quicCopy := *quic
+	quicCopy.Alpn = []string{"h3"}
+	movedCopy := *moved
+	movedCopy.Port = freePort(t)
+	added := &configs.ServerTunnelConfig{Id: "added", Type: lang.Tcp, Port: 9005}
+	manager.Reload([]*configs.ServerTunnelConfig{&keptCopy, &updatedCopy, &quicCopy, &movedCopy, added})
+
+	if api.GetConfig("added") == nil {
+		t.Fatal("added tunnel isn't stored")
+	}
+	if _, ok := servers.Load("added"); ok {
+		t.Fatal("added tunnel started before a client opened it")
+	}
+	if api.GetConfig("kept").Config != kept {
+		t.Fatal("unchanged tunnel config replaced")
+	}
+	if _, ok := notified.Load("kept"); ok {
+		t.Fatal("unchanged tunnel notified")
+	}
+	if cfg, ok := notified.Load("updated"); !ok || cfg.(*configs.ServerTunnelConfig).Destination != "127.0.0.1:81" {
+		t.Fatalf("updated tunnel notified with %v", cfg)
+	}
+	if s, _ := servers.Load("updated"); s != running["updated"] || running["updated"].shutdown.Load() {
+		t.Fatal("updated tunnel restarted")
+	}
+
+	if api.GetConfig("removed") != nil {
+		t.Fatal("removed tunnel config kept")
+	}
+	if _, ok := servers.Load("removed"); ok || !running["removed"].stopAccept.Load() {
+		t.Fatal("removed tunnel still accepting")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !running["removed"].shutdown.Load() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !running["removed"].shutdown.Load() {
+		t.Fatal("removed tunnel not shut down after draining")
+	}
+
+	// The quic tunnel had no client, it's stopped and opened again by the next one.
+	if _, ok := notified.Load("quic"); ok || !running["quic"].shutdown.Load() {
+		t.Fatal("quic tunnel with a new alpn not restarted")
+	}
+	if _, ok := servers.Load("quic"); ok {
+		t.Fatal("restarted tunnel without clients kept running")
+	}
+
+	if !running["moved"].shutdown.Load() {
+		t.Fatal("moved tunnel not restarted")
+	}
+	restarted, ok := servers.Load("moved")
+	if !ok || restarted.Port() != movedCopy.Port {
+		t.Fatalf("moved tunnel not restarted on port %d", movedCopy.Port)
+	}
+	if managers := restarted.Managers(); len(managers) != 1 || managers[0].GetId() != "manager" {
+		t.Fatalf("restarted tunnel managers = %v", managers)
+	}
+}
+
+func TestListenerChanged(t *testing.T) {
+	base := configs.ServerTunnelConfig{Type: lang.Quic, Port: 9000, Terminate: true, CertFile: "a.pem"}
+	tests := []struct {
+		name    string
+		change  func(cfg *configs.ServerTunnelConfig)
+		changed bool
+	}{
+		{"same", func(cfg *configs.ServerTunnelConfig) {}, false},
+		{"destination", func(cfg *configs.ServerTunnelConfig) { cfg.Destination = "127.0.0.1:81" }, false},
+		{"http2", func(cfg *configs.ServerTunnelConfig) { cfg.Http2 = true }, false},
+		{"port", func(cfg *configs.ServerTunnelConfig) { cfg.Port = 9001 }, true},
+		{"alpn", func(cfg *configs.ServerTunnelConfig) { cfg.Alpn = []string{"h3"} }, true},
+		{"terminate", func(cfg *configs.ServerTunnelConfig) { cfg.Terminate = false }, true},
+		{"proxy protocol", func(cfg *configs.ServerTunnelConfig) { cfg.ProxyProtocol = true }, true},
+		{"secret", func(cfg *configs.ServerTunnelConfig) { cfg.Secret = "s" }, true},
+		{"quic certificate", func(cfg *configs.ServerTunnelConfig) { cfg.CertFile = "b.pem" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.change(&cfg)
+			if got := listenerChanged(&base, &cfg); got != tt.changed {
+				t.Fatalf("listenerChanged = %v, want %v", got, tt.changed)
+			}
+		})
+	}
+}
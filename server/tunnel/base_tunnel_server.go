@@ -18,7 +18,10 @@ package tunnel
 
 import (
 	"context"
-	"sort"
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,6 +34,7 @@ import (
 	"github.com/g-brook/brook/common/modules"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
 	"github.com/g-brook/brook/server/metrics"
 	"github.com/g-brook/brook/server/srv"
 )
@@ -41,22 +45,33 @@ var (
 	Unregister EventType = 1
 
 	Register EventType = 2
-
-	index atomic.Uint64
 )
 
+var errStopAccept = errors.New("tunnel stopped accepting")
+
 type Event func(ch transport.Channel)
 
 type UpdateConfigFunction func(cfg *configs.ServerTunnelConfig)
 
 type BaseTunnelServer struct {
 	srv.BaseServerHandler
-	port            int
-	Cfg             *configs.ServerTunnelConfig
-	Server          *srv.Server
-	DoStart         func() error
+	port int
+	//cfg is replaced as a whole on update, the connections read it while it changes.
+	cfg     atomic.Pointer[configs.ServerTunnelConfig]
+	Server  *srv.Server
+	DoStart func() error
+	//DoListen replaces the gnet server for tunnels that gnet can't serve, e.g. QUIC.
+	DoListen func() error
+	//ConnectionsFun counts the user connections when DoListen is used.
+	ConnectionsFun func() int
+	//PoolIdleFun counts the idle connections of the worker pool.
+	PoolIdleFun func() int
+	//StopAcceptFun closes the listener of DoListen, the accepted connections keep running.
+	StopAcceptFun   func()
+	stopAccept      atomic.Bool
 	TunnelChannel   *hash.SyncMap[string, transport.Channel]
 	ManagerChannel  *hash.SyncSet[transport.Channel]
+	Backends        *Backends
 	openCh          chan error
 	openChOnce      sync.Once
 	handlers        map[EventType]Event
@@ -65,23 +80,44 @@ type BaseTunnelServer struct {
 	trafficMetrics  *metrics.TunnelTraffic
 	runtime         time.Time
 	UpdateConfigFun UpdateConfigFunction
+	ipCheckers      []IpChecker
+	//boundPlugins are bound again to the config on update.
+	boundPlugins []Plugin
+}
+
+// Cfg the current config of the tunnel.
+func (b *BaseTunnelServer) Cfg() *configs.ServerTunnelConfig {
+	return b.cfg.Load()
 }
 
 func (b *BaseTunnelServer) Id() string {
-	return b.Cfg.Id
+	return b.Cfg().Id
 
 }
 
 func (b *BaseTunnelServer) Type() string {
-	return string(b.Cfg.Type)
+	return string(b.Cfg().Type)
 }
 
 func (b *BaseTunnelServer) Connections() int {
+	if b.ConnectionsFun != nil {
+		return b.ConnectionsFun()
+	}
+	if b.Server == nil {
+		return 0
+	}
 	return len(b.Server.Connections())
 }
 
+func (b *BaseTunnelServer) PoolIdle() int {
+	if b.PoolIdleFun != nil {
+		return b.PoolIdleFun()
+	}
+	return 0
+}
+
 func (b *BaseTunnelServer) Name() string {
-	return b.Cfg.Id
+	return b.Cfg().Id
 }
 
 func (b *BaseTunnelServer) Clients() int {
@@ -92,8 +128,21 @@ func (b *BaseTunnelServer) TrafficObj() *metrics.TunnelTraffic {
 	return b.trafficMetrics
 }
 
-func (b *BaseTunnelServer) ClientsInfo() []transport.Channel {
-	return b.TunnelChannel.Values()
+func (b *BaseTunnelServer) ClientsInfo() []metrics.ClientInfo {
+	serving := b.Backends.Serving()
+	channels := b.TunnelChannel.Values()
+	infos := make([]metrics.ClientInfo, 0, len(channels))
+	for _, ch := range channels {
+		info := metrics.ClientInfo{Channel: ch, Weight: 1, Healthy: !ch.IsClose()}
+		if backend, ok := b.Backends.BackendOf(ch); ok {
+			info.Weight = backend.Weight
+			info.Standby = backend.Standby
+			info.Healthy = backend.Healthy()
+			info.Serving = slices.Contains(serving, backend.Manager.GetId())
+		}
+		infos = append(infos, info)
+	}
+	return infos
 }
 
 func (b *BaseTunnelServer) AddEvent(etype EventType,
@@ -103,11 +152,65 @@ func (b *BaseTunnelServer) AddEvent(etype EventType,
 
 func (b *BaseTunnelServer) PutManager(ch transport.Channel) {
 	b.ManagerChannel.Add(ch)
+	b.Backends.Put(ch)
 	ch.OnClose(func(channel transport.Channel) {
 		b.ManagerChannel.Remove(channel)
+		b.Backends.Remove(channel)
+	})
+}
+
+// ManagerFailed keeps the client out of the selection for a while, e.g. when the
+// request of a work connection can't be sent to it.
+func (b *BaseTunnelServer) ManagerFailed(ch transport.Channel) {
+	b.Backends.Failed(ch)
+}
+
+// RemoveManager removes the client of the manager channel and closes the tunnel channels
+// it registered, the other clients keep serving the tunnel.
+func (b *BaseTunnelServer) RemoveManager(ch transport.Channel) {
+	b.ManagerChannel.Remove(ch)
+	b.Backends.Remove(ch)
+	b.TunnelChannel.Range(func(key string, value transport.Channel) bool {
+		if unId, ok := b.Backends.channels.Load(key); ok && unId == ch.GetId() {
+			_ = value.Close()
+		}
+		return true
 	})
 }
 
+func (b *BaseTunnelServer) Managers() []transport.Channel {
+	managers := make([]transport.Channel, 0, b.ManagerChannel.Len())
+	b.ManagerChannel.ForEach(func(ch transport.Channel) bool {
+		managers = append(managers, ch)
+		return true
+	})
+	return managers
+}
+
+// StopAccept stops taking new user connections, the open ones keep running until they
+// are closed or the tunnel is shut down.
+func (b *BaseTunnelServer) StopAccept() {
+	b.stopAccept.Store(true)
+	if b.StopAcceptFun != nil {
+		b.StopAcceptFun()
+	}
+}
+
+// acceptHandler closes the user connections the gnet server accepts after StopAccept,
+// gnet keeps the port until the engine stops.
+type acceptHandler struct {
+	srv.BaseServerHandler
+	b *BaseTunnelServer
+}
+
+func (h *acceptHandler) Open(_ transport.Channel, traverse srv.TraverseBy) error {
+	if h.b.stopAccept.Load() {
+		return errStopAccept
+	}
+	traverse()
+	return nil
+}
+
 // Shutdown  the tunnel server
 func (b *BaseTunnelServer) Shutdown() {
 	if b.Server != nil {
@@ -116,24 +219,33 @@ func (b *BaseTunnelServer) Shutdown() {
 	if b.TunnelChannel != nil {
 		b.TunnelChannel.Range(func(key string, value transport.Channel) (shouldContinue bool) {
 			_ = value.Close()
-			return false
+			return true
 		})
 		b.TunnelChannel.Clear()
 	}
 	metrics.M.RemoveServer(b)
 }
 
+func strategyOf(cfg *configs.ServerTunnelConfig) string {
+	if cfg.LoadBalance == nil {
+		return ""
+	}
+	return cfg.LoadBalance.Strategy
+}
+
 // NewBaseTunnelServer Create a new instance of the underlying tunnel server
 func NewBaseTunnelServer(cfg *configs.ServerTunnelConfig) *BaseTunnelServer {
-	return &BaseTunnelServer{
+	b := &BaseTunnelServer{
 		port:           cfg.Port,
-		Cfg:            cfg,
 		TunnelChannel:  hash.NewSyncMap[string, transport.Channel](),
 		ManagerChannel: hash.NewSyncSet[transport.Channel](),
+		Backends:       NewBackends(strategyOf(cfg)),
 		openCh:         make(chan error),
 		handlers:       make(map[EventType]Event, 16),
 		closeCtx:       context.Background(),
 	}
+	b.cfg.Store(cfg)
+	return b
 }
 
 func (b *BaseTunnelServer) Boot(_ srv.BootServer, _ srv.TraverseBy) error {
@@ -145,24 +257,34 @@ func (b *BaseTunnelServer) Boot(_ srv.BootServer, _ srv.TraverseBy) error {
 
 // Start  the tunnel server
 func (b *BaseTunnelServer) Start(network lang.Network) error {
+	if b.DoListen != nil {
+		// The tunnel accepts the visitors itself, it asks CheckAddr of the plugins.
+		b.plugins()
+		if err := b.DoListen(); err != nil {
+			log.Error("Start tunnel server port: error, %v:%v", err, b.Port())
+			return err
+		}
+		return b.afterStart()
+	}
 	threading.GoSafe(func() {
 		b.Server = srv.NewServer(b.port)
-		//get plugins.
-		modes, err2 := modules.GetModuleByType(modules.TunnelPluginsModule)
-		if err2 == nil {
-			for _, handler := range modes {
-				serverHandler, ok := handler.New().(Plugin)
-				if ok {
-					serverHandler.Bind(b.Cfg)
-					b.Server.AddHandler(serverHandler)
-					log.Info("register plugins:%s-%s", handler.ModuleType, handler.ID)
-				}
-			}
+		// The accept handler comes first, it refuses the connections once it stopped accepting.
+		b.Server.AddHandler(&acceptHandler{b: b})
+		for _, plugin := range b.plugins() {
+			b.Server.AddHandler(plugin)
 		}
 		b.Server.AddHandler(b)
-		err := b.Server.Start(srv.WithNetwork(network), srv.WithNewChannelFunc(func(ch transport.Channel) transport.Channel {
+		opts := []srv.ServerOption{srv.WithNetwork(network), srv.WithNewChannelFunc(func(ch transport.Channel) transport.Channel {
 			return metrics.NewMetricsChannel(ch, b.trafficMetrics)
-		}))
+		})}
+		if b.Cfg().ProxyProtocol {
+			if network == lang.NetworkUdp {
+				log.Warn("Tunnel %s: PROXY protocol is only read on tcp, ignored", b.Cfg().Id)
+			} else {
+				opts = append(opts, srv.WithProxyProtocol())
+			}
+		}
+		err := b.Server.Start(opts...)
 		if err != nil {
 			log.Error("Start tunnel server port: error, %v:%v", err, b.Port())
 			b.openCh <- err
@@ -171,6 +293,10 @@ func (b *BaseTunnelServer) Start(network lang.Network) error {
 	if err := <-b.openCh; err != nil {
 		return err
 	}
+	return b.afterStart()
+}
+
+func (b *BaseTunnelServer) afterStart() error {
 	if b.DoStart != nil {
 		b.runtime = time.Now()
 		b.trafficMetrics = metrics.M.PutServer(b)
@@ -190,10 +316,14 @@ func (b *BaseTunnelServer) Runtime() time.Time {
 
 // RegisterConn  register the tunnel server connection
 func (b *BaseTunnelServer) RegisterConn(ch transport.Channel,
-	_ exchange.TRegister) (string, error) {
+	request exchange.TRegister) (string, error) {
 	oldCh, ok := b.TunnelChannel.Load(ch.GetId())
 	if !ok || oldCh != ch {
 		b.TunnelChannel.Store(ch.GetId(), ch)
+		// The unId of the request is the client's word, the manager it proved is bound.
+		managerId, _ := ch.GetAttr(defin.ManagerIdKey)
+		id, _ := managerId.(string)
+		b.Backends.Bind(ch, id, request.GetWeight(), request.IsStandby())
 		handler := b.handlers[Register]
 		if handler != nil {
 			handler(ch)
@@ -207,6 +337,7 @@ func (b *BaseTunnelServer) unRegister(ch transport.Channel) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 	b.TunnelChannel.Delete(ch.GetId())
+	b.Backends.Unbind(ch)
 	handler := b.handlers[Unregister]
 	if handler != nil {
 		handler(ch)
@@ -216,11 +347,73 @@ func (b *BaseTunnelServer) UpdateConfig(config *configs.ServerTunnelConfig) {
 	if b.UpdateConfigFun != nil {
 		b.UpdateConfigFun(config)
 	}
-	//update cfg.
-	if config != nil {
-		b.Cfg.IpStrategy = config.IpStrategy
-		b.Cfg.Id = config.Id
+	//replace cfg, the listener-level fields are the same, a change of them restarts the tunnel.
+	if config == nil || b.cfg.Swap(config) == config {
+		return
+	}
+	b.Backends.SetStrategy(strategyOf(config))
+	b.lock.Lock()
+	plugins := b.boundPlugins
+	b.lock.Unlock()
+	for _, plugin := range plugins {
+		plugin.Bind(config)
+	}
+}
+
+// plugins binds the tunnel plugins to the config and keeps the ones checking the ip of
+// the visitor.
+func (b *BaseTunnelServer) plugins() []Plugin {
+	modes, err := modules.GetModuleByType(modules.TunnelPluginsModule)
+	if err != nil {
+		return nil
+	}
+	plugins := make([]Plugin, 0, len(modes))
+	for _, handler := range modes {
+		plugin, ok := handler.New().(Plugin)
+		if !ok {
+			continue
+		}
+		plugin.Bind(b.Cfg())
+		b.lock.Lock()
+		b.boundPlugins = append(b.boundPlugins, plugin)
+		b.lock.Unlock()
+		if checker, ok := plugin.(IpChecker); ok {
+			b.ipCheckers = append(b.ipCheckers, checker)
+		}
+		log.Info("register plugins:%s-%s", handler.ModuleType, handler.ID)
+		plugins = append(plugins, plugin)
+	}
+	return plugins
+}
+
+// CheckAddr checks the visitor a tunnel accepted on its own listener, the plugins of the
+// gnet server check the others on open.
+func (b *BaseTunnelServer) CheckAddr(addr net.Addr) error {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		ap, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return err
+		}
+		ip = ap.Addr().AsSlice()
 	}
+	return b.CheckIp(ip)
+}
+
+// CheckIp asks the plugins checking the ip of the visitor, for the client a http tunnel
+// recovered from the headers of its trusted proxies.
+func (b *BaseTunnelServer) CheckIp(ip net.IP) error {
+	for _, checker := range b.ipCheckers {
+		if err := checker.CheckIp(ip); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *BaseTunnelServer) OpenWorker(transport.Channel, *exchange.ClientWorkConnReq) error {
@@ -232,33 +425,15 @@ func (b *BaseTunnelServer) Done() <-chan struct{} {
 	return b.closeCtx.Done()
 }
 
+// GetManager selects the manager channel of the client for a new connection.
 func (b *BaseTunnelServer) GetManager() transport.Channel {
-	if b.ManagerChannel.Len() == 0 {
+	if b.Backends.Len() == 0 {
 		log.Error("1:Tunnel Manager channel is empty. No available manager channel.")
 		return nil
 	}
-	activeChannels := make([]transport.Channel, 0)
-	b.ManagerChannel.ForEach(func(ch transport.Channel) bool {
-		if !ch.IsClose() {
-			activeChannels = append(activeChannels, ch)
-		} else {
-			b.ManagerChannel.Remove(ch)
-		}
-		return true
-	})
-
-	aLen := len(activeChannels)
-	if aLen == 0 {
+	manager := b.Backends.Select()
+	if manager == nil {
 		log.Error("2:Tunnel Manager channel is empty. No available manager channel.")
-		return nil
-	}
-	if aLen == 1 {
-		return activeChannels[0]
 	}
-	sort.Slice(activeChannels, func(i, j int) bool {
-		return activeChannels[i].ActiveTime().Before(activeChannels[j].ActiveTime())
-	})
-
-	v := index.Add(1) % uint64(len(activeChannels))
-	return activeChannels[v]
+	return manager
 }
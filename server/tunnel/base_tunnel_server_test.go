@@ -0,0 +1,70 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/modules"
+	"github.com/g-brook/brook/server/srv"
+)
+
+// testPlugin records the configs it's bound to.
+type testPlugin struct {
+	srv.BaseServerHandler
+	bound []*configs.ServerTunnelConfig
+}
+
+func (p *testPlugin) Module() modules.ModuleInfo {
+	return modules.ModuleInfo{}
+}
+
+func (p *testPlugin) Bind(cfg *configs.ServerTunnelConfig) {
+	p.bound = append(p.bound, cfg)
+}
+
+func TestUpdateConfig(t *testing.T) {
+	b := NewBaseTunnelServer(&configs.ServerTunnelConfig{Id: "t", Type: lang.Http, Port: 9000})
+	plugin := &testPlugin{}
+	b.boundPlugins = []Plugin{plugin}
+	cfg := &configs.ServerTunnelConfig{
+		Id:            "t",
+		Type:          lang.Http,
+		Port:          9000,
+		Destination:   "127.0.0.1:81",
+		Http2:         true,
+		Alpn:          []string{"h3"},
+		ProxyProtocol: true,
+		LoadBalance:   &configs.LoadBalanceConfig{Strategy: "roundRobin"},
+	}
+	b.UpdateConfig(cfg)
+	if b.Cfg() != cfg {
+		t.Fatalf("Cfg = %+v, want the new config", b.Cfg())
+	}
+	if b.Backends.strategy != "roundRobin" {
+		t.Fatalf("strategy = %s, want roundRobin", b.Backends.strategy)
+	}
+	if len(plugin.bound) != 1 || plugin.bound[0] != cfg {
+		t.Fatalf("plugin bound to %v, want the new config", plugin.bound)
+	}
+	b.UpdateConfig(cfg)
+	if len(plugin.bound) != 1 {
+		t.Fatal("plugin bound again to the same config")
+	}
+}
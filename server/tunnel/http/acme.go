@@ -0,0 +1,182 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	acmeChallengePath = "/.well-known/acme-challenge/"
+
+	defaultAcmeCacheDir = "./acme"
+
+	defaultRenewBefore = 30
+)
+
+// AcmeCache keeps the issued certificates and the account key, the cache dir is used when nil.
+var AcmeCache autocert.Cache
+
+var acmeManager *autocert.Manager
+
+// acmeDomains is the domains of every https tunnel port that uses ACME.
+var acmeDomains = hash.NewSyncMap[int, []string]()
+
+// InitAcme creates the ACME manager, which issues and renews the certificates of the https
+// tunnels that have none. HTTP-01 is answered by the http tunnels and TLS-ALPN-01 by the
+// https tunnels themselves.
+func InitAcme(cfg *configs.AcmeConfig) error {
+	if cfg == nil || !cfg.Enable {
+		acmeManager = nil
+		return nil
+	}
+	client := &acme.Client{DirectoryURL: cfg.DirectoryUrl}
+	if cfg.CaFile != "" {
+		pem, err := os.ReadFile(cfg.CaFile)
+		if err != nil {
+			return fmt.Errorf("read acme caFile error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in acme caFile")
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+	cache := AcmeCache
+	if cache == nil {
+		dir := cfg.CacheDir
+		if dir == "" {
+			dir = defaultAcmeCacheDir
+		}
+		cache = autocert.DirCache(dir)
+	}
+	renewBefore := cfg.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = defaultRenewBefore
+	}
+	acmeManager = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       cache,
+		HostPolicy:  acmeHostPolicy,
+		RenewBefore: time.Duration(renewBefore) * 24 * time.Hour,
+		Client:      client,
+		Email:       cfg.Email,
+	}
+	log.Info("acme is enabled, directory: %s", client.DirectoryURL)
+	return nil
+}
+
+// useAcme reports whether the https tunnel gets its certificate from ACME.
+func useAcme(cfg *configs.ServerTunnelConfig) bool {
+	return acmeManager != nil && cfg.CertFile == "" && cfg.CertContent == ""
+}
+
+// acmeHosts returns the domains of the tunnel a certificate can be issued for, the routes
+// with a certificate of their own and the wildcards, which need DNS-01, are skipped.
+func acmeHosts(cfg *configs.ServerTunnelConfig) []string {
+	var hosts []string
+	for _, h := range cfg.Http {
+		if h.CertFile != "" || h.CertContent != "" {
+			continue
+		}
+		domain := strings.ToLower(strings.TrimSpace(h.Domain))
+		if domain == "" || strings.Contains(domain, "*") || slices.Contains(hosts, domain) {
+			continue
+		}
+		hosts = append(hosts, domain)
+	}
+	return hosts
+}
+
+// prefetchAcme issues the certificates of the tunnel once it is listening, instead of
+// on the first handshake.
+func prefetchAcme(port int) {
+	hosts, ok := acmeDomains.Load(port)
+	if !ok || acmeManager == nil {
+		return
+	}
+	threading.GoSafe(func() {
+		for _, host := range hosts {
+			if _, err := acmeManager.GetCertificate(&tls.ClientHelloInfo{ServerName: host}); err != nil {
+				log.Warn("acme certificate of %s is not issued yet: %v", host, err)
+				continue
+			}
+			log.Info("acme certificate of %s is ready", host)
+		}
+	})
+}
+
+func acmeHostPolicy(_ context.Context, host string) error {
+	if !isAcmeHost(host) {
+		return fmt.Errorf("acme: host %q is not a domain of the https tunnels", host)
+	}
+	return nil
+}
+
+// isAcmeHost reports whether the host, with or without a port, is an ACME domain of
+// the https tunnels.
+func isAcmeHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	allowed := false
+	acmeDomains.Range(func(_ int, hosts []string) bool {
+		allowed = slices.Contains(hosts, host)
+		return !allowed
+	})
+	return allowed
+}
+
+// serveAcmeChallenge answers the HTTP-01 challenge requests for the ACME domains, it
+// returns false for any other request, the challenges of the other hosts go to their
+// routes.
+func serveAcmeChallenge(w http.ResponseWriter, req *http.Request) bool {
+	if acmeManager == nil || !strings.HasPrefix(req.URL.Path, acmeChallengePath) || !isAcmeHost(req.Host) {
+		return false
+	}
+	acmeManager.HTTPHandler(nil).ServeHTTP(w, req)
+	return true
+}
+
+// isAcmeChallenge reports whether the tls connection is a TLS-ALPN-01 challenge, which
+// ends after the handshake.
+func isAcmeChallenge(conn *tls.Conn) bool {
+	return conn.ConnectionState().NegotiatedProtocol == acme.ALPNProto
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func initTestAcme(t *testing.T) autocert.Cache {
+	cache := autocert.DirCache(t.TempDir())
+	AcmeCache = cache
+	err := InitAcme(&configs.AcmeConfig{Enable: true, DirectoryUrl: "https://127.0.0.1:14000/dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acmeDomains.Store(30443, []string{"a.test"})
+	t.Cleanup(func() {
+		AcmeCache = nil
+		acmeManager = nil
+		acmeDomains.Delete(30443)
+	})
+	return cache
+}
+
+func TestServeAcmeChallenge(t *testing.T) {
+	cache := initTestAcme(t)
+	if err := cache.Put(context.Background(), "tok1+http-01", []byte("tok1.key")); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"a.test", "A.test:8080"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+acmeChallengePath+"tok1", nil)
+		w := httptest.NewRecorder()
+		if !serveAcmeChallenge(w, req) {
+			t.Fatalf("challenge of %s is not served", host)
+		}
+		body, _ := io.ReadAll(w.Result().Body)
+		if w.Code != http.StatusOK || string(body) != "tok1.key" {
+			t.Fatalf("challenge of %s: %d %q", host, w.Code, body)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://a.test"+acmeChallengePath+"unknown", nil)
+	w := httptest.NewRecorder()
+	if !serveAcmeChallenge(w, req) || w.Code != http.StatusNotFound {
+		t.Fatalf("unknown token: %d", w.Code)
+	}
+}
+
+func TestServeAcmeChallengeOnlyForAcmeHosts(t *testing.T) {
+	cache := initTestAcme(t)
+	if err := cache.Put(context.Background(), "tok1+http-01", []byte("tok1.key")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://a.test" + acmeChallengePath + "tok1", true},
+		{"http://b.test" + acmeChallengePath + "tok1", false},
+		{"http://sub.a.test" + acmeChallengePath + "tok1", false},
+		{"http://a.test/index.html", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if got := serveAcmeChallenge(httptest.NewRecorder(), req); got != tt.want {
+			t.Errorf("serveAcmeChallenge(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+	acmeManager = nil
+	req := httptest.NewRequest(http.MethodGet, tests[0].url, nil)
+	if serveAcmeChallenge(httptest.NewRecorder(), req) {
+		t.Error("challenge served without acme")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/g-brook/brook/common/httpx"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+)
+
+// h2cUpgradeResponse switches a HTTP/1.1 connection to h2c.
+var h2cUpgradeResponse = []byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+
+// bufferedConn reads what the HTTP/1.1 reader has buffered first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// isH2cPreface reports whether the connection starts with the HTTP/2 client preface,
+// a h2c client with prior knowledge.
+func isH2cPreface(reader *bufio.Reader) bool {
+	if b, err := reader.Peek(3); err != nil || string(b) != "PRI" {
+		return false
+	}
+	b, err := reader.Peek(len(http2.ClientPreface))
+	return err == nil && string(b) == http2.ClientPreface
+}
+
+// h2cUpgrade returns the settings of a request that upgrades to h2c, false when it
+// doesn't or has a body: that one is served on HTTP/1.1.
+func h2cUpgrade(req *http.Request) ([]byte, bool) {
+	if !httpguts.HeaderValuesContainsToken(req.Header["Upgrade"], "h2c") ||
+		!httpguts.HeaderValuesContainsToken(req.Header["Connection"], "HTTP2-Settings") {
+		return nil, false
+	}
+	if req.ContentLength != 0 || len(req.TransferEncoding) > 0 {
+		return nil, false
+	}
+	values := req.Header.Values("HTTP2-Settings")
+	if len(values) != 1 {
+		return nil, false
+	}
+	settings, err := base64.RawURLEncoding.DecodeString(values[0])
+	if err != nil {
+		return nil, false
+	}
+	return settings, true
+}
+
+// serveHttp2 serves the HTTP/2 streams of a visitor connection until it's closed.
+func (htl *TunnelHttpServer) serveHttp2(conn net.Conn, opts *http2.ServeConnOpts) {
+	opts.Handler = http.HandlerFunc(htl.serveStream)
+	htl.h2.ServeConn(conn, opts)
+}
+
+// serveStream serves a HTTP/2 request like a HTTP/1.1 one.
+func (htl *TunnelHttpServer) serveStream(writer http.ResponseWriter, req *http.Request) {
+	if err := htl.forwarded(req); err != nil {
+		writer.WriteHeader(http.StatusForbidden)
+		_, _ = writer.Write(httpx.GetPageNotFound(http.StatusForbidden))
+		return
+	}
+	htl.httpProxy.ServeHTTP(writer, req)
+}
+
+// isGrpc reports whether the request is a gRPC call, its local server only speaks HTTP/2.
+func isGrpc(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// newH2cTransport creates the transport of a route to a local server that speaks HTTP/2
+// without TLS, it opens a connection to a client per request.
+func newH2cTransport(info *RouteInfo) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP:       true,
+		IdleConnTimeout: info.idle,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return info.dial(ctx)
+		},
+	}
+}
+
+// roundTripOwnConn sends a HTTP/2 request on its own connection, so the load balance selects
+// its client: a multiplexed one would carry all requests to the client of the first.
+func (r *RouteInfo) roundTripOwnConn(req *http.Request) (*http.Response, error) {
+	conn, err := r.dial(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	cc, err := r.h2.NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		_ = cc.Close()
+		return nil, err
+	}
+	resp.Body = &ownConnBody{ReadCloser: resp.Body, cc: cc}
+	return resp, nil
+}
+
+// ownConnBody closes the connection of its request with the body.
+type ownConnBody struct {
+	io.ReadCloser
+	cc *http2.ClientConn
+}
+
+func (b *ownConnBody) Close() error {
+	err := b.ReadCloser.Close()
+	_ = b.cc.Close()
+	return err
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/loadbalance"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// testHttp2Server is a tunnel that serves the HTTP/2 visitors by the proxy.
+func testHttp2Server(proxy *Proxy) *TunnelHttpServer {
+	return &TunnelHttpServer{h2: &http2.Server{}, httpProxy: proxy}
+}
+
+// h2Client serves a visitor connection of conn on HTTP/2, it returns the client of the
+// visitor on the other end.
+func h2Client(t *testing.T, htl *TunnelHttpServer, conn, visitor net.Conn) *http2.ClientConn {
+	go htl.serveHttp2(conn, &http2.ServeConnOpts{})
+	cc, err := (&http2.Transport{}).NewClientConn(visitor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cc.Close() })
+	return cc
+}
+
+func TestH2cUpgrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		settings   []string
+		body       string
+		want       bool
+	}{
+		{name: "upgrade", connection: "Upgrade, HTTP2-Settings", settings: []string{"AAMAAABkAAQAoAAAAAIAAAAA"}, want: true},
+		{name: "no settings token", connection: "Upgrade", settings: []string{"AAMAAABkAAQAoAAAAAIAAAAA"}},
+		{name: "no settings", connection: "Upgrade, HTTP2-Settings"},
+		{name: "two settings", connection: "Upgrade, HTTP2-Settings", settings: []string{"AAMAAABk", "AAMAAABk"}},
+		{name: "bad settings", connection: "Upgrade, HTTP2-Settings", settings: []string{"!!"}},
+		{name: "with a body", connection: "Upgrade, HTTP2-Settings", settings: []string{"AAMAAABkAAQAoAAAAAIAAAAA"}, body: "a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "http://a.test/", body)
+			req.Header.Set("Upgrade", "h2c")
+			req.Header.Set("Connection", tt.connection)
+			for _, s := range tt.settings {
+				req.Header.Add("HTTP2-Settings", s)
+			}
+			if _, ok := h2cUpgrade(req); ok != tt.want {
+				t.Fatalf("upgrade %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsH2cPreface(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{data: http2.ClientPreface + "frames", want: true},
+		{data: "PRI * HTTP/2.0\r\n"},
+		{data: "GET / HTTP/1.1\r\nHost: a.test\r\n\r\n"},
+	}
+	for _, tt := range tests {
+		if got := isH2cPreface(bufio.NewReader(strings.NewReader(tt.data))); got != tt.want {
+			t.Errorf("preface of %q: %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestTlsConfigAlpn(t *testing.T) {
+	cfg := &configs.ServerTunnelConfig{Http: []configs.HttpRunnelProxy{testRoute(t, "a.test")}}
+	certs, err := newSniCertificates(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h2 := range []bool{true, false} {
+		conn, visitor := net.Pipe()
+		server := tls.Server(conn, certs.tlsConfig(h2))
+		go func() {
+			_ = server.Handshake()
+		}()
+		client := tls.Client(visitor, &tls.Config{ServerName: "a.test", InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS, "http/1.1"}})
+		if err = client.Handshake(); err != nil {
+			t.Fatal(err)
+		}
+		want := "http/1.1"
+		if h2 {
+			want = http2.NextProtoTLS
+		}
+		if got := client.ConnectionState().NegotiatedProtocol; got != want {
+			t.Errorf("http2 %v negotiated %q, want %q", h2, got, want)
+		}
+		_ = visitor.Close()
+		_ = conn.Close()
+	}
+}
+
+func TestServeHttp2(t *testing.T) {
+	proxy, _ := testProxy(t, configs.HttpRunnelProxy{Id: "a"}, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	htl := testHttp2Server(proxy)
+	cfg := &configs.ServerTunnelConfig{Http: []configs.HttpRunnelProxy{testRoute(t, "a.test")}}
+	certs, err := newSniCertificates(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		target string
+		conns  func(t *testing.T) (net.Conn, net.Conn)
+	}{
+		{name: "h2c", target: "http://a.test/", conns: func(t *testing.T) (net.Conn, net.Conn) {
+			return net.Pipe()
+		}},
+		{name: "h2", target: "https://a.test/", conns: func(t *testing.T) (net.Conn, net.Conn) {
+			conn, visitor := net.Pipe()
+			server := tls.Server(conn, certs.tlsConfig(true))
+			client := tls.Client(visitor, &tls.Config{ServerName: "a.test", InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS}})
+			go func() {
+				_ = server.Handshake()
+			}()
+			if err := client.Handshake(); err != nil {
+				t.Fatal(err)
+			}
+			return server, client
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, visitor := tt.conns(t)
+			cc := h2Client(t, htl, conn, visitor)
+			resp, err := cc.RoundTrip(httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil || resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 || string(body) != "ok" {
+				t.Fatalf("%s %d %q, %v", resp.Proto, resp.StatusCode, body, err)
+			}
+		})
+	}
+}
+
+func TestProxyGrpcPassthrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		h2c         bool
+		contentType string
+		proto       int
+	}{
+		{name: "grpc", contentType: "application/grpc+proto", proto: 2},
+		{name: "h2c route", h2c: true, proto: 2},
+		{name: "http/1.1 route", proto: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, _ := testProxy(t, configs.HttpRunnelProxy{Id: "a", H2c: tt.h2c}, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+				_, _ = w.Write([]byte(strconv.Itoa(r.ProtoMajor)))
+				w.Header().Set("Grpc-Status", "0")
+			})
+			conn, visitor := net.Pipe()
+			cc := h2Client(t, testHttp2Server(proxy), conn, visitor)
+			req := httptest.NewRequest(http.MethodPost, "http://a.test/echo.Echo/Say", strings.NewReader("\x00\x00\x00\x00\x00"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := cc.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil || string(body) != strconv.Itoa(tt.proto) {
+				t.Fatalf("local server got HTTP/%s, want %d: %v", body, tt.proto, err)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+				t.Fatalf("trailer grpc-status %q", got)
+			}
+		})
+	}
+}
+
+func TestProxyGrpcBalance(t *testing.T) {
+	testWebLog(t)
+	// Every client has its own local server, which counts its calls.
+	clients := map[string]string{}
+	calls := map[string]*atomic.Int32{}
+	for _, id := range []string{"a", "b"} {
+		count := &atomic.Int32{}
+		local := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		}), &http2.Server{}))
+		t.Cleanup(local.Close)
+		clients[id], calls[id] = local.Listener.Addr().String(), count
+	}
+	balance := loadbalance.NewRoundRobin()
+	info, err := NewRouteInfo(0, configs.HttpRunnelProxy{Id: "a"}, func(string, string, bool) (net.Conn, error) {
+		return net.Dial("tcp", clients[balance.Select([]string{"a", "b"})])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewHttpProxy(func(*http.Request) (*RouteInfo, error) {
+		return info, nil
+	}, "test")
+	conn, visitor := net.Pipe()
+	cc := h2Client(t, testHttp2Server(proxy), conn, visitor)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPost, "http://a.test/echo.Echo/Say", strings.NewReader("\x00\x00\x00\x00\x00"))
+		req.Header.Set("Content-Type", "application/grpc")
+		resp, err := cc.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+	}
+	for id, count := range calls {
+		if got := count.Load(); got != 2 {
+			t.Fatalf("client %s got %d of the 4 calls, want 2", id, got)
+		}
+	}
+}
@@ -39,6 +39,14 @@ var (
 
 	PTimeout = errors.New("read client timeout, connect close")
 
+	errBodyCut = errors.New("the response body was cut off, connect close")
+
+	errCloseDelimited = errors.New("the response body ends with the connection, connect close")
+
+	errHijacked = errors.New("the connection was upgraded, connect close")
+
+	errWebsocketClient = errors.New("the clients of the route are too old for WebSocket, upgrade them")
+
 	httpMethods = [][]byte{
 		[]byte(http.MethodGet),
 		[]byte(http.MethodPost),
@@ -48,23 +56,31 @@ var (
 		[]byte(http.MethodOptions),
 		[]byte(http.MethodPatch),
 		[]byte(http.MethodPut),
-		[]byte(http.MethodTrace)}
+		[]byte(http.MethodTrace),
+		// PRI starts the preface of a h2c client with prior knowledge.
+		[]byte("PRI")}
 )
 
 const (
 	timeout = 30 * time.Second
+	// maxBufferedBody is the most of a response body held before it goes to the visitor,
+	// a longer one streams through as a flushed one.
+	maxBufferedBody = 64 * 1024
 )
 
 type Conn struct {
-	ch          Channel
-	buffer      *ringbuffer.RingBuffer
-	https       bool
-	handshake   bool
-	closed      chan struct{}
-	dataCh      chan struct{}
-	isWebSocket bool
-	timeStop    *time.Timer
-	closeOnce   sync.Once
+	ch        Channel
+	buffer    *ringbuffer.RingBuffer
+	https     bool
+	handshake bool
+	closed    chan struct{}
+	dataCh    chan struct{}
+	// upgraded the connection was hijacked after a 101, it idles as long as the app wants.
+	upgraded bool
+	// http2 the HTTP/2 server reads the connection, its idle timeout is its own.
+	http2     bool
+	timeStop  *time.Timer
+	closeOnce sync.Once
 }
 
 /**
@@ -138,11 +154,17 @@ func (h *Conn) OnData(b []byte) {
 
 // Read implements the io.Reader interface for HttpConn.
 // It reads data from the connection buffer with proper synchronization and protocol validation.
+// The timeout counts from the call, a long response before doesn't use it up.
 func (h *Conn) Read(b []byte) (n int, err error) {
+	if h.http2 || h.upgraded {
+		h.timeStop.Stop()
+	} else {
+		h.timeStop.Reset(timeout)
+	}
 	for {
 		if !h.buffer.IsEmpty() {
 			read, _ := h.buffer.Read(b)
-			if h.isWebSocket {
+			if h.upgraded {
 				return read, nil
 			}
 			if h.https && !h.handshake {
@@ -150,22 +172,19 @@ func (h *Conn) Read(b []byte) (n int, err error) {
 					return 0, PHttpsErr
 				}
 				h.handshake = true
-			} else if !h.https && !isHttpRequest(b) {
-				// Validate for HTTP protocol if not HTTPS
-				return 0, PHttpErr
-			}
-			if !h.timeStop.Stop() {
-				<-h.timeStop.C
+			} else if !h.https && !h.handshake {
+				// Validate for HTTP protocol if not HTTPS, the first read only: the
+				// body and the next requests don't start with a method
+				if !isHttpRequest(b[:read]) {
+					return 0, PHttpErr
+				}
+				h.handshake = true
 			}
-			h.timeStop.Reset(timeout)
 			return read, nil
 		}
 		select {
 		case <-h.dataCh:
 		case <-h.timeStop.C:
-			if h.isWebSocket {
-				return 0, nil
-			}
 			return 0, PTimeout
 		case <-h.closed:
 			return 0, io.EOF
@@ -222,11 +241,30 @@ type responseWriter struct {
 	req      *http.Request
 	body     *bytes.Buffer
 	timeStop time.Time
+	// streaming the header is flushed, the body goes to the visitor as it's written.
+	streaming bool
+	chunked   bool
+	// closeDelimited the body of a HTTP/1.0 visitor ends with the connection.
+	closeDelimited bool
+	aborted        bool
+	// reader holds what the visitor sent after the request, the upgraded connection reads it first.
+	reader   *bufio.Reader
+	hijacked bool
 }
 
+// Hijack hands the connection over after an upgrade, such as a WebSocket: the bytes go both
+// ways as they are until either side closes it.
 func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	r.httpConn.isWebSocket = true
-	return r.conn, bufio.NewReadWriter(bufio.NewReader(r.conn), bufio.NewWriter(r.conn)), nil
+	if r.wrote {
+		return nil, nil, http.ErrHijacked
+	}
+	r.hijacked = true
+	r.httpConn.upgraded = true
+	reader := r.reader
+	if reader == nil {
+		reader = bufio.NewReader(r.conn)
+	}
+	return r.conn, bufio.NewReadWriter(reader, bufio.NewWriter(r.conn)), nil
 }
 
 func newResponseWriter(conn net.Conn,
@@ -237,13 +275,92 @@ func newResponseWriter(conn net.Conn,
 	}
 }
 
+// Write holds the body to send it in one go with a Content-Length, up to maxBufferedBody:
+// a longer body is flushed, the rest of it streams through.
 func (r *responseWriter) Write(bt []byte) (int, error) {
 	if !r.wrote {
 		r.WriteHeader(http.StatusOK)
 	}
+	if r.streaming {
+		return r.writeBody(bt)
+	}
+	if r.body.Len()+len(bt) > maxBufferedBody {
+		if err := r.FlushError(); err != nil {
+			return 0, err
+		}
+		return r.writeBody(bt)
+	}
 	return r.body.Write(bt)
 }
 
+// Flush implements http.Flusher, see FlushError.
+func (r *responseWriter) Flush() {
+	_ = r.FlushError()
+}
+
+// FlushError writes the header and the body so far to the visitor, the rest of the body
+// follows as it's written: chunked without a Content-Length, so a Server-Sent Events or
+// chunked response of the client streams through.
+func (r *responseWriter) FlushError() error {
+	if !r.wrote {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.streaming {
+		r.streaming = true
+		if r.header.Get("Content-Length") == "" && r.bodyAllowed() {
+			if r.req.ProtoAtLeast(1, 1) {
+				r.chunked = true
+				r.header.Set("Transfer-Encoding", "chunked")
+			} else {
+				r.closeDelimited = true
+				r.header.Set("Connection", "close")
+			}
+		}
+		head := bytes.NewBuffer(make([]byte, 0))
+		r.writeHead(head)
+		if _, err := r.conn.Write(head.Bytes()); err != nil {
+			return err
+		}
+	}
+	if r.body.Len() > 0 {
+		_, err := r.writeBody(r.body.Bytes())
+		r.body.Reset()
+		return err
+	}
+	return nil
+}
+
+// writeBody writes a part of a flushed body, a chunk of a chunked one.
+func (r *responseWriter) writeBody(bt []byte) (int, error) {
+	if len(bt) == 0 {
+		return 0, nil
+	}
+	if !r.chunked {
+		return r.conn.Write(bt)
+	}
+	chunk := bytes.NewBuffer(make([]byte, 0, len(bt)+16))
+	_, _ = fmt.Fprintf(chunk, "%x\r\n", len(bt))
+	chunk.Write(bt)
+	chunk.WriteString("\r\n")
+	if _, err := r.conn.Write(chunk.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(bt), nil
+}
+
+// bodyAllowed tells whether the response has a body.
+func (r *responseWriter) bodyAllowed() bool {
+	if r.req.Method == http.MethodHead {
+		return false
+	}
+	return r.status >= 200 && r.status != http.StatusNoContent && r.status != http.StatusNotModified
+}
+
+// abort marks the body cut off, finish closes the connection rather than end it.
+func (r *responseWriter) abort() {
+	r.aborted = true
+}
+
 func (r *responseWriter) WriteHeader(statusCode int) {
 	if r.wrote {
 		return
@@ -255,6 +372,15 @@ func (r *responseWriter) WriteHeader(statusCode int) {
 // finish completes the response writing process
 // It ensures proper header setup and writes the complete response to the connection
 func (r *responseWriter) finish(err error, req *http.Request) error {
+	if r.aborted {
+		return errBodyCut
+	}
+	if r.hijacked {
+		return errHijacked
+	}
+	if r.streaming {
+		return r.finishStream()
+	}
 	// Check if headers have been written, if not write default status 200
 	if !r.wrote {
 		if err != nil {
@@ -276,6 +402,36 @@ func (r *responseWriter) finish(err error, req *http.Request) error {
 	}
 	// Create a new buffer to build the response
 	resp := bytes.NewBuffer(make([]byte, 0))
+	r.writeHead(resp)
+	// Write the body content and reset the body buffer
+	resp.Write(r.body.Bytes())
+	r.body.Reset()
+	if err != nil && r.httpConn != nil {
+		_, _ = r.httpConn.Write(resp.Bytes())
+		return err
+	}
+	// Write the complete response to the connection
+	_, err = r.conn.Write(resp.Bytes())
+	return err
+}
+
+// finishStream ends the body of a flushed response.
+func (r *responseWriter) finishStream() error {
+	if err := r.FlushError(); err != nil {
+		return err
+	}
+	if r.closeDelimited {
+		return errCloseDelimited
+	}
+	if r.chunked {
+		_, err := r.conn.Write([]byte("0\r\n\r\n"))
+		return err
+	}
+	return nil
+}
+
+// writeHead writes the status line and the headers.
+func (r *responseWriter) writeHead(resp *bytes.Buffer) {
 	// Check if using HTTP/1.1 or later
 	is11 := r.req.ProtoAtLeast(1, 1)
 	// Write the status line to the response buffer
@@ -288,16 +444,6 @@ func (r *responseWriter) finish(err error, req *http.Request) error {
 	}
 	// Write the final empty line to signify end of headers
 	_, _ = fmt.Fprintf(resp, "\r\n")
-	// Write the body content and reset the body buffer
-	resp.Write(r.body.Bytes())
-	r.body.Reset()
-	if err != nil && r.httpConn != nil {
-		_, _ = r.httpConn.Write(resp.Bytes())
-		return err
-	}
-	// Write the complete response to the connection
-	_, err = r.conn.Write(resp.Bytes())
-	return err
 }
 
 func (r *responseWriter) Header() http.Header {
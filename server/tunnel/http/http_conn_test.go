@@ -0,0 +1,106 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+// serveVisitor serves the request of a visitor by the proxy on a responseWriter, the
+// response is read from the returned connection; done gets the error of finish.
+func serveVisitor(t *testing.T, proxy *Proxy, req *http.Request) (net.Conn, *responseWriter, <-chan error) {
+	server, client := net.Pipe()
+	rw := newResponseWriter(server, nil, req)
+	done := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		proxy.ServeHTTP(rw, req)
+		if rw.body.Len() > maxBufferedBody {
+			t.Errorf("held %d bytes of the body", rw.body.Len())
+		}
+		done <- rw.finish(nil, req)
+	}()
+	return client, rw, done
+}
+
+func TestProxyFlushesServerSentEvents(t *testing.T) {
+	next := make(chan struct{})
+	proxy, _ := testProxy(t, configs.HttpRunnelProxy{Id: "a"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-next
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://a.test/events", nil)
+	conn, _, done := serveVisitor(t, proxy, req)
+	defer conn.Close()
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("transfer encoding %v, want chunked", resp.TransferEncoding)
+	}
+	body := bufio.NewReader(resp.Body)
+	// The first event comes before the local server writes the second one.
+	if line, err := body.ReadString('\n'); err != nil || line != "data: 1\n" {
+		t.Fatalf("first event %q, %v", line, err)
+	}
+	close(next)
+	rest, err := io.ReadAll(body)
+	if err != nil || string(rest) != "\ndata: 2\n\n" {
+		t.Fatalf("rest %q, %v", rest, err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+}
+
+func TestProxyStreamsLargeBody(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4*maxBufferedBody/16)
+	proxy, _ := testProxy(t, configs.HttpRunnelProxy{Id: "a"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://a.test/large", nil)
+	conn, rw, done := serveVisitor(t, proxy, req)
+	defer conn.Close()
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || resp.ContentLength != int64(len(data)) || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes of %d, content length %d, %v", len(got), len(data), resp.ContentLength, err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if !rw.streaming {
+		t.Fatal("the large body was not streamed")
+	}
+}
@@ -19,16 +19,18 @@ package http
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/g-brook/brook/common/httpx"
 	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/scmd/web/logger"
+	"github.com/g-brook/brook/server/metrics"
 )
 
 type Proxy struct {
@@ -45,14 +47,31 @@ func (h *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	} else {
 		newCtx = context.WithValue(newCtx, RequestInfoKey, newReqId())
 		newCtx = context.WithValue(newCtx, RouteInfoKey, info)
+		newCtx = context.WithValue(newCtx, BalanceKey, info.hashKey(request))
+		newCtx = context.WithValue(newCtx, WebsocketKey, httpx.IsWebSocketRequest(request))
+		if info.total > 0 {
+			var cancel context.CancelFunc
+			newCtx, cancel = context.WithTimeout(newCtx, info.total)
+			defer cancel()
+		}
 	}
+	body := &bodyState{}
+	newCtx = context.WithValue(newCtx, BodyStateKey, body)
 	h.initHeader(writer, request, info)
 	newReq := request.Clone(newCtx)
 	h.http.ServeHTTP(writer, newReq)
+	if body.cut.Load() {
+		if rw, ok := writer.(*responseWriter); ok {
+			rw.abort()
+		} else {
+			// The HTTP/2 server resets the stream.
+			panic(http.ErrAbortHandler)
+		}
+	}
 }
 
 func (h *Proxy) initHeader(writer http.ResponseWriter, request *http.Request, r *RouteInfo) {
-	if writer.Header() != nil {
+	if writer.Header() != nil && request.ProtoMajor == 1 {
 		header := writer.Header()
 		header.Set("Connection", request.Header.Get("Connection"))
 	}
@@ -78,11 +97,13 @@ func httpProxy(proxyId string) *httputil.ReverseProxy {
 			out.Header[ForwardedKey] = in.Header[ForwardedKey]
 			out.Header[RequestInfoKey] = in.Header[RequestInfoKey]
 			out.Header[RequestHttpIdKey] = in.Header[RequestHttpIdKey]
+			routeOf(in).rewriteRequest(out)
 			out.URL.Scheme = "http"
 			out.URL.Host = out.Host
 		},
 		ModifyResponse: func(response *http.Response) error {
 			req := response.Request
+			metrics.M.AddHttpStatus(proxyId, response.StatusCode)
 			logger.WithWebLog(&logger.WebLogger{
 				Protocol: req.Proto,
 				Path:     req.URL.Path,
@@ -91,50 +112,33 @@ func httpProxy(proxyId string) *httputil.ReverseProxy {
 				ProxyId:  proxyId,
 				Status:   response.StatusCode,
 				HttpId:   req.Header.Get(RequestHttpIdKey),
+				ClientIp: req.Header.Get(httpx.XRealIp),
 				Time:     time.Now(),
 			})
 			response.Header.Del(RequestInfoKey)
+			info := routeOf(req)
+			info.rewriteResponse(response.Header)
+			if info != nil && response.StatusCode != http.StatusSwitchingProtocols {
+				body, _ := req.Context().Value(BodyStateKey).(*bodyState)
+				response.Body = newIdleBody(req.Context(), response.Body, info.idle, body)
+			}
 			return nil
 		},
-
-		Transport: &http.Transport{
-			ResponseHeaderTimeout: 5 * time.Second,
-			DisableKeepAlives:     true,
-			MaxIdleConnsPerHost:   0,
-			IdleConnTimeout:       5 * time.Second,
-			MaxIdleConns:          100,
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				value := ctx.Value(RouteInfoKey)
-				switch v := value.(type) {
-				case error:
-					return nil, v
-				case *RouteInfo:
-					connection, err := v.getProxyConnection(v.httpId)
-					if err != nil {
-						log.Error("get proxy connection error %v", err)
-						return nil, err
-					}
-					return connection, err
-				}
-				return nil, nil
-			},
-			Proxy: func(req *http.Request) (*url.URL, error) {
-				return req.URL, nil
-			},
-		},
+		Transport: routeTransport{},
 		ErrorHandler: func(writer http.ResponseWriter, req *http.Request, err error) {
-			if errors.Is(err, readDone) {
-				return
-			}
 			state := http.StatusOK
-			if err, ok := err.(interface{ Timeout() bool }); ok && err.Timeout() {
+			if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
 				state = http.StatusGatewayTimeout
+			} else if errors.Is(err, errWebsocketClient) {
+				state = http.StatusBadGateway
 			} else {
 				state = http.StatusNotFound
 			}
 			log.Error("Not found path %v", err)
+			routeOf(req).rewriteResponse(writer.Header())
 			writer.WriteHeader(state)
 			_, _ = writer.Write(httpx.GetPageNotFound(state))
+			metrics.M.AddHttpStatus(proxyId, state)
 			logger.WithWebLog(&logger.WebLogger{
 				Protocol: req.Proto,
 				Path:     req.URL.Path,
@@ -143,9 +147,108 @@ func httpProxy(proxyId string) *httputil.ReverseProxy {
 				ProxyId:  proxyId,
 				Status:   state,
 				HttpId:   req.Header.Get(RequestHttpIdKey),
+				ClientIp: req.Header.Get(httpx.XRealIp),
 				Time:     time.Now(),
 			})
 		},
 	}
 	return reverseProxy
 }
+
+// routeTransport sends the request with the transport of its route.
+type routeTransport struct{}
+
+func (routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch v := req.Context().Value(RouteInfoKey).(type) {
+	case error:
+		return nil, v
+	case *RouteInfo:
+		if (v.h2c || isGrpc(req)) && !httpx.IsWebSocketRequest(req) {
+			return v.roundTripOwnConn(req)
+		}
+		return v.transport.RoundTrip(req)
+	}
+	return nil, errors.New("route info not found:" + req.Host + ":" + req.URL.Path)
+}
+
+// newTransport creates the transport of a route, its own pool of the connections to the
+// clients of the route; a connection is kept for the next request only with keepAlive.
+func newTransport(info *RouteInfo, header time.Duration, keepAlive bool) *http.Transport {
+	return &http.Transport{
+		ResponseHeaderTimeout: header,
+		DisableKeepAlives:     !keepAlive,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       info.idle,
+		MaxIdleConns:          100,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return info.dial(ctx)
+		},
+	}
+}
+
+// dial opens a connection to a client of the route, selected by the balance key of the request.
+func (r *RouteInfo) dial(ctx context.Context) (net.Conn, error) {
+	key, _ := ctx.Value(BalanceKey).(string)
+	websocket, _ := ctx.Value(WebsocketKey).(bool)
+	connection, err := r.getProxyConnection(r.httpId, key, websocket)
+	if err != nil {
+		log.Error("get proxy connection error %v", err)
+		return nil, err
+	}
+	return connection, nil
+}
+
+// bodyState tells whether the response body was cut off: by the idle or total timeout, or
+// the client that went away; its visitor connection is closed rather than the body ended.
+type bodyState struct {
+	cut atomic.Bool
+}
+
+// idleBody is a response body that is closed when no data comes for the idle timeout.
+// A body that ends with the connection looks complete when it's closed, so the cut off is
+// told by the timer and the request context too.
+type idleBody struct {
+	io.ReadCloser
+	ctx   context.Context
+	idle  time.Duration
+	timer *time.Timer
+	state *bodyState
+}
+
+func newIdleBody(ctx context.Context, body io.ReadCloser, idle time.Duration, state *bodyState) io.ReadCloser {
+	if state == nil {
+		state = &bodyState{}
+	}
+	b := &idleBody{ReadCloser: body, ctx: ctx, idle: idle, state: state}
+	if idle > 0 {
+		b.timer = time.AfterFunc(idle, func() {
+			state.cut.Store(true)
+			_ = body.Close()
+		})
+	}
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if b.timer != nil && err == nil {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && (err != io.EOF || b.ctx.Err() != nil) {
+		b.state.cut.Store(true)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	return b.ReadCloser.Close()
+}
+
+// routeOf returns the route of the request, nil when none matched.
+func routeOf(req *http.Request) *RouteInfo {
+	info, _ := req.Context().Value(RouteInfoKey).(*RouteInfo)
+	return info
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	sql2 "database/sql"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/loadbalance"
+	"github.com/g-brook/brook/scmd/web/sql"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// testProxy serves the route of cfg by a proxy in front of the local server handler, the
+// local server speaks HTTP/1.1 and h2c like a gRPC one. It returns the proxy and the count
+// of the connections to the local server.
+func testProxy(t *testing.T, cfg configs.HttpRunnelProxy, handler http.HandlerFunc) (*Proxy, *atomic.Int32) {
+	testWebLog(t)
+	release := make(chan struct{})
+	local := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), releaseKey{}, release)))
+	}), &http2.Server{}))
+	conns := &atomic.Int32{}
+	local.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	local.Start()
+	t.Cleanup(local.Close)
+	t.Cleanup(func() { close(release) })
+	info, err := NewRouteInfo(0, cfg, func(string, string, bool) (net.Conn, error) {
+		return net.Dial("tcp", local.Listener.Addr().String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHttpProxy(func(*http.Request) (*RouteInfo, error) {
+		return info, nil
+	}, "test"), conns
+}
+
+// testWebLog opens an empty web database, the proxy logs the requests to it: they're dropped.
+func testWebLog(t *testing.T) {
+	if sql.SqlDB != nil {
+		return
+	}
+	db, err := sql2.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql.SqlDB = db
+}
+
+// serveProxy serves the proxy on a http server, it returns its url.
+func serveProxy(t *testing.T, proxy *Proxy) string {
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+type releaseKey struct{}
+
+// block waits until the test ends or the proxy went away.
+func block(r *http.Request) {
+	select {
+	case <-r.Context().Value(releaseKey{}).(chan struct{}):
+	case <-r.Context().Done():
+	}
+}
+
+func TestRouteDefaultTimeouts(t *testing.T) {
+	info, err := NewRouteInfo(0, configs.HttpRunnelProxy{Id: "a"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.transport.ResponseHeaderTimeout != defaultHeaderTimeout || defaultHeaderTimeout != 5*time.Second {
+		t.Fatalf("header timeout %v, want 5s", info.transport.ResponseHeaderTimeout)
+	}
+	if info.idle != defaultIdleTimeout || info.total != 0 {
+		t.Fatalf("idle %v and total %v, want %v and none", info.idle, info.total, defaultIdleTimeout)
+	}
+	info, err = NewRouteInfo(0, configs.HttpRunnelProxy{Id: "a", Timeout: &configs.HttpTimeoutConfig{Header: 30, Idle: 2, Total: 90}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.transport.ResponseHeaderTimeout != 30*time.Second || info.idle != 2*time.Second || info.total != 90*time.Second {
+		t.Fatalf("timeouts %v, %v, %v", info.transport.ResponseHeaderTimeout, info.idle, info.total)
+	}
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	headerLate := func(w http.ResponseWriter, r *http.Request) {
+		block(r)
+	}
+	bodyLate := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a"))
+		w.(http.Flusher).Flush()
+		block(r)
+	}
+	tests := []struct {
+		name    string
+		timeout configs.HttpTimeoutConfig
+		handler http.HandlerFunc
+		status  int
+		cut     bool
+	}{
+		{name: "header", timeout: configs.HttpTimeoutConfig{Header: 1}, handler: headerLate, status: http.StatusGatewayTimeout},
+		{name: "total", timeout: configs.HttpTimeoutConfig{Total: 1}, handler: headerLate, status: http.StatusGatewayTimeout},
+		{name: "idle", timeout: configs.HttpTimeoutConfig{Idle: 1}, handler: bodyLate, status: http.StatusOK, cut: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, _ := testProxy(t, configs.HttpRunnelProxy{Id: "a", Timeout: &tt.timeout}, tt.handler)
+			url := serveProxy(t, proxy)
+			start := time.Now()
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || (err != nil) != tt.cut {
+				t.Fatalf("status %d, body error %v", resp.StatusCode, err)
+			}
+			if d := time.Since(start); d > 4*time.Second {
+				t.Fatalf("took %v", d)
+			}
+		})
+	}
+}
+
+func TestProxyKeepAlive(t *testing.T) {
+	for _, keepAlive := range []bool{true, false} {
+		proxy, conns := testProxy(t, configs.HttpRunnelProxy{Id: "a", KeepAlive: keepAlive}, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		})
+		url := serveProxy(t, proxy)
+		for i := 0; i < 3; i++ {
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		want := int32(3)
+		if keepAlive {
+			want = 1
+		}
+		if got := conns.Load(); got != want {
+			t.Fatalf("keep alive %v: %d connections to the local server, want %d", keepAlive, got, want)
+		}
+	}
+}
+
+func TestRouteKeepAliveBalance(t *testing.T) {
+	tests := []struct {
+		balance   *configs.LoadBalanceConfig
+		keepAlive bool
+	}{
+		{balance: nil, keepAlive: true},
+		{balance: &configs.LoadBalanceConfig{}, keepAlive: true},
+		{balance: &configs.LoadBalanceConfig{Strategy: string(loadbalance.StrategyRoundRobin)}, keepAlive: true},
+		{balance: &configs.LoadBalanceConfig{Strategy: string(loadbalance.StrategyWeighted)}},
+		{balance: &configs.LoadBalanceConfig{Strategy: string(loadbalance.StrategyLeastConn)}},
+		{balance: &configs.LoadBalanceConfig{Strategy: string(loadbalance.StrategyHash)}},
+	}
+	for _, tt := range tests {
+		info, err := NewRouteInfo(0, configs.HttpRunnelProxy{Id: "a", KeepAlive: true, LoadBalance: tt.balance}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keepAlive := !info.transport.DisableKeepAlives; keepAlive != tt.keepAlive {
+			t.Fatalf("balance %+v: keep alive %v, want %v", tt.balance, keepAlive, tt.keepAlive)
+		}
+	}
+}
+
+func TestProxyWebsocketOlderClients(t *testing.T) {
+	info, err := NewRouteInfo(0, configs.HttpRunnelProxy{Id: "a"}, func(string, string, bool) (net.Conn, error) {
+		return nil, errWebsocketClient
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testWebLog(t)
+	url := serveProxy(t, NewHttpProxy(func(*http.Request) (*RouteInfo, error) {
+		return info, nil
+	}, "test"))
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+}
@@ -17,19 +17,29 @@
 package http
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/httpx"
+	"github.com/g-brook/brook/common/loadbalance"
+	"github.com/g-brook/brook/common/log"
+	"golang.org/x/net/http2"
 )
 
-var routes []*RouteInfo
-
-var lock sync.RWMutex
+const (
+	defaultHeaderTimeout = 5 * time.Second
+	defaultIdleTimeout   = 60 * time.Second
+)
 
-// ProxyConnectionFunction is a function that returns a net.Conn
-type ProxyConnectionFunction func(httpId string) (workConn net.Conn, err error)
+// ProxyConnectionFunction is a function that returns a net.Conn, the key is the hash key of the request,
+// websocket selects a client that streams the WebSocket upgrades.
+type ProxyConnectionFunction func(httpId string, key string, websocket bool) (workConn net.Conn, err error)
 
 // RouteFunction is a function that returns a RouteInfo
 type RouteFunction func(request *http.Request) (*RouteInfo, error)
@@ -42,46 +52,259 @@ type RouteInfo struct {
 
 	domain string
 
+	priority int
+
+	methods []string
+
+	headers map[string]string
+
+	query map[string]string
+
+	// order is the position of the route in the config, the last tie break.
+	order int
+
+	balance *configs.LoadBalanceConfig
+
+	// rewriter rewrites the requests of the route and their responses, nil without rewrite.
+	rewriter *httpx.Rewriter
+
+	// transport is the own pool of the connections of the route to its clients.
+	transport *http.Transport
+
+	// h2 opens the connections of the gRPC requests, and of all with h2c.
+	h2 *http2.Transport
+
+	// h2c the local server speaks HTTP/2 without TLS.
+	h2c bool
+
+	// idle is the longest wait for the next data of a response body.
+	idle time.Duration
+
+	// total limits the whole request, none when 0.
+	total time.Duration
+
 	getProxyConnection ProxyConnectionFunction
 }
 
-// AddRouteInfo adds a route to the routes slice
-func AddRouteInfo(httpId string, domain string, paths []string, fun ProxyConnectionFunction) {
-	lock.Lock()
-	defer lock.Unlock()
+// NewRouteInfo creates the route of a http config, without paths it matches every path.
+func NewRouteInfo(order int, cfg configs.HttpRunnelProxy, fun ProxyConnectionFunction) (*RouteInfo, error) {
+	rewriter, err := httpx.NewRewriter(cfg.Rewrite)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite of http %s: %w", cfg.Id, err)
+	}
 	info := &RouteInfo{
-		httpId:             httpId,
+		httpId:             cfg.Id,
 		getProxyConnection: fun,
-		domain:             domain,
+		domain:             strings.ToLower(cfg.Domain),
+		priority:           cfg.Priority,
+		methods:            cfg.Methods,
+		headers:            cfg.Headers,
+		query:              cfg.Query,
+		order:              order,
+		balance:            cfg.LoadBalance,
+		rewriter:           rewriter,
+	}
+	var header time.Duration
+	if timeout := cfg.Timeout; timeout != nil {
+		header, info.idle, info.total = seconds(timeout.Header), seconds(timeout.Idle), seconds(timeout.Total)
+	}
+	if header <= 0 {
+		header = defaultHeaderTimeout
+	}
+	if info.idle <= 0 {
+		info.idle = defaultIdleTimeout
+	}
+	keepAlive := cfg.KeepAlive
+	if keepAlive && !roundRobin(cfg.LoadBalance) {
+		log.Warn("Keep alive of http %s is ignored, its %s load balance selects per request", cfg.Id, cfg.LoadBalance.Strategy)
+		keepAlive = false
+	}
+	info.transport = newTransport(info, header, keepAlive)
+	info.h2 = newH2cTransport(info)
+	info.h2c = cfg.H2c
+	info.matcher = httpx.NewPathMatcher()
+	paths := cfg.Paths
+	if len(paths) == 0 {
+		paths = []string{"/*"}
 	}
-	info.matcher = httpx.NewPathMatcher(info)
 	for _, path := range paths {
 		info.matcher.AddPathMatcher(path, info)
 	}
-	routes = append(routes, info)
+	return info, nil
+}
+
+// rewriteRequest rewrites the request to the client.
+func (r *RouteInfo) rewriteRequest(req *http.Request) {
+	if r != nil && r.rewriter != nil {
+		r.rewriter.Request(req)
+	}
+}
+
+// rewriteResponse rewrites the headers of the response.
+func (r *RouteInfo) rewriteResponse(header http.Header) {
+	if r != nil && r.rewriter != nil {
+		r.rewriter.Response(header)
+	}
+}
+
+// matchRules tells if the request has one of the methods and all the headers and query
+// parameters of the route.
+func (r *RouteInfo) matchRules(req *http.Request) bool {
+	if len(r.methods) > 0 && !slices.ContainsFunc(r.methods, func(m string) bool {
+		return strings.EqualFold(m, req.Method)
+	}) {
+		return false
+	}
+	for key, value := range r.headers {
+		values := req.Header.Values(key)
+		if len(values) == 0 || (value != "" && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+	if len(r.query) > 0 {
+		query := req.URL.Query()
+		for key, value := range r.query {
+			if !query.Has(key) || (value != "" && !slices.Contains(query[key], value)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rules is the count of the rules of the route.
+func (r *RouteInfo) rules() int {
+	n := len(r.headers) + len(r.query)
+	if len(r.methods) > 0 {
+		n++
+	}
+	return n
+}
+
+// domainRank ranks an exact domain before a wildcard one, and a wildcard one with more
+// labels before one with less; an empty or * domain is last.
+func (r *RouteInfo) domainRank() [2]int {
+	switch {
+	case r.domain == "" || r.domain == "*":
+		return [2]int{0, 0}
+	case strings.HasPrefix(r.domain, "*."):
+		return [2]int{1, strings.Count(r.domain, ".")}
+	default:
+		return [2]int{2, 0}
+	}
 }
 
-func RouteClean() {
-	lock.Lock()
-	defer lock.Unlock()
-	routes = routes[:0]
+// RouteTable is the routes of a http tunnel server.
+type RouteTable struct {
+	lock   sync.RWMutex
+	routes []*RouteInfo
 }
 
-// GetRouteInfo returns the RouteInfo for a given path
-func GetRouteInfo(domain string, path string) *RouteInfo {
-	lock.RLock()
-	defer lock.RUnlock()
-	var infos []*RouteInfo
+func NewRouteTable() *RouteTable {
+	return &RouteTable{}
+}
+
+// Replace swaps the routes of the table at once, the requests in flight keep their route.
+func (t *RouteTable) Replace(routes []*RouteInfo) {
+	t.lock.Lock()
+	old := t.routes
+	t.routes = routes
+	t.lock.Unlock()
+	for _, info := range old {
+		info.transport.CloseIdleConnections()
+		info.h2.CloseIdleConnections()
+	}
+}
+
+// Match returns the route of the request with the highest precedence: the higher
+// priority, then the exact domain before the wildcard one, then the longest path, then
+// the one with more rules, then the first in the config.
+func (t *RouteTable) Match(req *http.Request) *RouteInfo {
+	t.lock.RLock()
+	routes := t.routes
+	t.lock.RUnlock()
+	domain := hostOf(req.Host)
+	var best *RouteInfo
+	var bestPath string
 	for _, info := range routes {
 		if !httpx.MatchDomain(info.domain, domain) {
 			continue
 		}
-		if info.matcher.Match(path).Matched {
-			infos = append(infos, info)
+		match := info.matcher.Match(req.URL.Path)
+		if !match.Matched || !info.matchRules(req) {
+			continue
+		}
+		if best == nil || compareRoute(info, match.Path, best, bestPath) < 0 {
+			best, bestPath = info, match.Path
+		}
+	}
+	return best
+}
+
+// compareRoute orders the routes that matched, by the patterns they matched with.
+func compareRoute(a *RouteInfo, aPath string, b *RouteInfo, bPath string) int {
+	if a.priority != b.priority {
+		return b.priority - a.priority
+	}
+	if ra, rb := a.domainRank(), b.domainRank(); ra != rb {
+		return slices.Compare(rb[:], ra[:])
+	}
+	if c := httpx.ComparePath(aPath, bPath); c != 0 {
+		return c
+	}
+	if a.rules() != b.rules() {
+		return b.rules() - a.rules()
+	}
+	return a.order - b.order
+}
+
+// seconds is the duration of v seconds.
+func seconds(v int) time.Duration {
+	return time.Duration(v) * time.Second
+}
+
+// roundRobin tells whether the load balance of a route is round robin, the default.
+func roundRobin(cfg *configs.LoadBalanceConfig) bool {
+	if cfg == nil {
+		return true
+	}
+	switch loadbalance.Strategy(cfg.Strategy) {
+	case loadbalance.StrategyWeighted, loadbalance.StrategyLeastConn, loadbalance.StrategyHash:
+		return false
+	}
+	return true
+}
+
+// hostOf returns the lower case host of the Host header, without the port.
+func hostOf(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// hashKey returns the key of the request for the hash load balancing, the client ip,
+// recovered behind the trusted proxies, when the cookie or header is missing.
+func (r *RouteInfo) hashKey(req *http.Request) string {
+	if r.balance == nil || r.balance.Strategy != string(loadbalance.StrategyHash) || req == nil {
+		return ""
+	}
+	switch r.balance.HashOn {
+	case "cookie":
+		if cookie, err := req.Cookie(r.balance.HashKey); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case "header":
+		if value := req.Header.Get(r.balance.HashKey); value != "" {
+			return value
 		}
 	}
-	if infos != nil {
-		return infos[0]
+	if ip := req.Header.Get(httpx.XRealIp); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
 	}
-	return nil
+	return host
 }
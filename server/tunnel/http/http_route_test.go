@@ -0,0 +1,230 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+func testRouteTable(t *testing.T, cfgs ...configs.HttpRunnelProxy) *RouteTable {
+	routes := make([]*RouteInfo, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		info, err := NewRouteInfo(i, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes = append(routes, info)
+	}
+	table := NewRouteTable()
+	table.Replace(routes)
+	return table
+}
+
+func TestRouteTableMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  []configs.HttpRunnelProxy
+		method  string
+		target  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name: "higher priority first",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Paths: []string{"/api/users"}},
+				{Id: "b", Domain: "*.test", Paths: []string{"/*"}, Priority: 1},
+			},
+			target: "http://a.test/api/users",
+			want:   "b",
+		},
+		{
+			name: "exact domain before wildcard",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "*.test", Paths: []string{"/api/users"}},
+				{Id: "b", Domain: "a.test", Paths: []string{"/*"}},
+			},
+			target: "http://a.test/api/users",
+			want:   "b",
+		},
+		{
+			name: "longer wildcard domain before shorter",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "*.test"},
+				{Id: "b", Domain: "*.a.test"},
+			},
+			target: "http://x.a.test/",
+			want:   "b",
+		},
+		{
+			name: "longest path",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Paths: []string{"/api/*"}},
+				{Id: "b", Domain: "a.test", Paths: []string{"/api/v1/*"}},
+			},
+			target: "http://a.test/api/v1/users",
+			want:   "b",
+		},
+		{
+			name: "more rules on the same path",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Paths: []string{"/api/*"}},
+				{Id: "b", Domain: "a.test", Paths: []string{"/api/*"}, Methods: []string{"GET"}},
+			},
+			target: "http://a.test/api/users",
+			want:   "b",
+		},
+		{
+			name: "first in the config on a tie",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Paths: []string{"/api/:id"}},
+				{Id: "b", Domain: "a.test", Paths: []string{"/api/:name"}},
+			},
+			target: "http://a.test/api/users",
+			want:   "a",
+		},
+		{
+			name: "method case insensitive",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Methods: []string{"post"}},
+			},
+			method: "POST",
+			target: "http://a.test/",
+			want:   "a",
+		},
+		{
+			name: "method not allowed",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Methods: []string{"POST", "PUT"}},
+			},
+			target: "http://a.test/",
+		},
+		{
+			name: "header value",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test"},
+				{Id: "b", Domain: "a.test", Headers: map[string]string{"X-Version": "2"}},
+			},
+			target:  "http://a.test/",
+			headers: map[string]string{"X-Version": "2"},
+			want:    "b",
+		},
+		{
+			name: "header other value",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test"},
+				{Id: "b", Domain: "a.test", Headers: map[string]string{"X-Version": "2"}},
+			},
+			target:  "http://a.test/",
+			headers: map[string]string{"X-Version": "1"},
+			want:    "a",
+		},
+		{
+			name: "header empty value needs it present",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Headers: map[string]string{"X-Canary": ""}},
+			},
+			target:  "http://a.test/",
+			headers: map[string]string{"x-canary": "yes"},
+			want:    "a",
+		},
+		{
+			name: "header missing",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Headers: map[string]string{"X-Canary": ""}},
+			},
+			target: "http://a.test/",
+		},
+		{
+			name: "query value",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test"},
+				{Id: "b", Domain: "a.test", Query: map[string]string{"v": "2"}},
+			},
+			target: "http://a.test/?v=1&v=2",
+			want:   "b",
+		},
+		{
+			name: "query empty value needs it present",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Query: map[string]string{"debug": ""}},
+			},
+			target: "http://a.test/?debug",
+			want:   "a",
+		},
+		{
+			name: "query missing",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Query: map[string]string{"debug": ""}},
+			},
+			target: "http://a.test/?v=1",
+		},
+		{
+			name: "no paths match every path",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test"},
+			},
+			target: "http://a.test/any/path",
+			want:   "a",
+		},
+		{
+			name: "prefix of a path doesn't match",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test", Paths: []string{"/api/v1"}},
+			},
+			target: "http://a.test/api",
+		},
+		{
+			name: "other domain",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "a.test"},
+			},
+			target: "http://b.test/",
+		},
+		{
+			name: "host with port",
+			routes: []configs.HttpRunnelProxy{
+				{Id: "a", Domain: "A.test"},
+			},
+			target: "http://a.TEST:8080/",
+			want:   "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := testRouteTable(t, tt.routes...)
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, tt.target, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			var got string
+			if info := table.Match(req); info != nil {
+				got = info.httpId
+			}
+			if got != tt.want {
+				t.Fatalf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
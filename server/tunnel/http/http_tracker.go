@@ -19,15 +19,13 @@ package http
 import (
 	"io"
 	"sync"
-	"time"
 
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/iox"
 	"github.com/g-brook/brook/common/log"
-	"github.com/g-brook/brook/common/ringbuffer"
 	"github.com/g-brook/brook/common/threading"
 	"github.com/g-brook/brook/common/transport"
-	"github.com/gobwas/ws"
 )
 
 type Future interface {
@@ -36,55 +34,17 @@ type Future interface {
 	Close()
 }
 
-type WsFuture struct {
-	buffer  *ringbuffer.RingBuffer
-	reqId   int64
-	tracker *Tracker
-	isClose bool
-}
-
-func (f *WsFuture) Read(bytes []byte) (int, error) {
-	if f.isClose {
-		return 0, io.EOF
-	}
-	return f.buffer.Read(bytes)
-}
-
-func (f *WsFuture) ReqId() int64 {
-	return f.reqId
-}
-
-func (f *WsFuture) Close() {
-	f.isClose = true
-}
-
-func newWsFuture(tracker *Tracker, reqId int64) *WsFuture {
-	buffer := ringbuffer.NewRingBuffer(1024)
-	future := &WsFuture{
-		buffer:  buffer,
-		reqId:   reqId,
-		tracker: tracker,
-	}
-	tracker.PutRequest(future)
-	return future
-}
-
-func (f *WsFuture) Done(data []byte) {
-	_, _ = f.buffer.Write(data)
-}
-
+// ResponseFuture is the response of a http request, the frames of the client are read
+// as one byte stream until the V1 frame ends it.
 type ResponseFuture struct {
-	done    chan struct{}
-	data    []byte
-	err     error
-	mu      sync.Mutex
+	buffer  *iox.StreamBuffer
 	reqId   int64
 	tracker *Tracker
 }
 
 func newResponseFuture(tracker *Tracker) *ResponseFuture {
 	future := &ResponseFuture{
-		done:    make(chan struct{}),
+		buffer:  iox.NewStreamBuffer(),
 		reqId:   newReqId(),
 		tracker: tracker,
 	}
@@ -97,60 +57,20 @@ func (f *ResponseFuture) ReqId() int64 {
 }
 
 func (f *ResponseFuture) Done(data []byte) {
-	f.mu.Lock()
-	already := f.isDoneLocked()
-	if !already {
-		f.data = data
-		f.Close()
-	}
-	f.mu.Unlock()
+	_, _ = f.buffer.Write(data)
 }
 
-func (f *ResponseFuture) Error(err error) {
-	f.mu.Lock()
-	already := f.isDoneLocked()
-	if !already {
-		f.err = err
-		f.Close()
-	}
-	f.mu.Unlock()
+func (f *ResponseFuture) Read(p []byte) (int, error) {
+	return f.buffer.Read(p)
 }
 
+// Close ends the response, what is received is still read.
 func (f *ResponseFuture) Close() {
-	select {
-	case <-f.done:
-		return
-	default:
-		close(f.done)
-	}
+	_ = f.buffer.Close()
 }
 
-func (f *ResponseFuture) Wait() ([]byte, error) {
-	<-f.done
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	return f.data, f.err
-}
-
-// WaitTimeout waits with timeout
-func (f *ResponseFuture) WaitTimeout(d time.Duration) ([]byte, error) {
-	select {
-	case <-f.done:
-		f.mu.Lock()
-		defer f.mu.Unlock()
-		return f.data, f.err
-	case <-time.After(d):
-		return nil, timeoutErr
-	}
-}
-
-func (f *ResponseFuture) isDoneLocked() bool {
-	select {
-	case <-f.done:
-		return true
-	default:
-		return false
-	}
+func (f *ResponseFuture) closeWithError(err error) {
+	_ = f.buffer.CloseWithError(err)
 }
 
 // Tracker HttpTracker httpx tracker
@@ -171,6 +91,11 @@ func (receiver *Tracker) GetFuture(reqId int64) (Future, bool) {
 	return receiver.trackers.Load(reqId)
 }
 
+// Pending get the count of the in-flight requests.
+func (receiver *Tracker) Pending() int {
+	return receiver.trackers.Len()
+}
+
 func (receiver *Tracker) Run() {
 	threading.GoSafe(receiver.readRev)
 }
@@ -180,6 +105,7 @@ func (receiver *Tracker) PutRequest(future Future) {
 }
 
 func (receiver *Tracker) readRev() {
+	defer receiver.closeAll()
 	readResponse := func() error {
 		pt := exchange.NewTunnelRead()
 		err := pt.Read(receiver.channel)
@@ -203,21 +129,21 @@ func (receiver *Tracker) readRev() {
 	}
 }
 
+// closeAll ends the requests of a closed channel, their readers don't wait for it.
+func (receiver *Tracker) closeAll() {
+	receiver.trackers.Range(func(key int64, value Future) (shouldContinue bool) {
+		value.Close()
+		receiver.trackers.Delete(key)
+		return true
+	})
+}
+
 func (receiver *Tracker) send(pt *exchange.TunnelProtocol) {
 	ch, ok := receiver.trackers.Load(pt.ReqId)
 	if ok {
-		if pt.Ver == exchange.WebsocketV2 {
-			if pt.AttrLen > 0 {
-				b := pt.Attr[0]
-				if b == byte(ws.OpClose) {
-					receiver.Close(pt.ReqId)
-					return
-				}
-			}
-		}
 		ch.Done(pt.Data)
 	}
-	if pt.Ver == exchange.V1 || pt.Ver == exchange.WebsocketV1 {
+	if pt.Ver == exchange.V1 {
 		receiver.Close(pt.ReqId)
 	}
 
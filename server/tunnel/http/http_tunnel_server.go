@@ -23,13 +23,15 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/exchange"
-	"github.com/g-brook/brook/common/filex"
 	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/httpx"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/loadbalance"
 	"github.com/g-brook/brook/common/log"
@@ -38,6 +40,7 @@ import (
 	"github.com/g-brook/brook/server/defin"
 	"github.com/g-brook/brook/server/srv"
 	"github.com/g-brook/brook/server/tunnel"
+	"golang.org/x/net/http2"
 )
 
 // TunnelHttpServer is a struct that represents a HTTP tunnel server.
@@ -46,15 +49,29 @@ type TunnelHttpServer struct {
 
 	proxyToConn *hash.SyncMap[string, *hash.SyncMap[string, *Tracker]]
 
+	// routes is the route table of the tunnel, other http tunnels have their own.
+	routes *RouteTable
+
+	// balances is the load balance of every http id.
+	balances *hash.SyncMap[string, loadbalance.Balance]
+
 	registerLock sync.Mutex
 
 	httpProxy *Proxy
 
-	websocketProxy *WebsocketProxy
-
-	tlsConfig *tls.Config
+	// tlsConfig and http2 are swapped on a config update while the connections read them.
+	tlsConfig atomic.Pointer[tls.Config]
 
 	isHttps bool
+
+	// http2 serves HTTP/2: h2 by ALPN on https, h2c on http.
+	http2 atomic.Bool
+
+	// h2 is the HTTP/2 server of the visitor connections.
+	h2 *http2.Server
+
+	// trusted the proxies whose forwarding headers tell the client.
+	trusted atomic.Pointer[httpx.TrustedProxies]
 }
 
 // NewHttpTunnelServer  is a constructor function for HttpTunnelServer. It takes a pointer to BaseTunnelServer as input
@@ -62,73 +79,84 @@ type TunnelHttpServer struct {
 // method of HttpTunnelServer, which is used to perform cleanup or subsequent processing operations startAfter the server
 // processes the request. The constructor also returns a pointer to HttpTunnelServer.
 func NewHttpTunnelServer(server *tunnel.BaseTunnelServer) (*TunnelHttpServer, error) {
-	if server.Cfg == nil {
+	if server.Cfg() == nil {
 		log.Error("start http tunnel server error, cfg is nil")
 		return nil, errors.New("cfg is nil")
 	}
-	if err := verifyCfg(server.Cfg); err != nil {
+	if err := verifyCfg(server.Cfg()); err != nil {
 		log.Error("http tunnel server cfg verify is false")
 		return nil, err
 	}
 	tunnelServer := &TunnelHttpServer{
 		BaseTunnelServer: server,
 		proxyToConn:      hash.NewSyncMap[string, *hash.SyncMap[string, *Tracker]](),
+		routes:           NewRouteTable(),
+		balances:         hash.NewSyncMap[string, loadbalance.Balance](),
+		h2:               &http2.Server{IdleTimeout: timeout},
 	}
 	server.DoStart = tunnelServer.startAfter
 	server.UpdateConfigFun = func(cfg *configs.ServerTunnelConfig) {
 		log.Info("http tunnel server config updated")
-		formatCfg(cfg, tunnelServer)
+		if err := formatCfg(cfg, tunnelServer); err != nil {
+			log.Error("http tunnel server config update error, keep the old routes and certificate: %v", err)
+		}
 	}
 	server.AddEvent(tunnel.Unregister, tunnelServer.unRegisterConn)
-	server.UpdateConfig(server.Cfg)
+	if err := formatCfg(server.Cfg(), tunnelServer); err != nil {
+		return nil, err
+	}
 	return tunnelServer, nil
 }
 
 // addRoute is a function that adds route information to the HttpTunnelServer. It
-func formatCfg(cfg *configs.ServerTunnelConfig, this *TunnelHttpServer) {
-	RouteClean()
+func formatCfg(cfg *configs.ServerTunnelConfig, this *TunnelHttpServer) error {
+	routes := make([]*RouteInfo, 0, len(cfg.Http))
+	for i, httpJson := range cfg.Http {
+		route, err := NewRouteInfo(i, httpJson, this.getProxyConnection)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
 	for _, httpJson := range cfg.Http {
-		AddRouteInfo(httpJson.Id, httpJson.Domain, httpJson.Paths, this.getProxyConnection)
+		this.balances.Store(httpJson.Id, this.newBalance(httpJson.Id, httpJson.LoadBalance))
 		if _, ok := this.proxyToConn.Load(httpJson.Id); !ok {
 			this.proxyToConn.Store(httpJson.Id, hash.NewSyncMap[string, *Tracker]())
 		}
 	}
+	this.routes.Replace(routes)
+	trusted, bad := httpx.ParseTrustedProxies(cfg.TrustedProxies)
+	if len(bad) > 0 {
+		log.Warn("Http tunnel %s: invalid trusted proxies %v, skip them", cfg.Id, bad)
+	}
+	this.trusted.Store(&trusted)
+	this.http2.Store(cfg.Http2)
 	if cfg.Type == lang.Https {
-		if loadTls(cfg, this) != nil {
-			panic("loadTls error.")
+		if err := loadTls(cfg, this); err != nil {
+			return err
 		}
 		this.isHttps = true
 	}
+	return nil
 }
 
 func loadTls(cfg *configs.ServerTunnelConfig, this *TunnelHttpServer) error {
-	if cfg.IsFileCert {
-		kf := cfg.KeyFile
-		cf := cfg.CertFile
-		if kf == "" || cf == "" {
-			log.Error("certFile or KeyFile is nil")
-			return errors.New("certFile or KeyFile is nil")
-		}
-		if !filex.FileExists(cf) || !filex.FileExists(kf) {
-			log.Error("certFile or KeyFile is not exist")
-			return errors.New("certFile or KeyFile is not exist")
-		}
-		pair, _ := tls.LoadX509KeyPair(cf, kf)
-		this.tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{pair},
-		}
+	var hosts []string
+	if useAcme(cfg) {
+		hosts = acmeHosts(cfg)
+	}
+	if len(hosts) > 0 {
+		acmeDomains.Store(cfg.Port, hosts)
 	} else {
-		cert, err := tls.X509KeyPair([]byte(cfg.CertContent), []byte(cfg.KeyContent))
-		if err != nil {
-			log.Error("load tls error:", err)
-			return err
-		}
-		this.tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
+		acmeDomains.Delete(cfg.Port)
+	}
+	certs, err := newSniCertificates(cfg, hosts)
+	if err != nil {
+		log.Error("load tls error: %v", err)
+		return err
 	}
+	this.tlsConfig.Store(certs.tlsConfig(cfg.Http2))
 	return nil
-
 }
 
 // verifyCfg is a function that verifies the configuration of the HttpTunnelServer. It
@@ -148,15 +176,14 @@ func verifyCfg(cfg *configs.ServerTunnelConfig) error {
 				log.Error("KeyFile is nil")
 				return errors.New("KeyFile is nil")
 			}
-		} else {
-			if cfg.CertContent == "" {
-				log.Error("certContent is nil")
-				return errors.New("certContent is nil")
-			}
+		} else if cfg.CertContent != "" {
 			if cfg.KeyContent == "" {
 				log.Error("KeyContent is nil")
 				return errors.New("KeyContent is nil")
 			}
+		} else if !hasRouteCertificate(cfg) && !useAcme(cfg) {
+			log.Error("certContent is nil")
+			return errors.New("certContent is nil")
 		}
 	}
 	for _, hcfg := range cfg.Http {
@@ -168,6 +195,10 @@ func verifyCfg(cfg *configs.ServerTunnelConfig) error {
 			log.Error("http.paths is nil")
 			return errors.New("http.paths is nil")
 		}
+		if hcfg.CertFile != "" && hcfg.KeyFile == "" {
+			log.Error("http.keyfile is nil")
+			return errors.New("http.keyfile is nil")
+		}
 		for _, path := range hcfg.Paths {
 			if path == "" {
 				log.Error("http.paths is empty")
@@ -178,27 +209,81 @@ func verifyCfg(cfg *configs.ServerTunnelConfig) error {
 	return nil
 }
 
+// hasRouteCertificate reports whether any http route has a certificate of its own.
+func hasRouteCertificate(cfg *configs.ServerTunnelConfig) bool {
+	for _, h := range cfg.Http {
+		if h.CertFile != "" || h.CertContent != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newBalance creates the load balance of the http id, weighted by the weight the clients
+// registered with, least connections by the in-flight requests of their trackers.
+func (htl *TunnelHttpServer) newBalance(httpId string, cfg *configs.LoadBalanceConfig) loadbalance.Balance {
+	if cfg == nil {
+		return loadbalance.NewRoundRobin()
+	}
+	weight := func(id string) int {
+		if channel, ok := htl.TunnelChannel.Load(id); ok {
+			if w, ok := channel.GetAttr(defin.WeightKey); ok {
+				if v, ok := w.(int); ok && v > 0 {
+					return v
+				}
+			}
+		}
+		return 1
+	}
+	load := func(id string) int {
+		if trackers, ok := htl.proxyToConn.Load(httpId); ok {
+			if tracker, ok := trackers.Load(id); ok {
+				return tracker.Pending()
+			}
+		}
+		return 0
+	}
+	return loadbalance.NewBalance(loadbalance.Strategy(cfg.Strategy), weight, load)
+}
+
 // getProxyConnection is a function that returns a net.Conn object based on the httpId. It
-// It returns an error if the httpId is not found.
-func (htl *TunnelHttpServer) getProxyConnection(httpId string) (workConn net.Conn, err error) {
+// It returns an error if the httpId is not found, or for a WebSocket if only older clients,
+// which don't stream it, are registered.
+func (htl *TunnelHttpServer) getProxyConnection(httpId string, balanceKey string, websocket bool) (workConn net.Conn, err error) {
 	err = errors.New("http Id not found in http connection:" + httpId)
 	channelIds, ok := htl.proxyToConn.Load(httpId)
 	var selectKeys []string
+	older := 0
 	channelIds.Range(func(key string, value *Tracker) (shouldContinue bool) {
 		channel, _ := htl.TunnelChannel.Load(key)
-		if channel != nil {
-			selectKeys = append(selectKeys, key)
-		} else {
+		if channel == nil {
 			htl.proxyToConn.Delete(key)
+		} else if websocket && !streamsWebsocket(channel) {
+			older++
+		} else {
+			selectKeys = append(selectKeys, key)
 		}
 		return true
 	})
+	if ok && len(selectKeys) == 0 && older > 0 {
+		log.Warn("The clients of http %s re-frame the WebSocket, upgrade them to proxy WebSocket", httpId)
+		return nil, errWebsocketClient
+	}
 	if !ok || len(selectKeys) == 0 {
 		return nil, err
 	}
 	var channel Channel
 	var tracker *Tracker
-	key := loadbalance.Select(selectKeys)
+	var key string
+	balance, _ := htl.balances.Load(httpId)
+	switch b := balance.(type) {
+	case loadbalance.HashBalance:
+		key = b.SelectByKey(selectKeys, balanceKey)
+	case loadbalance.Balance:
+		key = b.Select(selectKeys)
+	default:
+		key = loadbalance.Select(selectKeys)
+	}
 	channel, _ = htl.TunnelChannel.Load(key)
 	tracker, _ = channelIds.Load(key)
 	if channel == nil || tracker == nil {
@@ -220,6 +305,14 @@ func (htl *TunnelHttpServer) getProxyConnection(httpId string) (workConn net.Con
 	return
 }
 
+// streamsWebsocket tells whether the client of the channel streams the WebSocket upgrades,
+// an older one re-framed them.
+func streamsWebsocket(channel Channel) bool {
+	stream, _ := channel.GetAttr(defin.WebsocketStreamKey)
+	v, _ := stream.(bool)
+	return v
+}
+
 // Reader    is a method of HttpTunnelServer, which is used to process incoming requests. It
 func (htl *TunnelHttpServer) Reader(ch Channel, tb srv.TraverseBy) error {
 	channel := ch.(srv.GContext)
@@ -243,7 +336,7 @@ func (htl *TunnelHttpServer) Open(ch Channel, tb srv.TraverseBy) error {
 		var rwConn net.Conn
 		if htl.isHttps {
 			var tlsConn *tls.Conn
-			tlsConn = tls.Server(httpConn, htl.tlsConfig)
+			tlsConn = tls.Server(httpConn, htl.tlsConfig.Load())
 			errRc := newResponseWriter(tlsConn, httpConn, nil)
 			if err := tlsConn.Handshake(); err != nil {
 				log.Debug("TLS handshake failed: %v", err)
@@ -251,11 +344,25 @@ func (htl *TunnelHttpServer) Open(ch Channel, tb srv.TraverseBy) error {
 				_ = httpConn.Close()
 				return
 			}
+			if isAcmeChallenge(tlsConn) {
+				_ = tlsConn.Close()
+				return
+			}
+			if tlsConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+				httpConn.http2 = true
+				htl.serveHttp2(tlsConn, &http2.ServeConnOpts{})
+				return
+			}
 			rwConn = tlsConn
 		} else {
 			rwConn = httpConn
 		}
 		reader := bufio.NewReader(rwConn)
+		if !htl.isHttps && htl.http2.Load() && isH2cPreface(reader) {
+			httpConn.http2 = true
+			htl.serveHttp2(&bufferedConn{Conn: rwConn, reader: reader}, &http2.ServeConnOpts{})
+			return
+		}
 		for {
 			req, err := http.ReadRequest(reader)
 			rc := newResponseWriter(rwConn, httpConn, req)
@@ -265,16 +372,42 @@ func (htl *TunnelHttpServer) Open(ch Channel, tb srv.TraverseBy) error {
 				_ = rwConn.Close()
 				return
 			}
-			if isWebSocket(req) {
-				htl.websocketProxy.ServeHTTP(rc, req)
-			} else {
-				htl.httpProxy.ServeHTTP(rc, req)
-				_, _ = io.Copy(io.Discard, req.Body)
-				_ = req.Body.Close()
-				err := rc.finish(nil, req)
-				if err != nil {
+			req.RemoteAddr = httpConn.RemoteAddr().String()
+			if !htl.isHttps && htl.http2.Load() {
+				if settings, ok := h2cUpgrade(req); ok {
+					if _, err := rwConn.Write(h2cUpgradeResponse); err != nil {
+						_ = rwConn.Close()
+						return
+					}
+					httpConn.http2 = true
+					htl.serveHttp2(&bufferedConn{Conn: rwConn, reader: reader}, &http2.ServeConnOpts{
+						UpgradeRequest: req,
+						Settings:       settings,
+					})
+					return
+				}
+			}
+			if err := htl.forwarded(req); err != nil {
+				rc.WriteHeader(http.StatusForbidden)
+				rc.Header().Set("Connection", "close")
+				_, _ = rc.Write(httpx.GetPageNotFound(http.StatusForbidden))
+				_ = rc.finish(nil, req)
+				_ = rwConn.Close()
+				return
+			}
+			if !htl.isHttps && serveAcmeChallenge(rc, req) {
+				if err := rc.finish(nil, req); err != nil {
 					_ = rwConn.Close()
 				}
+				continue
+			}
+			rc.reader = reader
+			htl.httpProxy.ServeHTTP(rc, req)
+			_, _ = io.Copy(io.Discard, req.Body)
+			_ = req.Body.Close()
+			if err := rc.finish(nil, req); err != nil {
+				_ = rwConn.Close()
+				return
 			}
 		}
 	})
@@ -282,6 +415,37 @@ func (htl *TunnelHttpServer) Open(ch Channel, tb srv.TraverseBy) error {
 	return nil
 }
 
+// forwarded recovers the client of the request behind the trusted proxies and checks its
+// ip, then sets the forwarding headers for the client tunnel: the peer is appended to the
+// X-Forwarded-For of a trusted proxy, the headers of any other peer are dropped.
+func (htl *TunnelHttpServer) forwarded(req *http.Request) error {
+	peer, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	var trusted httpx.TrustedProxies
+	if p := htl.trusted.Load(); p != nil {
+		trusted = *p
+	}
+	peerIp := peer.Addr().Unmap()
+	client := trusted.ClientIp(peerIp, req.Header)
+	if !trusted.Contains(peerIp) {
+		req.Header.Del(httpx.XForwardedFor)
+		req.Header.Del(httpx.Forwarded)
+	} else if client != peerIp {
+		if err = htl.CheckIp(client.AsSlice()); err != nil {
+			return err
+		}
+	}
+	forwardedFor := peerIp.String()
+	if prior := req.Header.Values(httpx.XForwardedFor); len(prior) > 0 {
+		forwardedFor = strings.Join(prior, ", ") + ", " + forwardedFor
+	}
+	req.Header.Set(httpx.XForwardedFor, forwardedFor)
+	req.Header.Set(httpx.XRealIp, client.String())
+	return nil
+}
+
 // After is a method of HttpTunnelServer, which is used to perform cleanup or subsequent processing operations startAfter
 // the server processes the request.This method currently does not perform any operation, and returns nil directly.
 // This may be a reserved hook point for future additions.Parameters:
@@ -289,19 +453,20 @@ func (htl *TunnelHttpServer) Open(ch Channel, tb srv.TraverseBy) error {
 func (htl *TunnelHttpServer) startAfter() error {
 	tunnel.AddTunnel(htl)
 	htl.Server.AddHandler(htl)
-	htl.httpProxy = NewHttpProxy(htl.getRoute, htl.Cfg.Id)
-	htl.websocketProxy = NewWebsocketProxy(htl.getRoute)
-	log.Info("Http tunnel server started:%v", htl.Cfg.Port)
+	htl.httpProxy = NewHttpProxy(htl.getRoute, htl.Cfg().Id)
+	if htl.isHttps {
+		prefetchAcme(htl.Cfg().Port)
+	}
+	log.Info("Http tunnel server started:%v", htl.Cfg().Port)
 	return nil
 }
 
-// getRoute is a method of HttpTunnelServer, which is used to get the route information based on the request path.
+// getRoute is a method of HttpTunnelServer, which is used to get the route information of the request
+// from the route table of the tunnel.
 func (htl *TunnelHttpServer) getRoute(req *http.Request) (*RouteInfo, error) {
-	host := req.Host
-	hosts := strings.Split(host, ":")
-	info := GetRouteInfo(hosts[0], req.URL.Path)
+	info := htl.routes.Match(req)
 	if info == nil {
-		return nil, errors.New("route info not found:" + hosts[0] + ":" + req.URL.Path)
+		return nil, errors.New("route info not found:" + req.Host + ":" + req.URL.Path)
 	}
 	return info, nil
 }
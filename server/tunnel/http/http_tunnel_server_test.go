@@ -0,0 +1,92 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/hash"
+	"github.com/g-brook/brook/common/loadbalance"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+	"github.com/g-brook/brook/server/tunnel"
+)
+
+// testClientChannel is the tunnel channel of a client, which streams the WebSocket
+// upgrades unless it's an older one.
+func testClientChannel(t *testing.T, streams bool) transport.Channel {
+	conn, other := net.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, other)
+	}()
+	ch := transport.NewCChannel(conn, context.Background())
+	ch.AddAttr(defin.WebsocketStreamKey, streams)
+	t.Cleanup(func() {
+		_ = ch.Close()
+		_ = other.Close()
+	})
+	return ch
+}
+
+func TestGetProxyConnectionWebsocket(t *testing.T) {
+	tests := []struct {
+		name      string
+		clients   []bool
+		websocket bool
+		err       error
+	}{
+		{name: "older client on http", clients: []bool{false}},
+		{name: "older client on websocket", clients: []bool{false}, websocket: true, err: errWebsocketClient},
+		{name: "client on websocket", clients: []bool{true}, websocket: true},
+		{name: "mixed clients on websocket", clients: []bool{false, true, false}, websocket: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			htl := &TunnelHttpServer{
+				BaseTunnelServer: tunnel.NewBaseTunnelServer(&configs.ServerTunnelConfig{}),
+				proxyToConn:      hash.NewSyncMap[string, *hash.SyncMap[string, *Tracker]](),
+				balances:         hash.NewSyncMap[string, loadbalance.Balance](),
+			}
+			trackers := hash.NewSyncMap[string, *Tracker]()
+			for _, streams := range tt.clients {
+				ch := testClientChannel(t, streams)
+				htl.TunnelChannel.Store(ch.GetId(), ch)
+				trackers.Store(ch.GetId(), NewHttpTracker(ch))
+			}
+			htl.proxyToConn.Store("a", trackers)
+			// Every client is selected once by the round robin.
+			for range tt.clients {
+				conn, err := htl.getProxyConnection("a", "", tt.websocket)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error %v, want %v", err, tt.err)
+				}
+				if err != nil {
+					continue
+				}
+				if ch := conn.(*ProxyConnection).Conn.(transport.Channel); tt.websocket && !streamsWebsocket(ch) {
+					t.Fatalf("selected an older client for a WebSocket")
+				}
+				_ = conn.Close()
+			}
+		})
+	}
+}
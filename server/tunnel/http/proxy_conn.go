@@ -17,17 +17,11 @@
 package http
 
 import (
-	"errors"
-	"fmt"
-	"io"
 	"net"
-	"runtime"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/g-brook/brook/common/exchange"
-	"github.com/gobwas/ws"
 )
 
 var (
@@ -37,74 +31,22 @@ var (
 	RequestDomainKey = "br_domain"
 	ProxyKey         = "httpProxy"
 	ForwardedKey     = "X-Forwarded-For"
+	BalanceKey       = "balanceKey"
+	WebsocketKey     = "websocket"
+	BodyStateKey     = "bodyState"
 	index            atomic.Int64
-	timeoutErr       = &timeoutError{}
-	readDone         = errors.New("read done")
+	streamAttr       = []byte{exchange.HttpStreamFlag}
 )
 
 func newReqId() int64 {
 	return index.Add(1)
 }
 
-type timeoutError struct {
-}
-
-func (timeoutError) Error() string   { return "read timeout" }
-func (timeoutError) Timeout() bool   { return true }
-func (timeoutError) Temporary() bool { return true } // optional
-type WebsocketConnection struct {
-	net.Conn
-	tracker     *Tracker
-	future      *WsFuture
-	path        string
-	payloadType byte
-}
-
-func (wc *WebsocketConnection) Close() error {
-	bytes := []byte(wc.path)
-	attr := make([]byte, len(bytes)+1)
-	attr[0] = byte(ws.OpClose)
-	copy(attr[1:], bytes)
-	writer := exchange.NewTunnelWebsocketWriterV2([]byte{}, attr, wc.future.ReqId())
-	return writer.Writer(wc.Conn)
-}
-
-func (wc *WebsocketConnection) Write(b []byte) (n int, err error) {
-	fmt.Printf("WebsocketConnection buf 首地址: %p\n", &b[0])
-	bytes := []byte(wc.path)
-	attr := make([]byte, len(bytes)+1)
-	attr[0] = wc.payloadType
-	copy(attr[1:], bytes)
-	writer := exchange.NewTunnelWebsocketWriterV2(b, attr, wc.future.ReqId())
-	err = writer.Writer(wc.Conn)
-	if err == io.EOF {
-		wc.tracker.Close(wc.future.ReqId())
-	}
-	return len(b), err
-}
-
-func (wc *WebsocketConnection) Read(p []byte) (n int, err error) {
-	for {
-		read, err := wc.future.Read(p)
-		if err == io.EOF {
-			return 0, err
-		}
-		if read <= 0 {
-			runtime.Gosched()
-			continue
-		}
-		return read, err
-	}
-}
-
 type ProxyConnection struct {
 	net.Conn
-	tracker     *Tracker
-	readBuf     []byte
-	future      *ResponseFuture
-	mu          sync.Mutex
-	isWebsocket bool
-	path        string
+	tracker   *Tracker
+	future    *ResponseFuture
+	closeOnce sync.Once
 }
 
 func NewProxyConnection(conn net.Conn,
@@ -118,20 +60,11 @@ func NewProxyConnection(conn net.Conn,
 
 // Write implements the io.Writer interface for ProxyConnection.
 // It encodes the provided byte slice into a tunnel protocol format and writes it to the connection.
-// The encoding method differs based on whether the connection is a WebSocket or regular connection.
+// The bytes after an upgrade, such as the frames of a WebSocket, go the same way.
 func (proxy *ProxyConnection) Write(b []byte) (n int, err error) {
-	//encode to tunnel.
-	// Create a tunnel protocol writer based on connection type
-	var writer *exchange.TunnelProtocol
 	id := proxy.future.ReqId() // Get the request ID from the future
-	// Check if connection is WebSocket to determine writer type
-	if proxy.isWebsocket {
-		// For WebSocket connections, create a WebSocket tunnel writer with path information
-		writer = exchange.NewTunnelWebsocketWriterV1(b, []byte(proxy.path), id)
-	} else {
-		// For regular connections, create a standard tunnel writer
-		writer = exchange.NewTunnelWriter(b, id)
-	}
+	// A standard tunnel writer that lets the client stream the response
+	writer := exchange.NewTunnelAttrWriter(exchange.V1, b, streamAttr, id)
 	// Write the encoded data to the connection
 	err = writer.Writer(proxy.Conn)
 	if err != nil {
@@ -143,46 +76,23 @@ func (proxy *ProxyConnection) Write(b []byte) (n int, err error) {
 }
 
 // Read implements the io.Reader interface for ProxyConnection
-// It reads data from the connection, first checking any cached data,
-// then waiting for new data if necessary
+// It reads the response as the client sends it, io.EOF once the client ended it.
+// The timeouts are up to the http transport, it closes the connection.
 func (proxy *ProxyConnection) Read(p []byte) (n int, err error) {
-	// 先从缓存里读
-	if len(proxy.readBuf) > 0 {
-		n = copy(p, proxy.readBuf)
-		proxy.readBuf = proxy.readBuf[n:]
-		return n, nil
-	}
-	// 从 future 等待数据
-	bytes, err := proxy.future.WaitTimeout(5 * time.Second)
-	if err != nil {
-		return 0, err
-	}
-	n = copy(p, bytes)
-
-	b := len(bytes)
-	// 如果还有剩余，放到 readBuf 里，下次 Read 时读出
-	if n < b {
-		proxy.readBuf = append(proxy.readBuf, bytes[n:]...)
-	}
-	// If response returning bytes is empty, then return readDone
-	if b <= 0 {
-		return 0, readDone
-	}
-	return n, nil
-}
-
-func (proxy *ProxyConnection) websocket(payloadType byte) net.Conn {
-	return &WebsocketConnection{
-		payloadType: payloadType,
-		Conn:        proxy.Conn,
-		tracker:     proxy.tracker,
-		future:      newWsFuture(proxy.tracker, proxy.future.ReqId()),
-		path:        proxy.path}
+	return proxy.future.Read(p)
 }
 
+// Close releases the request, the client is told to close its connection to the local
+// server as well: a kept-alive or streamed response is still open there.
 func (proxy *ProxyConnection) Close() error {
-	if proxy.future != nil {
+	proxy.closeOnce.Do(func() {
+		if proxy.future == nil {
+			return
+		}
+		_ = exchange.NewTunnelVerWriter(exchange.HttpClose, nil, proxy.future.reqId).Writer(proxy.Conn)
+		// A response the client didn't end is cut off, not complete.
+		proxy.future.closeWithError(net.ErrClosed)
 		proxy.tracker.Close(proxy.future.reqId)
-	}
+	})
 	return nil
 }
@@ -0,0 +1,148 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/filex"
+	"github.com/g-brook/brook/common/httpx"
+	"github.com/g-brook/brook/common/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/http2"
+)
+
+// routeCertificate is the certificate presented for the domain of a http route.
+type routeCertificate struct {
+	domain string
+	cert   *tls.Certificate
+}
+
+// sniCertificates selects the certificate of a handshake by its SNI: the certificate of the
+// matching route, else the ACME one, else the certificate of the tunnel.
+type sniCertificates struct {
+	routes      []*routeCertificate
+	defaultCert *tls.Certificate
+	acmeHosts   []string
+}
+
+// newSniCertificates loads the certificates of the tunnel and of its routes.
+func newSniCertificates(cfg *configs.ServerTunnelConfig, acmeHosts []string) (*sniCertificates, error) {
+	defaultCert, err := loadCertificate(cfg.IsFileCert, cfg.CertFile, cfg.KeyFile, cfg.CertContent, cfg.KeyContent)
+	if err != nil {
+		return nil, err
+	}
+	s := &sniCertificates{defaultCert: defaultCert, acmeHosts: acmeHosts}
+	for _, h := range cfg.Http {
+		cert, err := loadCertificate(h.CertFile != "", h.CertFile, h.KeyFile, h.CertContent, h.KeyContent)
+		if err != nil {
+			log.Error("load certificate of http route %s error: %v", h.Id, err)
+			return nil, err
+		}
+		if cert != nil {
+			s.routes = append(s.routes, &routeCertificate{domain: strings.ToLower(h.Domain), cert: cert})
+		}
+	}
+	if s.defaultCert == nil && len(s.routes) == 0 && len(s.acmeHosts) == 0 {
+		return nil, errors.New("no certificate of the https tunnel")
+	}
+	// The most specific domain matches first: exact domains, then the longer wildcards.
+	slices.SortStableFunc(s.routes, func(a, b *routeCertificate) int {
+		return domainRank(b.domain) - domainRank(a.domain)
+	})
+	return s, nil
+}
+
+// tlsConfig returns the tls config which selects the certificate on every handshake,
+// h2 offers HTTP/2 by ALPN.
+func (s *sniCertificates) tlsConfig(h2 bool) *tls.Config {
+	protos := []string{"http/1.1"}
+	if h2 {
+		protos = append([]string{http2.NextProtoTLS}, protos...)
+	}
+	if len(s.acmeHosts) > 0 {
+		protos = append(protos, acme.ALPNProto)
+	}
+	return &tls.Config{
+		GetCertificate: s.getCertificate,
+		NextProtos:     protos,
+	}
+}
+
+func (s *sniCertificates) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	useAcme := len(s.acmeHosts) > 0 && acmeManager != nil
+	if useAcme && slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+		return acmeManager.GetCertificate(hello)
+	}
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		for _, r := range s.routes {
+			if httpx.MatchDomain(r.domain, name) {
+				return r.cert, nil
+			}
+		}
+		if useAcme && slices.Contains(s.acmeHosts, name) {
+			return acmeManager.GetCertificate(hello)
+		}
+	}
+	if s.defaultCert != nil {
+		return s.defaultCert, nil
+	}
+	return nil, errors.New("no certificate for server name: " + name)
+}
+
+// domainRank orders the domains by how specific they are.
+func domainRank(domain string) int {
+	switch {
+	case domain == "" || domain == "*":
+		return 0
+	case strings.HasPrefix(domain, "*."):
+		return len(domain)
+	default:
+		return 1 << 16
+	}
+}
+
+// loadCertificate loads a key pair from the files or from the contents, it returns nil
+// when there is none.
+func loadCertificate(isFile bool, certFile, keyFile, certContent, keyContent string) (*tls.Certificate, error) {
+	if isFile {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("certFile or KeyFile is nil")
+		}
+		if !filex.FileExists(certFile) || !filex.FileExists(keyFile) {
+			return nil, errors.New("certFile or KeyFile is not exist")
+		}
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &pair, nil
+	}
+	if certContent == "" {
+		return nil, nil
+	}
+	pair, err := tls.X509KeyPair([]byte(certContent), []byte(keyContent))
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
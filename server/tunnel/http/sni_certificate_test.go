@@ -0,0 +1,133 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+)
+
+// testCertificate returns a self-signed key pair in PEM, its common name tells which
+// certificate was selected.
+func testCertificate(t *testing.T, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+}
+
+func testRoute(t *testing.T, domain string) configs.HttpRunnelProxy {
+	cert, key := testCertificate(t, domain)
+	return configs.HttpRunnelProxy{Id: domain, Domain: domain, CertContent: cert, KeyContent: key}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestSniCertificates(t *testing.T) {
+	defaultCert, defaultKey := testCertificate(t, "default")
+	cfg := &configs.ServerTunnelConfig{
+		CertContent: defaultCert,
+		KeyContent:  defaultKey,
+		Http: []configs.HttpRunnelProxy{
+			testRoute(t, "*.test"),
+			testRoute(t, "*.b.test"),
+			testRoute(t, "a.test"),
+			{Id: "nocert", Domain: "c.test"},
+		},
+	}
+	certs, err := newSniCertificates(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		serverName string
+		want       string
+	}{
+		{"exact before wildcard", "a.test", "a.test"},
+		{"exact ignores case and root dot", "A.Test.", "a.test"},
+		{"wildcard", "x.test", "*.test"},
+		{"longer wildcard first", "y.b.test", "*.b.test"},
+		{"wildcard matches deeper names", "x.y.test", "*.test"},
+		{"route without certificate", "c.test", "*.test"},
+		{"no matching route", "other.org", "default"},
+		{"missing sni", "", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := certs.getCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := commonName(t, cert); got != tt.want {
+				t.Fatalf("certificate of %q is %s, want %s", tt.serverName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniCertificatesWithoutDefault(t *testing.T) {
+	cfg := &configs.ServerTunnelConfig{Http: []configs.HttpRunnelProxy{testRoute(t, "a.test")}}
+	certs, err := newSniCertificates(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := certs.getCertificate(&tls.ClientHelloInfo{ServerName: "a.test"})
+	if err != nil || commonName(t, cert) != "a.test" {
+		t.Fatalf("certificate of a.test: %v", err)
+	}
+	for _, name := range []string{"", "b.test"} {
+		if _, err = certs.getCertificate(&tls.ClientHelloInfo{ServerName: name}); err == nil {
+			t.Errorf("certificate of %q without a fallback", name)
+		}
+	}
+	if _, err = newSniCertificates(&configs.ServerTunnelConfig{}, nil); err == nil {
+		t.Error("https tunnel without any certificate")
+	}
+}
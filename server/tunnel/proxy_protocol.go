@@ -0,0 +1,91 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package tunnel
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/g-brook/brook/common/proxyproto"
+	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
+)
+
+// SendVisitorAddr writes the address of the visitor and the one it connected to on the
+// work connection, before any data, when the client registered it for the PROXY protocol.
+// They go as a PROXY protocol v2 header, the client writes the version it was told to.
+func SendVisitorAddr(workConn transport.Channel, visitor, local net.Addr) error {
+	if v, ok := workConn.GetAttr(defin.ProxyProtocolKey); !ok || v != true {
+		return nil
+	}
+	src, err := tcpAddr(visitor)
+	if err != nil {
+		return err
+	}
+	dst, err := tcpAddr(local)
+	if err != nil {
+		return err
+	}
+	header, err := proxyproto.Append(nil, proxyproto.V2, src, dst)
+	if err != nil {
+		return err
+	}
+	_, err = workConn.Write(header)
+	return err
+}
+
+// tcpAddr the work connection is a stream, the visitor of a QUIC tunnel comes over udp.
+// An address without IP, e.g. of a listener on all interfaces, gets the unspecified one.
+func tcpAddr(addr net.Addr) (net.Addr, error) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, err
+	}
+	ip := netip.IPv4Unspecified()
+	if host != "" {
+		if ip, err = netip.ParseAddr(host); err != nil {
+			return nil, err
+		}
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(p))), nil
+}
+
+// ReadProxyHeader reads the PROXY protocol header of a connection accepted behind a load
+// balancer, the returned connection has the address of the visitor it tells.
+func ReadProxyHeader(conn net.Conn) (net.Conn, error) {
+	header, err := proxyproto.Read(conn)
+	if err != nil {
+		return nil, err
+	}
+	if src, ok := header.Src.(*net.TCPAddr); ok {
+		return &proxiedConn{Conn: conn, remoteAddr: src}, nil
+	}
+	return conn, nil
+}
+
+type proxiedConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
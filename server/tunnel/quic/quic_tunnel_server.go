@@ -17,9 +17,205 @@
 package quic
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/iox"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/threading"
+	"github.com/g-brook/brook/common/tlsx"
+	trp "github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/metrics"
 	"github.com/g-brook/brook/server/tunnel"
+	"github.com/g-brook/brook/server/tunnel/tcp"
+	"github.com/quic-go/quic-go"
 )
 
+// TunnelQUICServer terminates QUIC on the remote port and forwards every QUIC
+// stream to the client like a TCP connection.
 type TunnelQUICServer struct {
 	*tunnel.BaseTunnelServer
+	registerLock sync.Mutex
+	resources    *tcp.Resources
+	listener     *quic.Listener
+	connections  atomic.Int32
+}
+
+// NewQuicTunnelServer creates a new QUIC tunnel server instance
+func NewQuicTunnelServer(server *tunnel.BaseTunnelServer) *TunnelQUICServer {
+	tunnelServer := &TunnelQUICServer{
+		BaseTunnelServer: server,
+		resources:        tcp.NewResources(100, server.Cfg(), server),
+	}
+	server.DoListen = tunnelServer.listen
+	server.StopAcceptFun = tunnelServer.closeListener
+	server.DoStart = tunnelServer.startAfter
+	server.PoolIdleFun = tunnelServer.resources.Idle
+	server.ConnectionsFun = func() int {
+		return int(tunnelServer.connections.Load())
+	}
+	return tunnelServer
+}
+
+func (htl *TunnelQUICServer) RegisterConn(ch trp.Channel, request exchange.TRegister) (serverId string, err error) {
+	if request.GetProxyId() == "" {
+		log.Warn("Register quic tunnel, but It' proxyId is nil")
+		return "", errors.New("it' proxyId is nil")
+	}
+	htl.registerLock.Lock()
+	defer htl.registerLock.Unlock()
+	serverId, err = htl.BaseTunnelServer.RegisterConn(ch, request)
+	log.Info("Register quic tunnel, proxyId: %s", request.GetProxyId())
+	return
+}
+
+func (htl *TunnelQUICServer) OpenWorker(_ trp.Channel, request *exchange.ClientWorkConnReq) error {
+	ch, b := htl.TunnelChannel.Load(request.ServerId)
+	if b && !ch.IsClose() {
+		_ = htl.resources.Put(ch)
+		log.Info("add user connection, proxyId: %s", request.ProxyId)
+		return nil
+	}
+	return errors.New("channel is nil or closed")
+}
+
+func (htl *TunnelQUICServer) listen() error {
+	if htl.Cfg().ProxyProtocol {
+		log.Warn("Tunnel %s: PROXY protocol is only read on tcp, ignored", htl.Id())
+	}
+	tlsConfig, err := loadTls(htl.Cfg())
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf(":%d", htl.Port())
+	listener, err := quic.ListenAddr(addr, tlsConfig, trp.NewQuicConfig())
+	if err != nil {
+		return err
+	}
+	htl.listener = listener
+	threading.GoSafe(htl.acceptLoop)
+	return nil
+}
+
+func (htl *TunnelQUICServer) acceptLoop() {
+	for {
+		conn, err := htl.listener.Accept(context.Background())
+		if err != nil {
+			log.Info("Quic tunnel server %d accept exit: %v", htl.Port(), err)
+			return
+		}
+		if err = htl.CheckAddr(conn.RemoteAddr()); err != nil {
+			_ = conn.CloseWithError(0, "forbidden")
+			continue
+		}
+		threading.GoSafe(func() {
+			htl.serveConn(conn)
+		})
+	}
+}
+
+func (htl *TunnelQUICServer) serveConn(conn *quic.Conn) {
+	htl.connections.Add(1)
+	defer htl.connections.Add(-1)
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			log.Debug("Quic connection close %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+		threading.GoSafe(func() {
+			htl.serveStream(trp.NewQuicStream(stream, conn))
+		})
+	}
+}
+
+func (htl *TunnelQUICServer) serveStream(stream *trp.QuicStream) {
+	userConn, err := htl.resources.Get()
+	if userConn == nil || err != nil {
+		log.Warn("Quic tunnel %d get user connection error: %v", htl.Port(), err)
+		_ = stream.Close()
+		return
+	}
+	if err = tunnel.SendVisitorAddr(userConn, stream.RemoteAddr(), stream.LocalAddr()); err != nil {
+		log.Warn("Quic tunnel %d send visitor address error: %v", htl.Port(), err)
+		_ = userConn.Close()
+		_ = stream.Close()
+		return
+	}
+	errs := iox.Pipe(&trafficStream{QuicStream: stream, traffic: htl.TrafficObj()}, userConn)
+	log.Debug("iox.Pipe error %v", errs)
+}
+
+func (htl *TunnelQUICServer) startAfter() error {
+	tunnel.AddTunnel(htl)
+	log.Info("QUIC tunnel server started:%v", htl.Port())
+	return nil
+}
+
+// Shutdown closes the QUIC listener and the registered tunnels.
+func (htl *TunnelQUICServer) Shutdown() {
+	htl.closeListener()
+	htl.BaseTunnelServer.Shutdown()
+}
+
+// closeListener stops accepting, the accepted connections keep running.
+func (htl *TunnelQUICServer) closeListener() {
+	if htl.listener != nil {
+		_ = htl.listener.Close()
+	}
+}
+
+// loadTls uses the certificate of the tunnel, or a self-signed one when there is none.
+// Only the ALPN of the config is negotiated.
+func loadTls(cfg *configs.ServerTunnelConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if cfg.IsFileCert && cfg.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	} else if cfg.CertContent != "" {
+		cert, err = tls.X509KeyPair([]byte(cfg.CertContent), []byte(cfg.KeyContent))
+	} else {
+		log.Warn("Quic tunnel %s has no certificate, use a self-signed one", cfg.Id)
+		cert, err = tlsx.NewSelfSignedCertificate()
+	}
+	if err != nil {
+		log.Error("load tls error: %v", err)
+		return nil, err
+	}
+	protos := cfg.Alpn
+	if len(protos) == 0 {
+		protos = []string{trp.QuicAlpn}
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   protos,
+	}, nil
+}
+
+// trafficStream counts the bytes of a user stream.
+type trafficStream struct {
+	*trp.QuicStream
+	traffic *metrics.TunnelTraffic
+}
+
+func (t *trafficStream) Read(p []byte) (int, error) {
+	n, err := t.QuicStream.Read(p)
+	if t.traffic != nil && n > 0 {
+		t.traffic.AddInBytes(n)
+	}
+	return n, err
+}
+
+func (t *trafficStream) Write(p []byte) (int, error) {
+	n, err := t.QuicStream.Write(p)
+	if t.traffic != nil && n > 0 {
+		t.traffic.AddOutBytes(n)
+	}
+	return n, err
 }
@@ -0,0 +1,298 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package socks5
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/iox"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	"github.com/g-brook/brook/common/socks5"
+	"github.com/g-brook/brook/common/threading"
+	trp "github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/metrics"
+	"github.com/g-brook/brook/server/tunnel"
+	"github.com/g-brook/brook/server/tunnel/tcp"
+)
+
+// handshakeTimeout bounds the SOCKS5 handshake and the dial of the client.
+const handshakeTimeout = 15 * time.Second
+
+// TunnelSocks5Server serves SOCKS5 on the remote port. Each request is carried by a work
+// connection to the client, which dials the destination from its network.
+type TunnelSocks5Server struct {
+	*tunnel.BaseTunnelServer
+	registerLock sync.Mutex
+	resources    *tcp.Resources
+	listener     net.Listener
+	connections  atomic.Int32
+}
+
+// NewSocks5TunnelServer creates a new SOCKS5 tunnel server instance
+func NewSocks5TunnelServer(server *tunnel.BaseTunnelServer) *TunnelSocks5Server {
+	tunnelServer := &TunnelSocks5Server{
+		BaseTunnelServer: server,
+		resources:        tcp.NewResources(100, server.Cfg(), server),
+	}
+	server.DoListen = tunnelServer.listen
+	server.StopAcceptFun = tunnelServer.closeListener
+	server.DoStart = tunnelServer.startAfter
+	server.PoolIdleFun = tunnelServer.resources.Idle
+	server.ConnectionsFun = func() int {
+		return int(tunnelServer.connections.Load())
+	}
+	return tunnelServer
+}
+
+func (htl *TunnelSocks5Server) RegisterConn(ch trp.Channel, request exchange.TRegister) (serverId string, err error) {
+	if request.GetProxyId() == "" {
+		log.Warn("Register socks5 tunnel, but It' proxyId is nil")
+		return "", errors.New("it' proxyId is nil")
+	}
+	htl.registerLock.Lock()
+	defer htl.registerLock.Unlock()
+	serverId, err = htl.BaseTunnelServer.RegisterConn(ch, request)
+	log.Info("Register socks5 tunnel, proxyId: %s", request.GetProxyId())
+	return
+}
+
+func (htl *TunnelSocks5Server) OpenWorker(_ trp.Channel, request *exchange.ClientWorkConnReq) error {
+	ch, b := htl.TunnelChannel.Load(request.ServerId)
+	if b && !ch.IsClose() {
+		_ = htl.resources.Put(ch)
+		log.Info("add user connection, proxyId: %s", request.ProxyId)
+		return nil
+	}
+	return errors.New("channel is nil or closed")
+}
+
+// listen refuses to serve without credentials, the tunnel opens the network of the client.
+func (htl *TunnelSocks5Server) listen() error {
+	if htl.Cfg().Username == "" || htl.Cfg().Password == "" {
+		return fmt.Errorf("socks5 tunnel %s needs a username and a password", htl.Id())
+	}
+	listener, err := net.Listen(string(lang.NetworkTcp), fmt.Sprintf(":%d", htl.Port()))
+	if err != nil {
+		return err
+	}
+	htl.listener = listener
+	threading.GoSafe(htl.acceptLoop)
+	return nil
+}
+
+func (htl *TunnelSocks5Server) acceptLoop() {
+	for {
+		conn, err := htl.listener.Accept()
+		if err != nil {
+			log.Info("Socks5 tunnel server %d accept exit: %v", htl.Port(), err)
+			return
+		}
+		threading.GoSafe(func() {
+			htl.serveConn(conn)
+		})
+	}
+}
+
+func (htl *TunnelSocks5Server) serveConn(conn net.Conn) {
+	htl.connections.Add(1)
+	defer htl.connections.Add(-1)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if htl.Cfg().ProxyProtocol {
+		proxied, err := tunnel.ReadProxyHeader(conn)
+		if err != nil {
+			log.Warn("Socks5 tunnel %d read PROXY protocol header of %v error: %v", htl.Port(), conn.RemoteAddr(), err)
+			return
+		}
+		conn = proxied
+	}
+	// The tunnel accepts on its own listener, the ip plugins of the gnet server don't see it.
+	if err := htl.CheckAddr(conn.RemoteAddr()); err != nil {
+		log.Warn("Socks5 tunnel %d refuse %v: %v", htl.Port(), conn.RemoteAddr(), err)
+		return
+	}
+	req, err := socks5.Handshake(conn, htl.Cfg().Username, htl.Cfg().Password)
+	if err != nil {
+		log.Debug("Socks5 tunnel %d handshake %v error: %v", htl.Port(), conn.RemoteAddr(), err)
+		return
+	}
+	workConn, err := htl.resources.Get()
+	if workConn == nil || err != nil {
+		log.Warn("Socks5 tunnel %d get user connection error: %v", htl.Port(), err)
+		_ = socks5.WriteReply(conn, socks5.RepFailure, "")
+		return
+	}
+	defer workConn.Close()
+	rep, err := htl.request(workConn, req)
+	if err != nil {
+		log.Warn("Socks5 tunnel %d request %s error: %v", htl.Port(), req.Addr, err)
+		_ = socks5.WriteReply(conn, socks5.RepFailure, "")
+		return
+	}
+	if rep != socks5.RepSuccess {
+		log.Debug("Socks5 tunnel %d request %s failed: %d", htl.Port(), req.Addr, rep)
+		_ = socks5.WriteReply(conn, rep, "")
+		return
+	}
+	if req.Cmd == socks5.CmdUdpAssociate {
+		htl.associate(conn, workConn)
+		return
+	}
+	if err = socks5.WriteReply(conn, socks5.RepSuccess, ""); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	log.Debug("Socks5 tunnel %d connect %v to %s", htl.Port(), conn.RemoteAddr(), req.Addr)
+	errs := iox.Pipe(&trafficConn{Conn: conn, traffic: htl.TrafficObj()}, workConn)
+	log.Debug("iox.Pipe error %v", errs)
+}
+
+// request sends the request to the client and reads its reply code.
+func (htl *TunnelSocks5Server) request(workConn trp.Channel, req *socks5.Request) (byte, error) {
+	if err := socks5.WriteRequest(workConn, req); err != nil {
+		return 0, err
+	}
+	rep := make([]byte, 1)
+	if _, err := io.ReadFull(workConn, rep); err != nil {
+		return 0, err
+	}
+	return rep[0], nil
+}
+
+// associate relays the datagrams of the user to the client on the work connection until
+// the tcp connection of the association closes. Only the datagrams from the address of
+// the user are relayed, the peer is checked again when its port changes.
+func (htl *TunnelSocks5Server) associate(conn net.Conn, workConn trp.Channel) {
+	host, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	udpConn, err := net.ListenUDP(string(lang.NetworkUdp), &net.UDPAddr{IP: net.ParseIP(host)})
+	if err != nil {
+		log.Warn("Socks5 tunnel %d udp associate error: %v", htl.Port(), err)
+		_ = socks5.WriteReply(conn, socks5.RepFailure, "")
+		return
+	}
+	var closeOnce sync.Once
+	closeAll := func() {
+		closeOnce.Do(func() {
+			_ = conn.Close()
+			_ = udpConn.Close()
+			_ = workConn.Close()
+		})
+	}
+	defer closeAll()
+	if err = socks5.WriteReply(conn, socks5.RepSuccess, udpConn.LocalAddr().String()); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	log.Debug("Socks5 tunnel %d udp associate %v on %v", htl.Port(), conn.RemoteAddr(), udpConn.LocalAddr())
+	threading.GoSafe(func() {
+		_, _ = io.Copy(io.Discard, conn)
+		closeAll()
+	})
+	userIp := conn.RemoteAddr().(*net.TCPAddr).IP
+	var user atomic.Pointer[net.UDPAddr]
+	threading.GoSafe(func() {
+		defer closeAll()
+		buf := make([]byte, 0xffff)
+		for {
+			n, err := socks5.ReadFrame(workConn, buf[3:])
+			if err != nil {
+				return
+			}
+			to := user.Load()
+			if to == nil {
+				continue
+			}
+			if _, err = udpConn.WriteToUDP(buf[:3+n], to); err != nil {
+				return
+			}
+			htl.TrafficObj().AddOutBytes(n)
+		}
+	})
+	buf := make([]byte, 0xffff)
+	for {
+		n, from, err := udpConn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if !from.IP.Equal(userIp) {
+			continue
+		}
+		if to := user.Load(); to == nil || to.Port != from.Port {
+			if err = htl.CheckAddr(from); err != nil {
+				log.Warn("Socks5 tunnel %d refuse datagram of %v: %v", htl.Port(), from, err)
+				continue
+			}
+		}
+		user.Store(from)
+		if _, _, err = socks5.ParseDatagram(buf[:n]); err != nil {
+			log.Debug("Socks5 tunnel %d drop datagram: %v", htl.Port(), err)
+			continue
+		}
+		if err = socks5.WriteFrame(workConn, buf[3:n]); err != nil {
+			return
+		}
+		htl.TrafficObj().AddInBytes(n)
+	}
+}
+
+func (htl *TunnelSocks5Server) startAfter() error {
+	tunnel.AddTunnel(htl)
+	log.Info("Socks5 tunnel server started:%v", htl.Port())
+	return nil
+}
+
+// Shutdown closes the listener and the registered tunnels.
+func (htl *TunnelSocks5Server) Shutdown() {
+	htl.closeListener()
+	htl.BaseTunnelServer.Shutdown()
+}
+
+// closeListener stops accepting, the accepted connections keep running.
+func (htl *TunnelSocks5Server) closeListener() {
+	if htl.listener != nil {
+		_ = htl.listener.Close()
+	}
+}
+
+// trafficConn counts the bytes of a user connection.
+type trafficConn struct {
+	net.Conn
+	traffic *metrics.TunnelTraffic
+}
+
+func (t *trafficConn) Read(p []byte) (int, error) {
+	n, err := t.Conn.Read(p)
+	if t.traffic != nil && n > 0 {
+		t.traffic.AddInBytes(n)
+	}
+	return n, err
+}
+
+func (t *trafficConn) Write(p []byte) (int, error) {
+	n, err := t.Conn.Write(p)
+	if t.traffic != nil && n > 0 {
+		t.traffic.AddOutBytes(n)
+	}
+	return n, err
+}
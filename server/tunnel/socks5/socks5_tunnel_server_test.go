@@ -0,0 +1,111 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package socks5
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/modules"
+	"github.com/g-brook/brook/server/srv"
+	"github.com/g-brook/brook/server/tunnel"
+)
+
+// denyPlugin refuses every visitor of the tunnels with the id "deny".
+type denyPlugin struct {
+	srv.BaseServerHandler
+	cfg *configs.ServerTunnelConfig
+}
+
+func (d *denyPlugin) Bind(cfg *configs.ServerTunnelConfig) {
+	d.cfg = cfg
+}
+
+func (d *denyPlugin) CheckIp(ip net.IP) error {
+	if d.cfg.Id == "deny" {
+		return errors.New("ip denied: " + ip.String())
+	}
+	return nil
+}
+
+func (d *denyPlugin) Module() modules.ModuleInfo {
+	return modules.ModuleInfo{
+		ID:         "socks5-test-deny",
+		ModuleType: modules.TunnelPluginsModule,
+		New: func() modules.Module {
+			return new(denyPlugin)
+		},
+	}
+}
+
+func init() {
+	modules.RegisterModule(new(denyPlugin))
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen(string(lang.NetworkTcp), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestSocks5CheckIp(t *testing.T) {
+	tests := []struct {
+		id    string
+		reply []byte
+	}{
+		{id: "allow", reply: []byte{0x05, 0x02}},
+		{id: "deny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			cfg := &configs.ServerTunnelConfig{Id: tt.id, Port: freePort(t), Username: "u", Password: "p"}
+			server := NewSocks5TunnelServer(tunnel.NewBaseTunnelServer(cfg))
+			if err := server.Start(lang.NetworkTcp); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Shutdown()
+			conn, err := net.Dial(string(lang.NetworkTcp), server.listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err = conn.Write([]byte{0x05, 0x01, 0x02}); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, 2)
+			_, err = io.ReadFull(conn, reply)
+			if tt.reply == nil {
+				if err == nil {
+					t.Fatalf("denied visitor got a reply %v", reply)
+				}
+				return
+			}
+			if err != nil || reply[0] != tt.reply[0] || reply[1] != tt.reply[1] {
+				t.Fatalf("got %v, %v, want %v", reply, err, tt.reply)
+			}
+		})
+	}
+}
@@ -25,42 +25,64 @@ import (
 	. "github.com/g-brook/brook/server/tunnel"
 )
 
+// Managers selects the client that opens the work connections.
+type Managers interface {
+	GetManager() trp.Channel
+
+	ManagerFailed(ch trp.Channel)
+}
+
+const maxManagerRetry = 3
+
 type Resources struct {
-	pool       *TunnelPool
-	cfg        *configs.ServerTunnelConfig
-	getManager func() trp.Channel
+	pool     *TunnelPool
+	cfg      *configs.ServerTunnelConfig
+	managers Managers
 }
 
 // NewResources creates and returns a new Resources instance
 // This is a constructor function that initializes a Resources struct
 func NewResources(size int,
 	cfg *configs.ServerTunnelConfig,
-	getManager func() trp.Channel) *Resources {
+	managers Managers) *Resources {
 	p := &Resources{
-		getManager: getManager,
-		cfg:        cfg,
+		managers: managers,
+		cfg:      cfg,
 	}
 	p.pool = NewTunnelPool(p.createConnection, size)
 	return p
 }
 
+// createConnection asks a client for a work connection, the next client is asked when
+// the request can't be sent.
 func (htl *Resources) createConnection() error {
-	manager := htl.getManager()
-	if manager != nil {
-		req := &exchange.WorkConnReq{
-			ProxyId: htl.cfg.Id,
+	req := &exchange.WorkConnReq{
+		ProxyId: htl.cfg.Id,
+	}
+	request, _ := exchange.NewRequest(req)
+	for i := 0; i < maxManagerRetry; i++ {
+		manager := htl.managers.GetManager()
+		if manager == nil {
+			break
+		}
+		if _, err := manager.Write(request.Bytes()); err != nil {
+			htl.managers.ManagerFailed(manager)
+			continue
 		}
-		request, _ := exchange.NewRequest(req)
-		_, _ = manager.Write(request.Bytes())
 		return nil
 	}
 	return errors.New("manager is nil, can't create connection")
 }
 
-func (htl *Resources) get() (trp.Channel, error) {
+func (htl *Resources) Get() (trp.Channel, error) {
 	return htl.pool.Get()
 }
 
-func (htl *Resources) put(ch trp.Channel) error {
+func (htl *Resources) Put(ch trp.Channel) error {
 	return htl.pool.Put(ch)
 }
+
+// Idle get the count of the idle connections in the pool.
+func (htl *Resources) Idle() int {
+	return htl.pool.Idle()
+}
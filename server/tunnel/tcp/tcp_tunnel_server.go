@@ -17,8 +17,11 @@
 package tcp
 
 import (
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/iox"
@@ -34,18 +37,69 @@ type TunnelTcpServer struct {
 	*tunnel.BaseTunnelServer
 	registerLock sync.Mutex
 	resources    *Resources
+	// visitors the count of the connections of the visitor clients of a secret tunnel.
+	visitors atomic.Int32
 }
 
 // NewTcpTunnelServer creates a new TCP tunnel server instance
 func NewTcpTunnelServer(server *tunnel.BaseTunnelServer) *TunnelTcpServer {
 	tunnelServer := &TunnelTcpServer{
 		BaseTunnelServer: server,
-		resources:        NewResources(100, server.Cfg, server.GetManager),
+		resources:        NewResources(100, server.Cfg(), server),
 	}
 	server.DoStart = tunnelServer.startAfter
+	server.PoolIdleFun = tunnelServer.resources.Idle
+	if server.Cfg().Secret != "" {
+		//A secret tunnel has no public port, its connections come from the visitor clients.
+		server.DoListen = func() error {
+			return nil
+		}
+		server.ConnectionsFun = func() int {
+			return int(tunnelServer.visitors.Load())
+		}
+	}
 	return tunnelServer
 }
 
+// Visit pairs the stream of a visitor client with a work connection of the serving client,
+// the returned function starts piping them once the visitor got the response.
+func (htl *TunnelTcpServer) Visit(ch trp.Channel, secret string) (func(), error) {
+	if err := htl.Authorize(secret); err != nil {
+		log.Warn("Visitor %v of tunnel %s: %v", ch.RemoteAddr(), htl.Id(), err)
+		return nil, err
+	}
+	workConn, err := htl.resources.Get()
+	if workConn == nil || err != nil {
+		return nil, fmt.Errorf("no work connection of tunnel %s: %v", htl.Id(), err)
+	}
+	if err = tunnel.SendVisitorAddr(workConn, ch.RemoteAddr(), ch.LocalAddr()); err != nil {
+		_ = workConn.Close()
+		return nil, err
+	}
+	ch.OnClose(func(trp.Channel) {
+		_ = workConn.Close()
+	})
+	return func() {
+		htl.visitors.Add(1)
+		threading.GoSafe(func() {
+			defer htl.visitors.Add(-1)
+			errs := iox.Pipe(ch, workConn)
+			log.Debug("Visitor %v of tunnel %s closed %v", ch.RemoteAddr(), htl.Id(), errs)
+		})
+	}, nil
+}
+
+// Authorize checks the secret of a visitor client.
+func (htl *TunnelTcpServer) Authorize(secret string) error {
+	if htl.Cfg().Secret == "" {
+		return fmt.Errorf("tunnel %s is not secret", htl.Id())
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(htl.Cfg().Secret)) != 1 {
+		return errors.New("the secret is wrong")
+	}
+	return nil
+}
+
 func (htl *TunnelTcpServer) RegisterConn(ch trp.Channel, request exchange.TRegister) (serverId string, err error) {
 	if request.GetProxyId() == "" {
 		log.Warn("Register tcp tunnel, but It' proxyId is nil")
@@ -63,7 +117,7 @@ func (htl *TunnelTcpServer) OpenWorker(ch trp.Channel, request *exchange.ClientW
 	id := request.ServerId
 	ch, b := htl.TunnelChannel.Load(id)
 	if b && !ch.IsClose() {
-		_ = htl.resources.put(ch)
+		_ = htl.resources.Put(ch)
 		log.Info("add user connection, proxyId: %s", request.ProxyId)
 		return nil
 	}
@@ -90,11 +144,17 @@ func (htl *TunnelTcpServer) Reader(ch trp.Channel, _ srv.TraverseBy) error {
 }
 
 func (htl *TunnelTcpServer) Open(ch trp.Channel, _ srv.TraverseBy) error {
-	userConn, err := htl.resources.get()
+	userConn, err := htl.resources.Get()
 	if userConn == nil || err != nil {
 		_ = ch.Close()
 		return err
 	}
+	if err = tunnel.SendVisitorAddr(userConn, ch.RemoteAddr(), ch.LocalAddr()); err != nil {
+		log.Warn("Tcp tunnel %d send visitor address error: %v", htl.Port(), err)
+		_ = userConn.Close()
+		_ = ch.Close()
+		return err
+	}
 	switch workConn := ch.(type) {
 	case srv.GContext:
 		workConn.GetContext().AddAttr(defin.ToSChannelId, userConn.GetId())
@@ -108,6 +168,10 @@ func (htl *TunnelTcpServer) Open(ch trp.Channel, _ srv.TraverseBy) error {
 
 func (htl *TunnelTcpServer) startAfter() error {
 	tunnel.AddTunnel(htl)
+	if htl.Cfg().Secret != "" {
+		log.Info("TCP secret tunnel started:%v", htl.Id())
+		return nil
+	}
 	htl.Server.AddHandler(htl)
 	log.Info("TCP tunnel server started:%v", htl.Port())
 	return nil
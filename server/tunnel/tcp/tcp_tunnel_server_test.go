@@ -0,0 +1,136 @@
+/*
+ * Copyright ©  sixh sixh@apache.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/g-brook/brook/common/configs"
+	"github.com/g-brook/brook/common/lang"
+	"github.com/g-brook/brook/common/log"
+	trp "github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/tunnel"
+)
+
+// tcpPair returns the two ends of a loopback tcp connection, the health check of the pool
+// writes to them.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	dialed, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		_ = dialed.Close()
+		_ = conn.Close()
+	})
+	return dialed, conn
+}
+
+func secretTunnel(secret string) *TunnelTcpServer {
+	return NewTcpTunnelServer(tunnel.NewBaseTunnelServer(&configs.ServerTunnelConfig{Id: "secret", Type: lang.Tcp, Secret: secret}))
+}
+
+func TestVisitRefused(t *testing.T) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	tests := []struct {
+		name   string
+		server *TunnelTcpServer
+		secret string
+		want   string
+	}{
+		{"wrong secret", secretTunnel("pw"), "bad", "secret is wrong"},
+		{"empty secret", secretTunnel("pw"), "", "secret is wrong"},
+		{"not a secret tunnel", secretTunnel(""), "", "is not secret"},
+		{"no work connection", secretTunnel("pw"), "pw", "no work connection"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visitor, _ := tcpPair(t)
+			start, err := tt.server.Visit(trp.NewCChannel(visitor, context.Background()), tt.secret)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Visit error %v, want %q", err, tt.want)
+			}
+			if start != nil {
+				t.Fatal("refused visit can be started")
+			}
+		})
+	}
+}
+
+func TestVisit(t *testing.T) {
+	log.NewLogger(&configs.LoggerConfig{Outs: "stdout"})
+	server := secretTunnel("pw")
+	visitorConn, visitorEnd := tcpPair(t)
+	workConn, serviceEnd := tcpPair(t)
+	if err := server.resources.Put(trp.NewCChannel(workConn, context.Background())); err != nil {
+		t.Fatal(err)
+	}
+	start, err := server.Visit(trp.NewCChannel(visitorConn, context.Background()), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := server.Connections(); n != 0 {
+		t.Fatalf("Connections before the start = %d, want 0", n)
+	}
+	start()
+	if n := server.Connections(); n != 1 {
+		t.Fatalf("Connections = %d, want 1", n)
+	}
+
+	if _, err = visitorEnd.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	_ = serviceEnd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = io.ReadFull(serviceEnd, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("service read %q %v, want ping", buf, err)
+	}
+
+	_ = visitorEnd.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Connections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.Connections(); n != 0 {
+		t.Fatalf("Connections after the visitor closed = %d, want 0", n)
+	}
+	// The work connection is closed with the visitor.
+	_ = serviceEnd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = serviceEnd.Read(buf); err == nil {
+		t.Fatal("work connection still open")
+	}
+}
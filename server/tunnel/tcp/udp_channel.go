@@ -17,19 +17,20 @@
 package tcp
 
 import (
-	"encoding/json"
 	"net"
 
 	"github.com/g-brook/brook/common/exchange"
 	"github.com/g-brook/brook/common/hash"
 	"github.com/g-brook/brook/common/log"
 	"github.com/g-brook/brook/common/transport"
+	"github.com/g-brook/brook/server/defin"
 )
 
 type UdpSChannel struct {
 	*transport.SChannel
 	bucket     *exchange.TunnelBucket
 	udpConnMap hash.SyncMap[string, transport.Channel]
+	ver        int8
 }
 
 func NewUdpChannel(src *transport.SChannel) *UdpSChannel {
@@ -37,14 +38,17 @@ func NewUdpChannel(src *transport.SChannel) *UdpSChannel {
 	channel := &UdpSChannel{
 		SChannel: src,
 		bucket:   bucket,
+		ver:      exchange.V1,
+	}
+	if ver, ok := src.GetAttr(defin.UdpVerKey); ok {
+		channel.ver = ver.(int8)
 	}
 	bucket.DefaultRead(channel.read)
 	return channel
 }
 
 func (r *UdpSChannel) read(p *exchange.TunnelProtocol) {
-	var udpPackage exchange.UdpPackage
-	err := json.Unmarshal(p.Data, &udpPackage)
+	udpPackage, err := exchange.DecodeUdpPackage(p)
 	if err != nil {
 		return
 	}
@@ -62,11 +66,15 @@ func (r *UdpSChannel) AsyncWriter(data []byte, ct transport.Channel) {
 		return
 	}
 	udpPackage := exchange.NewUdpPackage(data, nil, remoteAddress)
-	jsonData, _ := json.Marshal(udpPackage)
+	pkData, err := exchange.EncodeUdpPackage(udpPackage, r.ver)
+	if err != nil {
+		log.Warn("Encode udp package error %v", err)
+		return
+	}
 	s := remoteAddress.String()
 	_, b := r.udpConnMap.Load(s)
 	if !b {
 		r.udpConnMap.Store(s, ct)
 	}
-	_ = r.bucket.Push(jsonData, nil)
+	_ = r.bucket.PushVer(r.ver, pkData)
 }
@@ -37,9 +37,10 @@ type TunnelUdpServer struct {
 func NewUdpTunnelServer(server *tunnel.BaseTunnelServer) *TunnelUdpServer {
 	tunnelServer := &TunnelUdpServer{
 		BaseTunnelServer: server,
-		resources:        NewResources(100, server.Cfg, server.GetManager),
+		resources:        NewResources(100, server.Cfg(), server),
 	}
 	server.DoStart = tunnelServer.startAfter
+	server.PoolIdleFun = tunnelServer.resources.Idle
 	return tunnelServer
 }
 
@@ -62,7 +63,7 @@ func (htl *TunnelUdpServer) OpenWorker(ch trp.Channel, request *exchange.ClientW
 	id := request.ServerId
 	ch, b := htl.TunnelChannel.Load(id)
 	if b && !ch.IsClose() {
-		_ = htl.resources.put(NewUdpChannel(ch.(*trp.SChannel)))
+		_ = htl.resources.Put(NewUdpChannel(ch.(*trp.SChannel)))
 		log.Info("dup add user connection, proxyId: %s", request.ProxyId)
 		return nil
 	}
@@ -72,14 +73,14 @@ func (htl *TunnelUdpServer) OpenWorker(ch trp.Channel, request *exchange.ClientW
 func (htl *TunnelUdpServer) Reader(ch trp.Channel, tb srv.TraverseBy) error {
 	switch workConn := ch.(type) {
 	case srv.GContext:
-		userConn, _ := htl.resources.get()
+		userConn, _ := htl.resources.Get()
 		if userConn == nil {
 			_ = ch.Close()
 			return nil
 		}
 		data, _ := workConn.Next(-1)
 		userConn.(*UdpSChannel).AsyncWriter(data, ch)
-		_ = htl.resources.put(userConn)
+		_ = htl.resources.Put(userConn)
 		return nil
 	}
 	tb()
@@ -17,6 +17,8 @@
 package tunnel
 
 import (
+	"net"
+
 	"github.com/g-brook/brook/common/configs"
 	"github.com/g-brook/brook/common/modules"
 	"github.com/g-brook/brook/server/srv"
@@ -25,5 +27,13 @@ import (
 type Plugin interface {
 	srv.ServerHandler
 	modules.Module
+	// Bind binds the plugin to the config of the tunnel, it's called again with the new
+	// config when the tunnel is updated.
 	Bind(cfg *configs.ServerTunnelConfig)
 }
+
+// IpChecker is a plugin that checks the ip of the visitor on open, the http tunnels ask it
+// again for the client behind their trusted proxies.
+type IpChecker interface {
+	CheckIp(ip net.IP) error
+}
@@ -111,6 +111,11 @@ func (r *TunnelPool) Put(sch transport.Channel) error {
 	}
 }
 
+// Idle get the count of the channels waiting in the pool.
+func (r *TunnelPool) Idle() int {
+	return len(r.channels)
+}
+
 func DefaultCheckHealth(ch transport.Channel) bool {
 	if ch == nil {
 		return false
@@ -18,15 +18,16 @@ package tunnel
 
 import (
 	"github.com/g-brook/brook/common/exchange"
+	"github.com/g-brook/brook/common/hash"
 	"github.com/g-brook/brook/common/lang"
 	"github.com/g-brook/brook/common/transport"
 )
 
 // Save all tunnels channel. port: server.
-var tunnels map[int]TunnelServer
+var tunnels *hash.SyncMap[int, TunnelServer]
 
 func init() {
-	tunnels = make(map[int]TunnelServer)
+	tunnels = hash.NewSyncMap[int, TunnelServer]()
 }
 
 // AddTunnel
@@ -34,7 +35,17 @@ func init() {
 //	@Description: Add tunnel server.
 //	@param tunnel
 func AddTunnel(tunnel TunnelServer) {
-	tunnels[tunnel.Port()] = tunnel
+	tunnels.Store(tunnel.Port(), tunnel)
+}
+
+// RemoveTunnel
+//
+//	@Description: Remove tunnel server, unless another server has taken its port.
+//	@param tunnel
+func RemoveTunnel(tunnel TunnelServer) {
+	if t, ok := tunnels.Load(tunnel.Port()); ok && t == tunnel {
+		tunnels.Delete(tunnel.Port())
+	}
 }
 
 // GetTunnel
@@ -43,13 +54,48 @@ func AddTunnel(tunnel TunnelServer) {
 //	@param port
 //	@return TunnelServer
 func GetTunnel(port int) TunnelServer {
-	tunnel, ok := tunnels[port]
+	tunnel, ok := tunnels.Load(port)
 	if ok {
 		return tunnel
 	}
 	return nil
 }
 
+// FindTunnel
+//
+//	@Description: Get TunnelServer server by port, falls back to the proxy id when the
+//	port of the tunnel was changed by a reload.
+//	@param port
+//	@param proxyId
+//	@return TunnelServer
+func FindTunnel(port int, proxyId string) TunnelServer {
+	tunnel := GetTunnel(port)
+	if tunnel != nil && (proxyId == "" || tunnel.Id() == proxyId) {
+		return tunnel
+	}
+	if proxyId == "" {
+		return nil
+	}
+	return GetTunnelById(proxyId)
+}
+
+// GetTunnelById
+//
+//	@Description: Get TunnelServer server by proxy id.
+//	@param proxyId
+//	@return TunnelServer
+func GetTunnelById(proxyId string) TunnelServer {
+	var tunnel TunnelServer
+	tunnels.Range(func(_ int, t TunnelServer) bool {
+		if t.Id() == proxyId {
+			tunnel = t
+			return false
+		}
+		return true
+	})
+	return tunnel
+}
+
 // TunnelServer
 // @Description: Define TunnelServer interface.
 type TunnelServer interface {
@@ -78,6 +124,32 @@ type TunnelServer interface {
 	// PutManager put tunnel manager.
 	PutManager(ch transport.Channel)
 
+	// Managers get the manager channels of the clients that opened the tunnel.
+	Managers() []transport.Channel
+
+	// RemoveManager the client of the manager channel stops serving the tunnel.
+	RemoveManager(ch transport.Channel)
+
+	// Connections get the count of user connections.
+	Connections() int
+
+	// StopAccept stops taking new user connections, the open ones keep running.
+	StopAccept()
+
 	// Shutdown shutdown.
 	Shutdown()
 }
+
+// VisitTunnel
+// @Description: A secret tunnel reached by the visitor clients instead of a public port.
+type VisitTunnel interface {
+	// Visit pairs the stream of a visitor with a connection of the serving client, the
+	// returned function starts piping them.
+	Visit(ch transport.Channel, secret string) (func(), error)
+
+	// Authorize checks the secret of a visitor.
+	Authorize(secret string) error
+
+	// GetManager selects the manager channel of a client serving the tunnel.
+	GetManager() transport.Channel
+}